@@ -0,0 +1,120 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package binancechain
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/binance-chain/go-sdk/types/tx"
+	"github.com/tendermint/go-amino"
+	core_types "github.com/tendermint/tendermint/rpc/core/types"
+)
+
+const (
+	defaultAccountCacheTTL = 3 * time.Second //默认账户缓存有效期
+)
+
+//cdc 进程内共享的amino编解码器，注册类型后只读，可并发使用
+var cdc = newCodec()
+
+//newCodec 创建并注册账户、手续费和交易类型的编解码器
+func newCodec() *amino.Codec {
+	c := amino.NewCodec()
+	core_types.RegisterAmino(c)
+	types.RegisterWire(c)
+	tx.RegisterCodec(c)
+	return c
+}
+
+//accountCacheItem 账户缓存项
+type accountCacheItem struct {
+	account types.Account
+	expire  time.Time
+}
+
+//accountCache 短时间的账户缓存，以地址和查询高度为键，避免构建交易时重复查询同一账户
+type accountCache struct {
+	mu        sync.Mutex
+	TTL       time.Duration
+	items     map[string]*accountCacheItem
+	lastSweep time.Time //上一次清理过期缓存项的时间
+}
+
+//newAccountCache 创建账户缓存，ttl为0时不缓存
+func newAccountCache(ttl time.Duration) *accountCache {
+	return &accountCache{
+		TTL:   ttl,
+		items: make(map[string]*accountCacheItem),
+	}
+}
+
+//accountCacheKey 缓存键，height为0表示最新高度
+func accountCacheKey(address string, height uint64) string {
+	return fmt.Sprintf("%s@%d", address, height)
+}
+
+//get 获取未过期的账户，不存在的账户以nil缓存
+func (ac *accountCache) get(address string, height uint64) (types.Account, bool) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	key := accountCacheKey(address, height)
+	item, exist := ac.items[key]
+	if !exist {
+		return nil, false
+	}
+	if time.Now().After(item.expire) {
+		delete(ac.items, key)
+		return nil, false
+	}
+	return item.account, true
+}
+
+//set 缓存账户
+func (ac *accountCache) set(address string, height uint64, account types.Account) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	if ac.TTL <= 0 {
+		return
+	}
+
+	now := time.Now()
+	//每个有效期最多清理一次过期的缓存项，批量写入时不重复遍历
+	if now.Sub(ac.lastSweep) >= ac.TTL {
+		for key, item := range ac.items {
+			if now.After(item.expire) {
+				delete(ac.items, key)
+			}
+		}
+		ac.lastSweep = now
+	}
+
+	ac.items[accountCacheKey(address, height)] = &accountCacheItem{
+		account: account,
+		expire:  now.Add(ac.TTL),
+	}
+}
+
+//purge 清空缓存，广播交易后账户序号和余额已改变
+func (ac *accountCache) purge() {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	ac.items = make(map[string]*accountCacheItem)
+}
@@ -16,10 +16,95 @@
 package binancechain
 
 import (
-	"github.com/blocktree/go-owcdrivers/addressEncoder"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/binance-chain/go-sdk/common/bech32"
+	"github.com/binance-chain/go-sdk/common/types"
 	owcrypt "github.com/blocktree/go-owcrypt"
 )
 
+//AddressHashLength 地址数据的字节数
+const AddressHashLength = 20
+
+//AddressReason 地址校验失败的原因
+type AddressReason int
+
+const (
+	AddressEmpty       AddressReason = iota + 1 //地址为空
+	AddressMalformed                            //不是有效的bech32字符串
+	AddressBadChecksum                          //bech32校验和错误
+	AddressWrongPrefix                          //前缀与配置的网络不一致
+	AddressBadLength                            //地址数据不是20字节
+)
+
+//String 原因描述
+func (reason AddressReason) String() string {
+	switch reason {
+	case AddressEmpty:
+		return "empty address"
+	case AddressMalformed:
+		return "malformed bech32 string"
+	case AddressBadChecksum:
+		return "bad bech32 checksum"
+	case AddressWrongPrefix:
+		return "wrong network prefix"
+	case AddressBadLength:
+		return "wrong address length"
+	}
+	return "unknown reason"
+}
+
+//AddressError 地址校验失败，Reason为失败原因
+type AddressError struct {
+	Address string
+	Reason  AddressReason
+	Message string
+}
+
+func (e *AddressError) Error() string {
+	return fmt.Sprintf("invalid address [%s]: %s, %s", e.Address, e.Reason, e.Message)
+}
+
+//DecodeAddress 校验bech32校验和、前缀和20字节的地址数据，返回地址数据，失败时返回*AddressError
+func DecodeAddress(address, prefix string) (types.AccAddress, error) {
+
+	if len(address) == 0 {
+		return nil, &AddressError{Address: address, Reason: AddressEmpty, Message: "address is required"}
+	}
+
+	hrp, hash, err := bech32.DecodeAndConvert(address)
+	if err != nil {
+		reason := AddressMalformed
+		if strings.Contains(err.Error(), "checksum") {
+			reason = AddressBadChecksum
+		}
+		return nil, &AddressError{Address: address, Reason: reason, Message: err.Error()}
+	}
+	if hrp != prefix {
+		return nil, &AddressError{Address: address, Reason: AddressWrongPrefix, Message: fmt.Sprintf("prefix %s, expected %s", hrp, prefix)}
+	}
+	if len(hash) != AddressHashLength {
+		return nil, &AddressError{Address: address, Reason: AddressBadLength, Message: fmt.Sprintf("%d bytes, expected %d", len(hash), AddressHashLength)}
+	}
+	return types.AccAddress(hash), nil
+}
+
+//encodeAddress 按前缀编码地址数据，不使用go-sdk全局的types.Network
+func encodeAddress(address types.AccAddress, prefix string) string {
+	encoded, _ := bech32.ConvertAndEncode(prefix, address)
+	return encoded
+}
+
+//AddressReasonOf 地址校验失败的原因，不是地址错误时返回0
+func AddressReasonOf(err error) AddressReason {
+	if e, ok := err.(*AddressError); ok {
+		return e.Reason
+	}
+	return 0
+}
+
 type addressDecoder struct {
 	wm *WalletManager //钱包管理者
 }
@@ -31,20 +116,31 @@ func NewAddressDecoder(wm *WalletManager) *addressDecoder {
 	return &decoder
 }
 
-//PrivateKeyToWIF 私钥转WIF
+//ValidateAddress 按配置的网络校验地址
+func (decoder *addressDecoder) ValidateAddress(address string) error {
+	_, err := DecodeAddress(address, decoder.wm.addressPrefix())
+	return err
+}
+
+//PrivateKeyToWIF 私钥转WIF，BNB没有WIF格式，使用Binance Chain钱包导入导出的十六进制私钥
 func (decoder *addressDecoder) PrivateKeyToWIF(priv []byte, isTestnet bool) (string, error) {
-	return "", nil
+	if err := validatePrivateKey(priv); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(priv), nil
 }
 
-//PublicKeyToAddress 公钥转地址
+//PublicKeyToAddress 公钥转地址，isTestnet或配置的IsTestNet为true时使用测试网前缀tbnb，
+//openwallet批量创建地址时isTestnet固定为false
 func (decoder *addressDecoder) PublicKeyToAddress(pub []byte, isTestnet bool) (string, error) {
 
-	cfg := addressEncoder.BNB_mainnetAddress
+	if decoder.wm != nil && decoder.wm.Config.IsTestNet {
+		isTestnet = true
+	}
 
 	pkHash := owcrypt.Hash(pub, 32, owcrypt.HASH_ALG_HASH160)
 
-	address := addressEncoder.AddressEncode(pkHash, cfg)
-	return address, nil
+	return bech32.ConvertAndEncode(AddressPrefix(isTestnet), pkHash)
 }
 
 //RedeemScriptToAddress 多重签名赎回脚本转地址
@@ -52,8 +148,7 @@ func (decoder *addressDecoder) RedeemScriptToAddress(pubs [][]byte, required uin
 	return "", nil
 }
 
-//WIFToPrivateKey WIF转私钥
+//WIFToPrivateKey WIF转私钥，wif为十六进制私钥，可带0x前缀
 func (decoder *addressDecoder) WIFToPrivateKey(wif string, isTestnet bool) ([]byte, error) {
-	return nil, nil
-
+	return decodePrivateKeyHex(wif)
 }
@@ -0,0 +1,72 @@
+package binancechain
+
+import (
+	"testing"
+
+	"github.com/binance-chain/go-sdk/common/bech32"
+	"github.com/blocktree/binance-chain-adapter/binancechaintest"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+func Test_validateAddress(t *testing.T) {
+	hash := make([]byte, AddressHashLength)
+	hash[0] = 1
+	mainnet, _ := bech32.ConvertAndEncode(MainnetAddressPrefix, hash)
+	testnet, _ := bech32.ConvertAndEncode(TestnetAddressPrefix, hash)
+	long, _ := bech32.ConvertAndEncode(MainnetAddressPrefix, append(hash, 0))
+	corrupted := mainnet[:len(mainnet)-1] + "q"
+	if corrupted == mainnet {
+		corrupted = mainnet[:len(mainnet)-1] + "p"
+	}
+
+	tests := []struct {
+		address string
+		reason  AddressReason
+	}{
+		{mainnet, 0},
+		{"", AddressEmpty},
+		{"bnb1 invalid", AddressMalformed},
+		{corrupted, AddressBadChecksum},
+		{testnet, AddressWrongPrefix},
+		{long, AddressBadLength},
+	}
+
+	wm := NewWalletManager()
+	decoder := wm.Decoder.(*addressDecoder)
+	for _, test := range tests {
+		err := decoder.ValidateAddress(test.address)
+		if reason := AddressReasonOf(err); reason != test.reason {
+			t.Errorf("address [%s] reason = %v (%v), expected %v", test.address, reason, err, test.reason)
+		}
+	}
+
+	wm.Config.IsTestNet = true
+	if err := decoder.ValidateAddress(testnet); err != nil {
+		t.Errorf("testnet address failed unexpected error: %v", err)
+	}
+	if reason := AddressReasonOf(decoder.ValidateAddress(mainnet)); reason != AddressWrongPrefix {
+		t.Errorf("mainnet address on testnet reason = %v, expected %v", reason, AddressWrongPrefix)
+	}
+}
+
+func Test_createTransactionInvalidAddress(t *testing.T) {
+	node := binancechaintest.NewNode("")
+	defer node.Close()
+
+	wm, cleanup := newMockNodeWalletManager(t, node)
+	defer cleanup()
+
+	testnet, _ := bech32.ConvertAndEncode(TestnetAddressPrefix, make([]byte, AddressHashLength))
+	rawTx := &openwallet.RawTransaction{
+		Coin:    openwallet.Coin{Symbol: Symbol, IsContract: true, Contract: openwallet.SmartContract{Address: "BNB", Decimals: 8}},
+		Account: &openwallet.AssetsAccount{AccountID: "mock"},
+		To:      map[string]string{testnet: "0.5"},
+	}
+	err := wm.TxDecoder.CreateRawTransaction(&mockWallet{}, rawTx)
+	if owErr, ok := err.(*openwallet.Error); !ok || owErr.Code() != openwallet.ErrAdressDecodeFailed {
+		t.Errorf("expected address decode error, got %v", err)
+	}
+	if rawTx.IsBuilt || len(rawTx.RawHex) > 0 {
+		t.Errorf("transaction built with invalid destination")
+	}
+}
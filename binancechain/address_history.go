@@ -0,0 +1,283 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package binancechain
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/binance-chain/go-sdk/common/bech32"
+)
+
+const (
+	txSearchPageSize = 100 //tx_search单页最大数量
+)
+
+//转账交易单的索引标签
+const (
+	tagSender    = "sender"
+	tagRecipient = "recipient"
+)
+
+//AddressTxQuery 地址交易记录查询条件
+type AddressTxQuery struct {
+	Addresses []string //查询的地址，结果包含任一地址发送或接收的转账
+	Denom     string   //币种，为空时不过滤
+	MinHeight uint64   //最低高度，0表示不限制
+	MaxHeight uint64   //最高高度，0表示不限制
+	Offset    int      //跳过的交易单数量
+	Limit     int      //返回的最大数量，0或负数表示全部
+	Ascending bool     //按高度从旧到新排序，默认从新到旧
+}
+
+//validate 检查查询的地址，地址会拼接到查询语句中，必须是合法地址
+func (q AddressTxQuery) validate() error {
+	for _, addr := range q.Addresses {
+		if _, _, err := bech32.DecodeAndConvert(addr); err != nil {
+			return fmt.Errorf("invalid address [%s]: %v", addr, err)
+		}
+	}
+	return nil
+}
+
+//want 每个查询来源最多需要的交易单数量，-1表示全部
+func (q AddressTxQuery) want() int {
+	if q.Limit <= 0 {
+		return -1
+	}
+	if q.Offset < 0 {
+		return q.Limit
+	}
+	return q.Offset + q.Limit
+}
+
+//match 交易单是否符合币种和高度条件
+func (q AddressTxQuery) match(trx *Transaction) bool {
+	if trx == nil {
+		return false
+	}
+	if len(q.Denom) > 0 && trx.TxDetails[q.Denom] == nil {
+		return false
+	}
+	if q.MinHeight > 0 && trx.BlockHeight < q.MinHeight {
+		return false
+	}
+	if q.MaxHeight > 0 && trx.BlockHeight > q.MaxHeight {
+		return false
+	}
+	return true
+}
+
+//searchedTx 查询到的交易单及其在区块中的位置
+type searchedTx struct {
+	trx   *Transaction
+	index int64
+}
+
+//mergeAddressTxs 合并多个查询来源的结果，去重排序后按Offset和Limit截取。
+//每个来源按相同顺序返回前Offset+Limit个结果，合并后的前Offset+Limit个结果必然都在其中
+func mergeAddressTxs(q AddressTxQuery, sources ...[]searchedTx) []*Transaction {
+
+	seen := make(map[string]bool)
+	merged := make([]searchedTx, 0)
+	for _, txs := range sources {
+		for _, tx := range txs {
+			txid := strings.ToUpper(tx.trx.TxID)
+			if seen[txid] {
+				continue
+			}
+			seen[txid] = true
+			merged = append(merged, tx)
+		}
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		a, b := merged[i], merged[j]
+		if a.trx.BlockHeight != b.trx.BlockHeight {
+			return (a.trx.BlockHeight < b.trx.BlockHeight) == q.Ascending
+		}
+		return (a.index < b.index) == q.Ascending
+	})
+
+	start := q.Offset
+	if start < 0 {
+		start = 0
+	}
+	if start > len(merged) {
+		start = len(merged)
+	}
+	end := len(merged)
+	if q.Limit > 0 && start+q.Limit < end {
+		end = start + q.Limit
+	}
+
+	trxs := make([]*Transaction, 0, end-start)
+	for _, tx := range merged[start:end] {
+		trxs = append(trxs, tx.trx)
+	}
+	return trxs
+}
+
+//searchAddressTransactions 按条件分页查询地址相关的转账交易单
+func (c *Client) searchAddressTransactions(q AddressTxQuery) ([]*Transaction, error) {
+	return c.searchAddressTransactionsContext(context.Background(), q)
+}
+
+func (c *Client) searchAddressTransactionsContext(ctx context.Context, q AddressTxQuery) ([]*Transaction, error) {
+
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+
+	sources := make([][]searchedTx, 0, len(q.Addresses)*2)
+	for _, addr := range q.Addresses {
+		for _, tag := range []string{tagSender, tagRecipient} {
+			txs, err := c.txSearchContext(ctx, txSearchQuery(tag, addr, q), q)
+			if err != nil {
+				return nil, err
+			}
+			sources = append(sources, txs)
+		}
+	}
+
+	return mergeAddressTxs(q, sources...), nil
+}
+
+//txSearchQuery 按标签和高度范围生成tx_search查询语句
+func txSearchQuery(tag, address string, q AddressTxQuery) string {
+	conditions := []string{fmt.Sprintf("%s='%s'", tag, address)}
+	if q.MinHeight > 0 {
+		conditions = append(conditions, fmt.Sprintf("tx.height>=%d", q.MinHeight))
+	}
+	if q.MaxHeight > 0 {
+		conditions = append(conditions, fmt.Sprintf("tx.height<=%d", q.MaxHeight))
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+//txSearchContext 按q的顺序逐页查询，直到找到q.want()个符合条件的交易单或查完全部结果。
+//tx_search按高度从旧到新返回，从新到旧时从最后一页开始查询
+func (c *Client) txSearchContext(ctx context.Context, query string, q AddressTxQuery) ([]searchedTx, error) {
+
+	want := q.want()
+	found := make([]searchedTx, 0)
+	collect := func(txs []searchedTx) bool {
+		for _, tx := range txs {
+			if !q.match(tx.trx) {
+				continue
+			}
+			found = append(found, tx)
+			if want > 0 && len(found) >= want {
+				return true
+			}
+		}
+		return false
+	}
+
+	first, total, err := c.txSearchPageContext(ctx, query, 1)
+	if err != nil {
+		return nil, err
+	}
+	pages := int((total + txSearchPageSize - 1) / txSearchPageSize)
+
+	if q.Ascending {
+		if collect(first) {
+			return found, nil
+		}
+		for page := 2; page <= pages; page++ {
+			txs, _, err := c.txSearchPageContext(ctx, query, page)
+			if err != nil {
+				return nil, err
+			}
+			if collect(txs) {
+				break
+			}
+		}
+		return found, nil
+	}
+
+	for page := pages; page >= 1; page-- {
+		txs := first
+		if page > 1 {
+			txs, _, err = c.txSearchPageContext(ctx, query, page)
+			if err != nil {
+				return nil, err
+			}
+		}
+		reversed := make([]searchedTx, 0, len(txs))
+		for i := len(txs) - 1; i >= 0; i-- {
+			reversed = append(reversed, txs[i])
+		}
+		if collect(reversed) {
+			break
+		}
+	}
+
+	return found, nil
+}
+
+//txSearchPageContext 查询tx_search的一页，返回该页交易单和结果总数，非转账交易不返回
+func (c *Client) txSearchPageContext(ctx context.Context, query string, page int) ([]searchedTx, uint64, error) {
+
+	/*
+		{
+			"jsonrpc": "2.0",
+			"id": "",
+			"result": {
+				"txs": [
+					{
+						"hash": "AB12...",
+						"height": "12345",
+						"index": 0,
+						"tx_result": {"code": 0, "log": "Msg 0: "},
+						"tx": "..."
+					}
+				],
+				"total_count": "1"
+			}
+		}
+	*/
+
+	path := fmt.Sprintf("/tx_search?query=%s&page=%d&per_page=%d&prove=false",
+		url.QueryEscape(`"`+query+`"`), page, txSearchPageSize)
+
+	resp, err := c.CallContext(ctx, path, nil, "GET")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	result := resp.Get("result")
+	txs := make([]searchedTx, 0)
+	for _, item := range result.Get("txs").Array() {
+		trx := NewTransaction(&item, c.AddressPrefix)
+		if trx == nil {
+			continue
+		}
+		//交易单内容必须与hash一致，防止节点返回伪造的交易单
+		txBytes, _ := base64.StdEncoding.DecodeString(item.Get("tx").String())
+		if !strings.EqualFold(txHash(txBytes), trx.TxID) {
+			return nil, 0, &RPCError{Kind: ErrBlockUnverified, Message: "transaction content doesn't match hash " + trx.TxID}
+		}
+		trx.TxID = strings.ToUpper(trx.TxID)
+		txs = append(txs, searchedTx{trx: trx, index: item.Get("index").Int()})
+	}
+
+	return txs, result.Get("total_count").Uint(), nil
+}
@@ -0,0 +1,113 @@
+package binancechain
+
+import (
+	"testing"
+
+	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/blocktree/binance-chain-adapter/binancechaintest"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/tendermint/tendermint/crypto"
+	"github.com/tendermint/tendermint/crypto/secp256k1"
+)
+
+func Test_searchAddressTransactions(t *testing.T) {
+	node := binancechaintest.NewNode("")
+	defer node.Close()
+
+	sender := secp256k1.GenPrivKey()
+	customer := secp256k1.GenPrivKey()
+	senderAddr := types.AccAddress(sender.PubKey().Address())
+	customerAddr := types.AccAddress(customer.PubKey().Address())
+	node.Mint(senderAddr.String(), types.Coins{{Denom: "BNB", Amount: 100000000000}, {Denom: "XYZ-000", Amount: 1000}})
+	node.Mint(customerAddr.String(), types.Coins{{Denom: "BNB", Amount: 100000000}})
+	node.ProduceBlock()
+
+	sequences := map[string]int64{}
+	send := func(key crypto.PrivKey, to types.AccAddress, denom string, amount int64) {
+		from := types.AccAddress(key.PubKey().Address()).String()
+		acc := node.Account(from)
+		txBytes, _ := binancechaintest.NewSendTx(key, node.ChainID(), acc.AccountNumber, sequences[from], to, types.Coins{{Denom: denom, Amount: amount}}, "")
+		if code, log, _ := node.Submit(txBytes); code != binancechaintest.CodeOK {
+			t.Fatalf("submit failed: [%d]%s", code, log)
+		}
+		sequences[from]++
+	}
+
+	//120笔BNB充值分布在12个区块，之后是5笔XYZ-000充值和3笔提现
+	for i := 0; i < 120; i++ {
+		send(sender, customerAddr, "BNB", int64(i+1))
+		if i%10 == 9 {
+			node.ProduceBlock()
+		}
+	}
+	for i := 0; i < 5; i++ {
+		send(sender, customerAddr, "XYZ-000", 10)
+	}
+	for i := 0; i < 3; i++ {
+		send(customer, senderAddr, "BNB", 1)
+	}
+	node.ProduceBlock()
+	latest := uint64(node.Height())
+
+	c := NewClient(node.URL(), false)
+	c.SetRetry(0, 0)
+
+	//从新到旧逐页查询全部记录
+	seen := map[string]bool{}
+	var last *Transaction
+	for offset := 0; ; offset += 50 {
+		trxs, err := c.searchAddressTransactions(AddressTxQuery{Addresses: []string{customerAddr.String()}, Offset: offset, Limit: 50})
+		if err != nil {
+			t.Fatalf("search failed unexpected error: %v", err)
+		}
+		for _, trx := range trxs {
+			if seen[trx.TxID] {
+				t.Fatalf("transaction [%s] returned twice", trx.TxID)
+			}
+			seen[trx.TxID] = true
+			if last != nil && trx.BlockHeight > last.BlockHeight {
+				t.Fatalf("transactions are not ordered from new to old: %d after %d", trx.BlockHeight, last.BlockHeight)
+			}
+			last = trx
+		}
+		if len(trxs) < 50 {
+			break
+		}
+	}
+	if len(seen) != 128 {
+		t.Errorf("paged %d transactions, expected 128", len(seen))
+	}
+
+	newest, err := c.getMultiAddrTransactions(0, 1, customerAddr.String())
+	if err != nil || len(newest) != 1 || newest[0].BlockHeight != latest {
+		t.Errorf("unexpected newest transaction: %v, %v", newest, err)
+	}
+
+	//两个地址之间的转账只返回一次
+	both, err := c.searchAddressTransactions(AddressTxQuery{Addresses: []string{senderAddr.String(), customerAddr.String()}})
+	if err != nil || len(both) != 128 {
+		t.Errorf("expected 128 transactions of both addresses, got %d, %v", len(both), err)
+	}
+
+	tokens, err := c.searchAddressTransactions(AddressTxQuery{Addresses: []string{customerAddr.String()}, Denom: "XYZ-000"})
+	if err != nil || len(tokens) != 5 {
+		t.Errorf("expected 5 XYZ-000 transactions, got %d, %v", len(tokens), err)
+	}
+
+	//高度范围内从旧到新
+	bounded, err := c.searchAddressTransactions(AddressTxQuery{Addresses: []string{customerAddr.String()}, MinHeight: 3, MaxHeight: 4, Ascending: true, Offset: 5, Limit: 10})
+	if err != nil || len(bounded) != 10 {
+		t.Fatalf("expected 10 bounded transactions, got %d, %v", len(bounded), err)
+	}
+	if bounded[0].BlockHeight != 3 || bounded[0].TxDetails["BNB"].To[0].Amount != 16 || bounded[9].BlockHeight != 4 {
+		t.Errorf("unexpected bounded transactions: first at %d of %d, last at %d", bounded[0].BlockHeight, bounded[0].TxDetails["BNB"].To[0].Amount, bounded[9].BlockHeight)
+	}
+
+	wm := NewWalletManager()
+	wm.RpcClient = c
+	coin := openwallet.Coin{Symbol: Symbol, IsContract: true, Contract: openwallet.SmartContract{Address: "XYZ-000"}}
+	extracted, err := wm.Blockscanner.GetTransactionsByAddress(0, 3, coin, customerAddr.String())
+	if err != nil || len(extracted) != 3 {
+		t.Errorf("expected 3 extracted XYZ-000 transactions, got %d, %v", len(extracted), err)
+	}
+}
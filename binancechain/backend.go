@@ -0,0 +1,169 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package binancechain
+
+import (
+	"context"
+
+	"github.com/binance-chain/go-sdk/common/types"
+)
+
+//ChainBackend 链上数据源，区块扫描、交易单构建和广播都通过它访问链上数据。
+//Client实现了Tendermint RPC数据源，DexClient实现了Binance DEX HTTP API数据源，
+//可以在LoadAssetsConfig之后用包装了Client的缓存或多数据源实现替换WalletManager.RpcClient
+type ChainBackend interface {
+	//GetNodeStatus 节点状态
+	GetNodeStatus(ctx context.Context) (*NodeStatus, error)
+	//GetBlockHeight 最新区块高度
+	GetBlockHeight(ctx context.Context) (uint64, error)
+	//GetBlockHash 指定高度的区块hash，数据源不提供时返回空
+	GetBlockHash(ctx context.Context, height uint64) (string, error)
+	//GetBlockByHeight 指定高度的区块及其交易单ID
+	GetBlockByHeight(ctx context.Context, height uint64) (*Block, error)
+	//GetTransaction 已上链的交易单，非转账交易返回nil，交易单不存在时返回ErrTxNotFound
+	GetTransaction(ctx context.Context, txid string) (*Transaction, error)
+	//GetTxStatus 交易单的DeliverTx结果，交易单不存在时返回ErrTxNotFound
+	GetTxStatus(ctx context.Context, txid string) (TxStatus, error)
+	//GetAccount 最新的账户信息，账户不存在时返回没有余额的账户
+	GetAccount(ctx context.Context, address string) (*AccountInfo, error)
+	//GetFeeSchedule 指定高度的手续费表，height为0时获取最新
+	GetFeeSchedule(ctx context.Context, height uint64) (*FeeSchedule, error)
+	//BroadcastTransaction 广播hex编码的交易单，CheckTx通过后返回交易单ID
+	BroadcastTransaction(ctx context.Context, txHex string) (string, error)
+}
+
+//AccountBatchBackend 支持批量查询账户的数据源，不支持时逐个查询
+type AccountBatchBackend interface {
+	//GetAccounts 查询多个地址的账户信息，按输入顺序返回
+	GetAccounts(ctx context.Context, addresses []string) ([]*AccountInfo, error)
+}
+
+//AccountSequenceBackend 支持不经缓存查询账户序号的数据源，不支持时使用GetAccount
+type AccountSequenceBackend interface {
+	//GetAccountSequence 签名使用的最新账户编号和序号，账户不存在时返回错误
+	GetAccountSequence(ctx context.Context, address string) (int64, int64, error)
+}
+
+//MemPoolBackend 支持查询内存池的数据源，不支持时无法扫描内存池
+type MemPoolBackend interface {
+	//GetUnconfirmedTxs 内存池中的交易单ID，complete为false表示只返回了一部分
+	GetUnconfirmedTxs(ctx context.Context) ([]string, bool, error)
+	//GetMemPoolTransaction 内存池中的交易单，非转账交易返回nil
+	GetMemPoolTransaction(ctx context.Context, txid string) (*Transaction, error)
+}
+
+//AddressHistoryBackend 支持查询地址交易记录的数据源
+type AddressHistoryBackend interface {
+	//GetAddressTransactions 按条件分页查询地址相关的转账交易单
+	GetAddressTransactions(ctx context.Context, query AddressTxQuery) ([]*Transaction, error)
+}
+
+//TokenBackend 支持查询代币信息的数据源，不支持时代币名称使用代币符号
+type TokenBackend interface {
+	//GetToken 单个代币信息，代币不存在时返回ErrTokenNotFound
+	GetToken(ctx context.Context, symbol string) (*types.Token, error)
+	//GetTokens 分页查询代币信息
+	GetTokens(ctx context.Context, offset, limit int) ([]types.Token, error)
+}
+
+var (
+	_ ChainBackend           = (*Client)(nil)
+	_ AccountBatchBackend    = (*Client)(nil)
+	_ AccountSequenceBackend = (*Client)(nil)
+	_ MemPoolBackend         = (*Client)(nil)
+	_ AddressHistoryBackend  = (*Client)(nil)
+	_ TokenBackend           = (*Client)(nil)
+
+	_ ChainBackend           = (*DexClient)(nil)
+	_ AccountBatchBackend    = (*DexClient)(nil)
+	_ AccountSequenceBackend = (*DexClient)(nil)
+	_ AddressHistoryBackend  = (*DexClient)(nil)
+	_ TokenBackend           = (*DexClient)(nil)
+)
+
+func (c *Client) GetNodeStatus(ctx context.Context) (*NodeStatus, error) {
+	return c.getNodeStatusContext(ctx)
+}
+
+func (c *Client) GetBlockHeight(ctx context.Context) (uint64, error) {
+	return c.getBlockHeightContext(ctx)
+}
+
+func (c *Client) GetBlockHash(ctx context.Context, height uint64) (string, error) {
+	return c.getBlockHashContext(ctx, height)
+}
+
+func (c *Client) GetBlockByHeight(ctx context.Context, height uint64) (*Block, error) {
+	return c.getBlockByHeightContext(ctx, height)
+}
+
+func (c *Client) GetTransaction(ctx context.Context, txid string) (*Transaction, error) {
+	return c.getTransactionContext(ctx, txid)
+}
+
+func (c *Client) GetTxStatus(ctx context.Context, txid string) (TxStatus, error) {
+	return c.getTxStatusContext(ctx, txid)
+}
+
+func (c *Client) GetAccount(ctx context.Context, address string) (*AccountInfo, error) {
+	return c.getAccountInfoContext(ctx, address)
+}
+
+func (c *Client) GetAccounts(ctx context.Context, addresses []string) ([]*AccountInfo, error) {
+	return c.getAccountInfosContext(ctx, addresses)
+}
+
+func (c *Client) GetAccountSequence(ctx context.Context, address string) (int64, int64, error) {
+	return c.getAccountNumberAndSequenceContext(ctx, address)
+}
+
+func (c *Client) GetFeeSchedule(ctx context.Context, height uint64) (*FeeSchedule, error) {
+	return c.getFeeScheduleContext(ctx, height)
+}
+
+func (c *Client) BroadcastTransaction(ctx context.Context, txHex string) (string, error) {
+	return c.sendTransactionContext(ctx, txHex)
+}
+
+func (c *Client) GetUnconfirmedTxs(ctx context.Context) ([]string, bool, error) {
+	return c.getUnconfirmedTxsContext(ctx)
+}
+
+func (c *Client) GetMemPoolTransaction(ctx context.Context, txid string) (*Transaction, error) {
+	return c.getMemPoolTransaction(txid)
+}
+
+func (c *Client) GetAddressTransactions(ctx context.Context, query AddressTxQuery) ([]*Transaction, error) {
+	return c.searchAddressTransactionsContext(ctx, query)
+}
+
+func (c *Client) GetToken(ctx context.Context, symbol string) (*types.Token, error) {
+	return c.getTokenContext(ctx, symbol)
+}
+
+func (c *Client) GetTokens(ctx context.Context, offset, limit int) ([]types.Token, error) {
+	return c.getTokensContext(ctx, offset, limit)
+}
+
+//tendermintClient 数据源是Tendermint RPC的Client时返回该Client，否则返回nil，
+//轻客户端验证和websocket订阅只能使用Tendermint RPC节点
+func (wm *WalletManager) tendermintClient() *Client {
+	c, ok := wm.RpcClient.(*Client)
+	if !ok || c == nil {
+		return nil
+	}
+	return c
+}
@@ -0,0 +1,130 @@
+package binancechain
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+//stubBackend 只提供账户查询的数据源
+type stubBackend struct {
+	accounts map[string]*AccountInfo
+}
+
+func (b *stubBackend) GetNodeStatus(ctx context.Context) (*NodeStatus, error) {
+	return &NodeStatus{Network: "Binance-Chain-Tigris", LatestBlockHeight: 100}, nil
+}
+
+func (b *stubBackend) GetBlockHeight(ctx context.Context) (uint64, error) {
+	return 100, nil
+}
+
+func (b *stubBackend) GetBlockHash(ctx context.Context, height uint64) (string, error) {
+	return "", nil
+}
+
+func (b *stubBackend) GetBlockByHeight(ctx context.Context, height uint64) (*Block, error) {
+	return &Block{Height: height}, nil
+}
+
+func (b *stubBackend) GetTransaction(ctx context.Context, txid string) (*Transaction, error) {
+	return nil, &RPCError{Kind: ErrTxNotFound, Message: txid}
+}
+
+func (b *stubBackend) GetTxStatus(ctx context.Context, txid string) (TxStatus, error) {
+	return TxStatus{}, &RPCError{Kind: ErrTxNotFound, Message: txid}
+}
+
+func (b *stubBackend) GetAccount(ctx context.Context, address string) (*AccountInfo, error) {
+	if info, exist := b.accounts[address]; exist {
+		return info, nil
+	}
+	return &AccountInfo{Address: address}, nil
+}
+
+func (b *stubBackend) GetFeeSchedule(ctx context.Context, height uint64) (*FeeSchedule, error) {
+	return &FeeSchedule{Height: height, Transfer: TransferFee{Fee: 37500}}, nil
+}
+
+func (b *stubBackend) BroadcastTransaction(ctx context.Context, txHex string) (string, error) {
+	return "", &RPCError{Kind: ErrCheckTxFailed, Message: "read only"}
+}
+
+func Test_chainBackend(t *testing.T) {
+	wm := NewWalletManager()
+	wm.RpcClient = &stubBackend{accounts: map[string]*AccountInfo{
+		"bnb1a": {Address: "bnb1a", AccountNumber: 7, Sequence: 2, Coins: []AccountCoin{{Denom: "BNB", Free: 150000000}}},
+	}}
+
+	balances, err := wm.Blockscanner.GetBalanceByAddress("bnb1a", "bnb1b")
+	if err != nil {
+		t.Fatalf("get balance failed unexpected error: %v", err)
+	}
+	if len(balances) != 2 || balances[0].Balance != "1.5" || balances[1].Balance != "0" {
+		t.Errorf("unexpected balances: %+v, %+v", balances[0], balances[1])
+	}
+
+	if number, sequence, err := wm.getAccountNumberAndSequence("bnb1a"); err != nil || number != 7 || sequence != 2 {
+		t.Errorf("unexpected account number and sequence: %d, %d, %v", number, sequence, err)
+	}
+	if _, _, err := wm.getAccountNumberAndSequence("bnb1b"); err == nil {
+		t.Errorf("empty account should not be signed")
+	}
+
+	if fee, err := wm.getTransferFee(); err != nil || fee != 37500 {
+		t.Errorf("unexpected transfer fee: %d, %v", fee, err)
+	}
+
+	//数据源不支持的功能返回错误
+	if _, err := wm.GetTxIDsInMemPool(); err == nil {
+		t.Errorf("mempool should not be supported by the stub backend")
+	}
+	if wm.tendermintClient() != nil {
+		t.Errorf("stub backend is not a Tendermint client")
+	}
+}
+
+func Test_scanBlocksWithoutHash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "binancechain")
+	if err != nil {
+		t.Fatalf("create temp dir failed unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	wm := NewWalletManager()
+	wm.Config.dbPath = dir
+	wm.RpcClient = &stubBackend{}
+
+	bs := wm.Blockscanner
+	bs.Scanning = true
+	bs.RescanLastBlockCount = 0
+	observer := &scanObserver{}
+	bs.AddObserver(observer)
+
+	//切换到不提供区块hash的数据源前保存的扫描高度
+	wm.SaveLocalNewBlock(95, "A1D4B2F8")
+
+	bs.ScanBlockTask()
+
+	//新区块通知是异步发送的
+	headers := make([]*openwallet.BlockHeader, 0)
+	for deadline := time.Now().Add(time.Second); len(headers) < 5 && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		received, _ := observer.take()
+		headers = append(headers, received...)
+	}
+	if len(headers) != 5 {
+		t.Fatalf("expected 5 new block notifications, got %d", len(headers))
+	}
+	for _, header := range headers {
+		if header.Fork {
+			t.Errorf("blocks without hash should not be forked: %+v", header)
+		}
+	}
+	if header, _ := bs.GetScannedBlockHeader(); header.Height != 100 {
+		t.Errorf("scanned height = %d, expected 100", header.Height)
+	}
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package binancechain
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/blocktree/openwallet/log"
+)
+
+const (
+	defaultBatchWorkers = 10 //默认批量查询的并发数
+)
+
+//SetBatch 设置批量查询的并发数和每秒请求数上限，rateLimit为0时不限速
+func (c *Client) SetBatch(workers, rateLimit int) {
+	if workers > 0 {
+		c.BatchWorkers = workers
+	}
+	if rateLimit >= 0 {
+		c.BatchRateLimit = rateLimit
+	}
+}
+
+//getAccountInfos 并发查询多个地址的账户信息，按输入顺序返回，任一地址失败时中止并返回错误
+func (c *Client) getAccountInfos(addresses []string) ([]*AccountInfo, error) {
+	return c.getAccountInfosContext(context.Background(), addresses)
+}
+
+func (c *Client) getAccountInfosContext(ctx context.Context, addresses []string) ([]*AccountInfo, error) {
+	return c.batchAccountInfosContext(ctx, addresses, c.getAccountInfoContext)
+}
+
+//batchAccountInfosContext 按批量查询的并发数和限速用query查询多个地址
+func (c *Client) batchAccountInfosContext(ctx context.Context, addresses []string, query func(ctx context.Context, address string) (*AccountInfo, error)) ([]*AccountInfo, error) {
+
+	var (
+		results  = make([]*AccountInfo, len(addresses))
+		jobs     = make(chan int)
+		limiter  <-chan time.Time
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+
+	if len(addresses) == 0 {
+		return results, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := c.BatchWorkers
+	if workers <= 0 {
+		workers = defaultBatchWorkers
+	}
+	if workers > len(addresses) {
+		workers = len(addresses)
+	}
+
+	//所有工作线程共用一个限速器
+	if c.BatchRateLimit > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(c.BatchRateLimit))
+		defer ticker.Stop()
+		limiter = ticker.C
+	}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if limiter != nil {
+					select {
+					case <-limiter:
+					case <-ctx.Done():
+						continue
+					}
+				}
+
+				info, err := query(ctx, addresses[i])
+				if err != nil {
+					errOnce.Do(func() {
+						log.Std.Error("batch query account of address [%s] failed; unexpected error: %v", addresses[i], err)
+						firstErr = err
+						cancel()
+					})
+					continue
+				}
+				results[i] = info
+			}
+		}()
+	}
+
+feed:
+	for i := range addresses {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
@@ -15,9 +15,13 @@
 package binancechain
 
 import (
+	"context"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/astaxie/beego/config"
 	"github.com/blocktree/openwallet/log"
@@ -618,10 +622,188 @@ func (wm *WalletManager) GetAddressWithBalance(address ...*openwallet.Address) e
 //LoadAssetsConfig 加载外部配置
 func (wm *WalletManager) LoadAssetsConfig(c config.Configer) error {
 	wm.Config.IsTestNet, _ = c.Bool("isTestNet")
-
-	wm.Config.RpcAPI = c.String("rpcAPI")
-
-	wm.RpcClient = NewClient(wm.Config.RpcAPI, false)
+	wm.Config.ChainID = strings.TrimSpace(c.String("chainID"))
+	if cycle, err := time.ParseDuration(c.String("networkCheckCycle")); err == nil && cycle > 0 {
+		wm.Config.NetworkCheckInterval = cycle
+	}
+
+	wm.Config.RpcAPIs = make([]string, 0)
+	for _, api := range c.Strings("rpcAPI") {
+		api = strings.TrimSpace(api)
+		if len(api) > 0 {
+			wm.Config.RpcAPIs = append(wm.Config.RpcAPIs, api)
+		}
+	}
+	if len(wm.Config.RpcAPIs) > 0 {
+		wm.Config.RpcAPI = wm.Config.RpcAPIs[0]
+	}
+
+	wm.Config.RpcUser = c.String("rpcUser")
+	wm.Config.RpcPassword = c.String("rpcPassword")
+	wm.Config.RpcBearerToken = strings.TrimSpace(c.String("rpcBearerToken"))
+	if dir := strings.TrimSpace(c.String("certsDir")); len(dir) > 0 {
+		wm.Config.CertsDir = dir
+	}
+	wm.Config.RpcCAFile = strings.TrimSpace(c.String("rpcCAFile"))
+	wm.Config.RpcCertFile = strings.TrimSpace(c.String("rpcCertFile"))
+	wm.Config.RpcKeyFile = strings.TrimSpace(c.String("rpcKeyFile"))
+	wm.Config.RpcProxy = strings.TrimSpace(c.String("rpcProxy"))
+
+	if serverType, err := c.Int("rpcServerType"); err == nil {
+		wm.Config.RpcServerType = serverType
+	}
+	wm.Config.ServerAPIs = make([]string, 0)
+	for _, api := range c.Strings("serverAPI") {
+		api = strings.TrimSpace(api)
+		if len(api) > 0 {
+			wm.Config.ServerAPIs = append(wm.Config.ServerAPIs, api)
+		}
+	}
+
+	if cycle, err := time.ParseDuration(c.String("nodeHealthCheckCycle")); err == nil {
+		wm.Config.HealthCheckInterval = cycle
+	}
+	if lag, err := c.Int64("nodeMaxHeightLag"); err == nil && lag >= 0 {
+		wm.Config.MaxHeightLag = uint64(lag)
+	}
+
+	if count, err := c.Int("rpcRetryCount"); err == nil && count >= 0 {
+		wm.Config.RpcRetryCount = count
+	}
+	if backoff, err := time.ParseDuration(c.String("rpcRetryBackoff")); err == nil {
+		wm.Config.RpcRetryBackoff = backoff
+	}
+	if timeout, err := time.ParseDuration(c.String("rpcTimeout")); err == nil {
+		wm.Config.RpcTimeout = timeout
+	}
+	if ttl, err := time.ParseDuration(c.String("accountCacheTTL")); err == nil {
+		wm.Config.AccountCacheTTL = ttl
+	}
+	if verify, err := c.Bool("verifyQueryProof"); err == nil {
+		wm.Config.VerifyQueryProof = verify
+	}
+	if verify, err := c.Bool("verifyBlockCommit"); err == nil {
+		wm.Config.VerifyBlockCommit = verify
+	}
+	wm.Config.TrustedValidatorsHash = strings.TrimSpace(c.String("trustedValidatorsHash"))
+	if ttl, err := time.ParseDuration(c.String("feeCacheTTL")); err == nil {
+		wm.Config.FeeCacheTTL = ttl
+	}
+	if workers, err := c.Int("balanceQueryWorkers"); err == nil && workers > 0 {
+		wm.Config.BalanceQueryWorkers = workers
+	}
+	if rateLimit, err := c.Int("balanceQueryRateLimit"); err == nil && rateLimit >= 0 {
+		wm.Config.BalanceQueryRateLimit = rateLimit
+	}
+	if enable, err := c.Bool("enableWebsocket"); err == nil {
+		wm.Config.EnableWebsocket = enable
+	}
+	if cycle, err := time.ParseDuration(c.String("websocketReconnectCycle")); err == nil {
+		wm.Config.WebsocketReconnectInterval = cycle
+	}
+	if cycle, err := time.ParseDuration(c.String("txTrackCycle")); err == nil && cycle > 0 {
+		wm.Config.TxTrackInterval = cycle
+	}
+	if timeout, err := time.ParseDuration(c.String("txTrackTimeout")); err == nil && timeout > 0 {
+		wm.Config.TxTrackTimeout = timeout
+	}
+	if scan, err := c.Bool("scanMemPool"); err == nil {
+		wm.Config.ScanMemPool = scan
+	}
+	if cycle, err := time.ParseDuration(c.String("memPoolScanCycle")); err == nil && cycle > 0 {
+		wm.Config.MemPoolScanInterval = cycle
+	}
+	if age, err := time.ParseDuration(c.String("maxBlockAge")); err == nil && age >= 0 {
+		wm.Config.MaxBlockAge = age
+	}
+	if gap, err := c.Int("recoveryGapLimit"); err == nil && gap > 0 {
+		wm.Config.RecoveryGapLimit = gap
+	}
+
+	var (
+		client  *Client
+		backend ChainBackend
+	)
+	switch wm.Config.RpcServerType {
+	case RpcServerTendermint:
+		client = NewMultiNodeClient(wm.Config.RpcAPIs, false)
+		backend = client
+	case RpcServerDex:
+		if wm.Config.VerifyQueryProof || wm.Config.VerifyBlockCommit {
+			return fmt.Errorf("verifyQueryProof and verifyBlockCommit need Tendermint RPC nodes, rpcServerType must be %d", RpcServerTendermint)
+		}
+		//HTTP API没有websocket和内存池接口
+		wm.Config.EnableWebsocket = false
+		wm.Config.ScanMemPool = false
+		dex := NewDexClient(wm.Config.ServerAPIs, false)
+		client = dex.Client
+		backend = dex
+	default:
+		return fmt.Errorf("unknown rpcServerType: %d", wm.Config.RpcServerType)
+	}
+	client.SetHealthCheck(wm.Config.HealthCheckInterval, wm.Config.MaxHeightLag)
+	client.SetRetry(wm.Config.RpcRetryCount, wm.Config.RpcRetryBackoff)
+	client.SetTimeout(wm.Config.RpcTimeout)
+	client.SetAccountCacheTTL(wm.Config.AccountCacheTTL)
+	client.SetVerifyProof(wm.Config.VerifyQueryProof)
+	client.SetFeeCacheTTL(wm.Config.FeeCacheTTL)
+	client.SetBatch(wm.Config.BalanceQueryWorkers, wm.Config.BalanceQueryRateLimit)
+	client.AddressPrefix = wm.addressPrefix()
+	wm.Tokens.Prefix = wm.addressPrefix()
+	if err := client.SetTransport(wm.Config.TransportOptions()); err != nil {
+		return err
+	}
+	wm.RpcClient = backend
+
+	var network *NetworkChecker
+	if wm.Network != nil {
+		network = wm.Network
+		network.IsTestNet = wm.Config.IsTestNet
+		network.ChainID = wm.Config.ChainID
+		network.Interval = wm.Config.NetworkCheckInterval
+		if err := network.validate(); err != nil {
+			return err
+		}
+		//健康检查时优先使用链ID正确的节点
+		client.SetNetworkCheck(network.match)
+	}
+
+	//带证明的查询只信任轻客户端验证过的区块头中的app hash
+	if wm.LightClient != nil && (wm.Config.VerifyQueryProof || wm.Config.VerifyBlockCommit) {
+		//不信任节点首次返回的验证人集合
+		if len(wm.Config.TrustedValidatorsHash) == 0 {
+			return fmt.Errorf("trustedValidatorsHash is required by verifyQueryProof and verifyBlockCommit")
+		}
+		trusted, err := hex.DecodeString(wm.Config.TrustedValidatorsHash)
+		if err != nil {
+			return fmt.Errorf("invalid trustedValidatorsHash: %v", err)
+		}
+		wm.LightClient.TrustedValidatorsHash = trusted
+		if network != nil {
+			wm.LightClient.ChainID = network.ExpectedChainID()
+		}
+		client.SetLightClient(wm.LightClient)
+	}
+
+	if wm.Blockscanner != nil {
+		wm.Blockscanner.IsScanMemPool = wm.Config.ScanMemPool
+		wm.Blockscanner.MaxBlockAge = wm.Config.MaxBlockAge
+	}
+
+	if wm.TxTracker != nil {
+		wm.TxTracker.PollInterval = wm.Config.TxTrackInterval
+		wm.TxTracker.Timeout = wm.Config.TxTrackTimeout
+	}
+
+	//启动时检查节点所在网络，节点暂时无法访问时在扫描和签名前再检查
+	if network != nil {
+		if err := network.Check(context.Background()); err != nil {
+			if ErrorKind(err) == ErrNetworkMismatch {
+				return err
+			}
+			wm.Log.Std.Warning("can not check the node's network; unexpected error: %v", err)
+		}
+	}
 
 	wm.Config.DataDir = c.String("dataDir")
 
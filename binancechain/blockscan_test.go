@@ -306,3 +306,20 @@ func Test_GetTransaction(t *testing.T) {
 // 	}
 // 	fmt.Println(string(txid))
 // }
+
+func TestBNBBlockScanner_BatchExtractTransactionCanceled(t *testing.T) {
+	bs := NewBNBBlockScanner(&WalletManager{})
+
+	//停止扫描后，未开始的交易单不再请求节点，也不记录未扫记录
+	bs.Stop()
+	err := bs.BatchExtractTransaction(100, "", []string{"tx1", "tx2", "tx3"}, false)
+	if err == nil {
+		t.Errorf("expected extraction of a stopped scanner to fail")
+	}
+
+	//重新运行后使用新的扫描上下文
+	bs.resetScanContext()
+	if bs.scanContext().Err() != nil {
+		t.Errorf("expected a fresh scan context after reset")
+	}
+}
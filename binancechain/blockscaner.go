@@ -16,38 +16,55 @@
 package binancechain
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"net/url"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/asdine/storm"
-	"github.com/blocktree/openwallet/common"
 	"github.com/blocktree/openwallet/openwallet"
-	gosocketio "github.com/graarh/golang-socketio"
-	"github.com/graarh/golang-socketio/transport"
 	"github.com/shopspring/decimal"
 )
 
 const (
-	blockchainBucket  = "blockchain" //区块链数据集合
-	maxExtractingSize = 20           //并发的扫描线程数
+	blockchainBucket  = "blockchain"     //区块链数据集合
+	maxExtractingSize = 20               //并发的扫描线程数
+	wsStaleInterval   = 30 * time.Second //超过该时间没有收到websocket事件则恢复轮询
 )
 
 //BNBBlockScanner bnb的区块链扫描器
 type BNBBlockScanner struct {
 	*openwallet.BlockScannerBase
 
-	CurrentBlockHeight   uint64             //当前区块高度
-	extractingCH         chan struct{}      //扫描工作令牌
-	wm                   *WalletManager     //钱包管理者
-	IsScanMemPool        bool               //是否扫描交易池
-	RescanLastBlockCount uint64             //重扫上N个区块数量
-	socketIO             *gosocketio.Client //socketIO客户端
+	CurrentBlockHeight   uint64         //当前区块高度
+	extractingCH         chan struct{}  //扫描工作令牌
+	wm                   *WalletManager //钱包管理者
+	IsScanMemPool        bool           //是否扫描交易池
+	RescanLastBlockCount uint64         //重扫上N个区块数量
 	RPCServer            int
+	ctxMu                sync.Mutex
+	scanCtx              context.Context    //扫描上下文，停止或暂停时取消
+	scanCancel           context.CancelFunc //取消正在进行的扫描
+	scanMu               sync.Mutex         //同一时间只允许一个扫描任务
+	wsMu                 sync.Mutex
+	ws                   *wsSubscriber   //Tendermint websocket订阅客户端
+	wsCtx                context.Context //websocket所属的扫描上下文
+	wsLastEvent          time.Time       //最近一次收到websocket事件的时间
+	newHeightCH          chan uint64     //websocket新高度通知
+	memPoolMu            sync.Mutex      //同一时间只允许一个内存池扫描
+	memPool              *memPoolTracker //已通知的内存池交易单
+	memPoolCtx           context.Context //内存池扫描所属的扫描上下文
+
+	MaxBlockAge time.Duration             //节点最新区块的最大时间差，超过时暂停扫描，0为不检查
+	OnStalled   func(state NodeSyncState) //节点同步中或停止出块而暂停扫描时调用，用于告警
+	OnResumed   func(state NodeSyncState) //节点恢复同步、继续扫描时调用
+	syncMu      sync.Mutex
+	syncState   NodeSyncState //最近一次检查到的节点同步状态
 }
 
 //ExtractResult 扫描完成的提取结果
@@ -56,6 +73,7 @@ type ExtractResult struct {
 	TxID        string
 	BlockHeight uint64
 	Success     bool
+	err         error //提取失败的原因
 }
 
 //SaveResult 保存结果
@@ -72,12 +90,16 @@ func NewBNBBlockScanner(wm *WalletManager) *BNBBlockScanner {
 	}
 
 	bs.extractingCH = make(chan struct{}, maxExtractingSize)
+	bs.newHeightCH = make(chan uint64, 1)
 	bs.wm = wm
 	bs.IsScanMemPool = false
+	bs.memPool = newMemPoolTracker()
 	bs.RescanLastBlockCount = 1
+	bs.MaxBlockAge = defaultMaxBlockAge
+	bs.resetScanContext()
 
 	//设置扫描任务
-	bs.SetTask(bs.ScanBlockTask)
+	bs.SetTask(bs.pollBlockTask)
 
 	return &bs
 }
@@ -102,6 +124,17 @@ func (bs *BNBBlockScanner) SetRescanBlockHeight(height uint64) error {
 //ScanBlockTask 扫描任务
 func (bs *BNBBlockScanner) ScanBlockTask() {
 
+	bs.scanMu.Lock()
+	defer bs.scanMu.Unlock()
+
+	ctx := bs.scanContext()
+
+	//节点所在网络与配置不一致时不扫描
+	if err := bs.wm.verifyNetwork(ctx); err != nil {
+		bs.wm.Log.Std.Error("block scanner refuses to scan; unexpected error: %v", err)
+		return
+	}
+
 	//获取本地区块高度
 	blockHeader, err := bs.GetScannedBlockHeader()
 	if err != nil {
@@ -115,19 +148,25 @@ func (bs *BNBBlockScanner) ScanBlockTask() {
 
 	for {
 
-		if !bs.Scanning {
+		if !bs.Scanning || ctx.Err() != nil {
 			//区块扫描器已暂停，马上结束本次任务
 			return
 		}
 
-		//获取最大高度
-		maxHeight, err := bs.wm.GetBlockHeight()
+		//获取最大高度和同步状态
+		status, err := bs.wm.RpcClient.GetNodeStatus(ctx)
 		if err != nil {
 			//下一个高度找不到会报异常
 			bs.wm.Log.Std.Info("block scanner can not get rpc-server block height; unexpected error: %v", err)
 			break
 		}
 
+		//节点正在追赶区块或已停止出块时暂停扫描，避免跟随落后的节点
+		if !bs.updateSyncState(status) {
+			break
+		}
+		maxHeight := status.LatestBlockHeight
+
 		//是否已到最新高度
 		if currentHeight >= maxHeight {
 			bs.wm.Log.Std.Info("block scanner has scanned full chain data. Current height: %d", maxHeight)
@@ -138,16 +177,26 @@ func (bs *BNBBlockScanner) ScanBlockTask() {
 		currentHeight = currentHeight + 1
 		bs.wm.Log.Std.Info("block scanner scanning height: %d ...", currentHeight)
 
-		localBlock, err := bs.wm.RpcClient.getBlockByHeight(currentHeight)
+		localBlock, err := bs.wm.RpcClient.GetBlockByHeight(ctx, currentHeight)
 		if err != nil {
-			bs.wm.Log.Std.Info("getBlockByHeight failed; unexpected error: %v", err)
+			if ctx.Err() != nil {
+				//扫描已停止，不记录未扫区块
+				return
+			}
+			if IsRetryable(err) || ErrorKind(err) == ErrHeightNotFound {
+				//节点暂时不可用或区块未同步，下次任务再重试
+				bs.wm.Log.Std.Info("block scanner can not get block on height: %d, retry next time; unexpected error: %v", currentHeight, err)
+			} else {
+				bs.wm.Log.Std.Info("getBlockByHeight failed; unexpected error: %v", err)
+				bs.recordUnscanByError(currentHeight, "", err)
+			}
 			break
 		}
 
 		isFork := false
 
-		//判断hash是否上一区块的hash
-		if currentHash != localBlock.PrevBlockHash {
+		//判断hash是否上一区块的hash，HTTP API的区块没有hash，无法比较时不判断分叉
+		if len(currentHash) > 0 && len(localBlock.PrevBlockHash) > 0 && currentHash != localBlock.PrevBlockHash {
 			previousHeight = currentHeight - 1
 			bs.wm.Log.Std.Info("block has been fork on height: %d.", currentHeight)
 			bs.wm.Log.Std.Info("block height: %d local hash = %s ", previousHeight, currentHash)
@@ -173,7 +222,7 @@ func (bs *BNBBlockScanner) ScanBlockTask() {
 				//查找core钱包的RPC
 				bs.wm.Log.Info("block scanner prev block height:", currentHeight)
 
-				localBlock, err = bs.wm.RpcClient.getBlockByHeight(currentHeight)
+				localBlock, err = bs.wm.RpcClient.GetBlockByHeight(ctx, currentHeight)
 				if err != nil {
 					bs.wm.Log.Std.Error("block scanner can not get prev block; unexpected error: %v", err)
 					break
@@ -198,11 +247,29 @@ func (bs *BNBBlockScanner) ScanBlockTask() {
 
 		} else {
 
-			err = bs.BatchExtractTransaction(localBlock.Height, localBlock.Hash, localBlock.Transactions, false)
+			err = bs.verifyBlock(ctx, localBlock)
+			if err != nil && (ctx.Err() != nil || ErrorKind(err) != ErrBlockUnverified) {
+				//节点暂时不可用，下次任务再验证
+				bs.wm.Log.Std.Info("block scanner can not verify block on height: %d, retry next time; unexpected error: %v", currentHeight, err)
+				break
+			}
+
+			if err != nil {
+				//未通过验证的区块不提取交易单，也不推进本地高度，下次任务再验证
+				bs.wm.Log.Std.Error("block height: %d is unverified and not extracted; unexpected error: %v", currentHeight, err)
+				break
+			}
+
+			err = bs.batchExtractTransaction(ctx, localBlock.Height, localBlock.Hash, localBlock.Transactions, false)
 			if err != nil {
 				bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
 			}
 
+			if ctx.Err() != nil {
+				//提取过程中扫描被停止，不保存新高度，下次从该区块重新扫描
+				return
+			}
+
 			//重置当前区块的hash
 			currentHash = localBlock.Hash
 
@@ -220,7 +287,10 @@ func (bs *BNBBlockScanner) ScanBlockTask() {
 
 	//重扫前N个块，为保证记录找到
 	for i := currentHeight - bs.RescanLastBlockCount; i < currentHeight; i++ {
-		bs.scanBlock(i)
+		if ctx.Err() != nil {
+			return
+		}
+		bs.scanBlockContext(ctx, i)
 	}
 
 	if bs.IsScanMemPool {
@@ -236,6 +306,10 @@ func (bs *BNBBlockScanner) ScanBlockTask() {
 //ScanBlock 扫描指定高度区块
 func (bs *BNBBlockScanner) ScanBlock(height uint64) error {
 
+	if err := bs.wm.verifyNetwork(bs.scanContext()); err != nil {
+		return err
+	}
+
 	block, err := bs.scanBlock(height)
 	if err != nil {
 		return err
@@ -245,22 +319,33 @@ func (bs *BNBBlockScanner) ScanBlock(height uint64) error {
 }
 
 func (bs *BNBBlockScanner) scanBlock(height uint64) (*Block, error) {
+	return bs.scanBlockContext(bs.scanContext(), height)
+}
 
-	block, err := bs.wm.RpcClient.getBlockByHeight(height)
+func (bs *BNBBlockScanner) scanBlockContext(ctx context.Context, height uint64) (*Block, error) {
+
+	block, err := bs.wm.RpcClient.GetBlockByHeight(ctx, height)
 
 	if err != nil {
 		bs.wm.Log.Std.Info("block scanner can not get new block data; unexpected error: %v", err)
 
 		//记录未扫区块
-		unscanRecord := NewUnscanRecord(height, "", err.Error())
-		bs.SaveUnscanRecord(unscanRecord)
-		bs.wm.Log.Std.Info("block height: %d extract failed.", height)
+		if bs.recordUnscanByError(height, "", err) {
+			bs.wm.Log.Std.Info("block height: %d extract failed.", height)
+		}
 		return nil, err
 	}
 
 	bs.wm.Log.Std.Info("block scanner scanning height: %d ...", block.Height)
 
-	err = bs.BatchExtractTransaction(block.Height, block.Hash, block.Transactions, false)
+	err = bs.verifyBlock(ctx, block)
+	if err != nil {
+		bs.wm.Log.Std.Info("block scanner can not verify block; unexpected error: %v", err)
+		bs.recordUnscanByError(height, "", err)
+		return nil, err
+	}
+
+	err = bs.batchExtractTransaction(ctx, block.Height, block.Hash, block.Transactions, false)
 	if err != nil {
 		bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
 	}
@@ -268,24 +353,38 @@ func (bs *BNBBlockScanner) scanBlock(height uint64) (*Block, error) {
 	return block, nil
 }
 
-//ScanTxMemPool 扫描交易内存池
+//ScanTxMemPool 扫描交易内存池，新交易单以0高度发送待确认通知，
+//离开内存池后按上链结果发送确认或失败通知
 func (bs *BNBBlockScanner) ScanTxMemPool() {
 
-	bs.wm.Log.Std.Info("block scanner scanning mempool ...")
+	bs.memPoolMu.Lock()
+	defer bs.memPoolMu.Unlock()
+
+	ctx := bs.scanContext()
+
+	if err := bs.wm.verifyNetwork(ctx); err != nil {
+		bs.wm.Log.Std.Error("block scanner refuses to scan mempool; unexpected error: %v", err)
+		return
+	}
+
+	bs.wm.Log.Std.Debug("block scanner scanning mempool ...")
 
 	//提取未确认的交易单
-	txIDsInMemPool, err := bs.wm.GetTxIDsInMemPool()
+	txIDsInMemPool, complete, err := bs.wm.getTxIDsInMemPoolContext(ctx)
 	if err != nil {
 		bs.wm.Log.Std.Info("block scanner can not get mempool data; unexpected error: %v", err)
 		return
 	}
 
-	if len(txIDsInMemPool) == 0 {
-		bs.wm.Log.Std.Info("no transactions in mempool ...")
+	unseen := bs.memPool.update(txIDsInMemPool, complete)
+
+	bs.settleMemPoolTxs(ctx)
+
+	if len(unseen) == 0 {
 		return
 	}
 
-	err = bs.BatchExtractTransaction(0, "", txIDsInMemPool, true)
+	err = bs.batchExtractTransaction(ctx, 0, "", unseen, true)
 	if err != nil {
 		bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
 	}
@@ -297,6 +396,7 @@ func (bs *BNBBlockScanner) RescanFailedRecord() {
 
 	var (
 		blockMap = make(map[uint64][]string)
+		ctx      = bs.scanContext()
 	)
 
 	list, err := bs.wm.GetUnscanRecords()
@@ -321,6 +421,11 @@ func (bs *BNBBlockScanner) RescanFailedRecord() {
 
 	for height, txs := range blockMap {
 
+		if ctx.Err() != nil {
+			//扫描已停止，保留未扫记录
+			return
+		}
+
 		var hash string
 
 		if height != 0 {
@@ -328,16 +433,23 @@ func (bs *BNBBlockScanner) RescanFailedRecord() {
 
 			if len(txs) == 0 {
 
-				block, err := bs.wm.RpcClient.getBlockByHeight(height)
+				block, err := bs.wm.RpcClient.GetBlockByHeight(ctx, height)
 				if err != nil {
 					bs.wm.Log.Std.Info("block scanner can not get new block data; unexpected error: %v", err)
 					continue
 				}
 
+				err = bs.verifyBlock(ctx, block)
+				if err != nil {
+					//保留未扫记录，直到区块通过验证
+					bs.wm.Log.Std.Info("block scanner can not verify block on height: %d; unexpected error: %v", height, err)
+					continue
+				}
+
 				txs = block.Transactions
 			}
 
-			err = bs.BatchExtractTransaction(height, hash, txs, false)
+			err = bs.batchExtractTransaction(ctx, height, hash, txs, false)
 			if err != nil {
 				bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
 				continue
@@ -351,6 +463,16 @@ func (bs *BNBBlockScanner) RescanFailedRecord() {
 	bs.wm.DeleteUnscanRecordNotFindTX()
 }
 
+//verifyBlock 开启区块头验证时检查区块的commit签名和交易列表，结果记录在block.Verified
+func (bs *BNBBlockScanner) verifyBlock(ctx context.Context, block *Block) error {
+	if !bs.wm.Config.VerifyBlockCommit || bs.wm.LightClient == nil {
+		return nil
+	}
+	err := bs.wm.LightClient.VerifyBlockContext(ctx, block)
+	block.Verified = err == nil
+	return err
+}
+
 //newBlockNotify 获得新区块后，通知给观测者
 func (bs *BNBBlockScanner) newBlockNotify(block *Block, isFork bool) {
 	header := block.BlockHeader()
@@ -361,6 +483,11 @@ func (bs *BNBBlockScanner) newBlockNotify(block *Block, isFork bool) {
 //BatchExtractTransaction 批量提取交易单
 //bitcoin 1M的区块链可以容纳3000笔交易，批量多线程处理，速度更快
 func (bs *BNBBlockScanner) BatchExtractTransaction(blockHeight uint64, blockHash string, txs []string, memPool bool) error {
+	return bs.batchExtractTransaction(bs.scanContext(), blockHeight, blockHash, txs, memPool)
+}
+
+//batchExtractTransaction 批量提取交易单，ctx取消后未开始的交易单直接标记为失败
+func (bs *BNBBlockScanner) batchExtractTransaction(ctx context.Context, blockHeight uint64, blockHash string, txs []string, memPool bool) error {
 
 	var (
 		quit       = make(chan struct{})
@@ -389,18 +516,27 @@ func (bs *BNBBlockScanner) BatchExtractTransaction(blockHeight uint64, blockHash
 
 			if gets.Success {
 
-				notifyErr := bs.newExtractDataNotify(height, gets.extractData)
-				//saveErr := bs.SaveRechargeToWalletDB(height, gets.Recharges)
-				if notifyErr != nil {
+				if memPool {
+					//记录已通知的交易单，离开内存池后再确认或丢弃
+					bs.memPool.add(gets.TxID, gets.extractData)
+				}
+
+				if !memPool && bs.memPool.confirm(gets.TxID) {
+					//离开内存池时已按上链高度通知过
+				} else if notifyErr := bs.newExtractDataNotify(height, gets.extractData); notifyErr != nil {
+					//saveErr := bs.SaveRechargeToWalletDB(height, gets.Recharges)
 					failed++ //标记保存失败数
 					bs.wm.Log.Std.Info("newExtractDataNotify unexpected error: %v", notifyErr)
 				}
-			} else {
+			} else if !memPool {
 				//记录未扫区块
-				unscanRecord := NewUnscanRecord(height, "", "")
-				bs.SaveUnscanRecord(unscanRecord)
-				bs.wm.Log.Std.Info("block height: %d extract failed.", height)
+				if bs.recordUnscanByError(height, gets.TxID, gets.err) {
+					bs.wm.Log.Std.Info("block height: %d extract failed.", height)
+				}
 				failed++ //标记保存失败数
+			} else {
+				//内存池交易单下次扫描时重新提取
+				failed++
 			}
 			//累计完成的线程数
 			done++
@@ -414,12 +550,16 @@ func (bs *BNBBlockScanner) BatchExtractTransaction(blockHeight uint64, blockHash
 	//提取工作
 	extractWork := func(eblockHeight uint64, eBlockHash string, mTxs []string, eProducer chan ExtractResult) {
 		for _, txid := range mTxs {
-			bs.extractingCH <- struct{}{}
+			if !bs.acquireExtracting(ctx) {
+				//扫描已停止，剩余交易单不再请求节点
+				eProducer <- ExtractResult{BlockHeight: eblockHeight, TxID: txid, Success: false, err: ctx.Err()}
+				continue
+			}
 			//shouldDone++
 			go func(mBlockHeight uint64, mTxid string, end chan struct{}, mProducer chan<- ExtractResult) {
 
 				//导出提出的交易
-				mProducer <- bs.ExtractTransaction(mBlockHeight, eBlockHash, mTxid, bs.ScanAddressFunc, memPool)
+				mProducer <- bs.extractTransactionContext(ctx, mBlockHeight, eBlockHash, mTxid, bs.ScanAddressFunc, memPool)
 				//释放
 				<-end
 
@@ -447,6 +587,19 @@ func (bs *BNBBlockScanner) BatchExtractTransaction(blockHeight uint64, blockHash
 	//return nil
 }
 
+//acquireExtracting 获取扫描工作令牌，ctx取消时返回false
+func (bs *BNBBlockScanner) acquireExtracting(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	select {
+	case bs.extractingCH <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
 //extractRuntime 提取运行时
 func (bs *BNBBlockScanner) extractRuntime(producer chan ExtractResult, worker chan ExtractResult, quit chan struct{}) {
 
@@ -480,6 +633,10 @@ func (bs *BNBBlockScanner) extractRuntime(producer chan ExtractResult, worker ch
 
 //ExtractTransaction 提取交易单
 func (bs *BNBBlockScanner) ExtractTransaction(blockHeight uint64, blockHash string, txid string, scanAddressFunc openwallet.BlockScanAddressFunc, memPool bool) ExtractResult {
+	return bs.extractTransactionContext(bs.scanContext(), blockHeight, blockHash, txid, scanAddressFunc, memPool)
+}
+
+func (bs *BNBBlockScanner) extractTransactionContext(ctx context.Context, blockHeight uint64, blockHash string, txid string, scanAddressFunc openwallet.BlockScanAddressFunc, memPool bool) ExtractResult {
 
 	var (
 		result = ExtractResult{
@@ -496,19 +653,21 @@ func (bs *BNBBlockScanner) ExtractTransaction(blockHeight uint64, blockHash stri
 	if memPool {
 		trx, err = bs.wm.GetTransactionInMemPool(txid)
 		if err != nil {
-			trx, err = bs.wm.GetTransaction(txid)
+			trx, err = bs.wm.RpcClient.GetTransaction(ctx, txid)
 			if err != nil {
 				bs.wm.Log.Std.Info("block scanner can not extract transaction data in mempool and block chain; unexpected error: %v", err)
 				result.Success = false
+				result.err = err
 				return result
 			}
 		}
 	} else {
-		trx, err = bs.wm.GetTransaction(txid)
+		trx, err = bs.wm.RpcClient.GetTransaction(ctx, txid)
 
 		if err != nil {
 			bs.wm.Log.Std.Info("block scanner can not extract transaction data; unexpected error: %v", err)
 			result.Success = false
+			result.err = err
 			return result
 		}
 	}
@@ -521,7 +680,7 @@ func (bs *BNBBlockScanner) ExtractTransaction(blockHeight uint64, blockHash stri
 		}
 	}
 
-	bs.extractTransaction(trx, &result, scanAddressFunc)
+	bs.extractTransaction(ctx, trx, &result, scanAddressFunc)
 
 	return result
 
@@ -554,7 +713,7 @@ func convertFromAmount(amountStr string, decimals uint64) uint64 {
 }
 
 //ExtractTransactionData 提取交易单
-func (bs *BNBBlockScanner) extractTransaction(trx *Transaction, result *ExtractResult, scanAddressFunc openwallet.BlockScanAddressFunc) {
+func (bs *BNBBlockScanner) extractTransaction(ctx context.Context, trx *Transaction, result *ExtractResult, scanAddressFunc openwallet.BlockScanAddressFunc) {
 	var (
 		success = true
 	)
@@ -565,11 +724,15 @@ func (bs *BNBBlockScanner) extractTransaction(trx *Transaction, result *ExtractR
 	} else {
 		if success {
 			feeSourceKey := ""
-			blockhash, _ := bs.wm.RpcClient.getBlockHash(trx.BlockHeight)
+			blockhash := ""
+			if trx.BlockHeight > 0 {
+				blockhash, _ = bs.wm.RpcClient.GetBlockHash(ctx, trx.BlockHeight)
+			}
 			notifyFee := false
 			feeNotified := false
 			for _, detail := range trx.TxDetails {
 				denom := detail.Denom
+				coin, decimals := bs.wm.denomCoin(denom)
 				for _, fromChk := range detail.From {
 					sourceKey, ok := scanAddressFunc(fromChk.Address)
 					if ok {
@@ -583,20 +746,8 @@ func (bs *BNBBlockScanner) extractTransaction(trx *Transaction, result *ExtractR
 							input := openwallet.TxInput{}
 							input.TxID = trx.TxID
 							input.Address = from.Address
-							input.Amount = strconv.FormatUint(from.Amount, 10)
-							input.Coin = openwallet.Coin{
-								Symbol:bs.wm.Symbol(),
-								IsContract:true,
-								ContractID:openwallet.GenContractID(bs.wm.Symbol(), denom),
-								Contract:openwallet.SmartContract{
-									Symbol:bs.wm.Symbol(),
-									ContractID:openwallet.GenContractID(bs.wm.Symbol(), denom),
-									Address:denom,
-									Token:denom,
-									Name:bs.wm.FullName(),
-									Decimals:0,
-								},
-							}
+							input.Amount = convertToAmount(from.Amount, decimals)
+							input.Coin = coin
 							input.Index = uint64(i)
 							input.Sid = openwallet.GenTxInputSID(trx.TxID, bs.wm.Symbol(), denom, input.Index)
 							input.CreateAt = createAt
@@ -605,7 +756,7 @@ func (bs *BNBBlockScanner) extractTransaction(trx *Transaction, result *ExtractR
 							input.IsMemo = true
 							input.Memo = trx.Memo
 
-							fromArray = append(fromArray, from.Address+":"+strconv.FormatUint(from.Amount, 10))
+							fromArray = append(fromArray, from.Address+":"+convertToAmount(from.Amount, decimals))
 
 							ed := result.extractData[denom+":"+sourceKey]
 							if ed == nil {
@@ -616,30 +767,18 @@ func (bs *BNBBlockScanner) extractTransaction(trx *Transaction, result *ExtractR
 						}
 
 						for _, to := range detail.To {
-							toArray = append(toArray, to.Address+":"+strconv.FormatUint(to.Amount, 10))
+							toArray = append(toArray, to.Address+":"+convertToAmount(to.Amount, decimals))
 						}
 
 						tx := &openwallet.Transaction{
 							From:fromArray,
 							To:toArray,
 							Fees:"0",
-							Coin:openwallet.Coin{
-								Symbol:bs.wm.Symbol(),
-								IsContract:true,
-								ContractID:openwallet.GenContractID(bs.wm.Symbol(), denom),
-								Contract:openwallet.SmartContract{
-									Symbol:bs.wm.Symbol(),
-									ContractID:openwallet.GenContractID(bs.wm.Symbol(), denom),
-									Address:denom,
-									Token:denom,
-									Name:bs.wm.FullName(),
-									Decimals:0,
-								},
-							},
+							Coin:coin,
 							BlockHeight:trx.BlockHeight,
 							BlockHash:blockhash,
 							TxID:trx.TxID,
-							Decimal:0,
+							Decimal:int32(decimals),
 							Status:"1",
 							IsMemo:true,
 							Memo:trx.Memo,
@@ -658,40 +797,22 @@ func (bs *BNBBlockScanner) extractTransaction(trx *Transaction, result *ExtractR
 				}
 
 				if notifyFee && !feeNotified{
+					//按交易所在高度的手续费表计算，批量转账按输出数量收费
 					var fee uint64
-					var detail2  TxDetail
-					if len(trx.TxDetails) > 1 {
-						fee, _ = bs.wm.RpcClient.getMultiFeeByHeight(trx.BlockHeight)
+					schedule, err := bs.wm.RpcClient.GetFeeSchedule(ctx, trx.BlockHeight)
+					if err != nil {
+						bs.wm.Log.Std.Error("block scanner can not get fee schedule on height: %d; unexpected error: %v", trx.BlockHeight, err)
 					} else {
-						for _, v := range trx.TxDetails {
-							detail2  = *v
-						}
-
-						if len(detail2.From) > 1 || len(detail2.To) > 1 {
-							fee, _ = bs.wm.RpcClient.getMultiFeeByHeight(trx.BlockHeight)
-						} else {
-							fee, _ = bs.wm.RpcClient.getFeeByHeight(trx.BlockHeight)
-						}
+						fee = uint64(schedule.TransferFeeOf(trx.OutputCount()))
 					}
 
 					feeCharge := openwallet.TxInput{}
 					feeCharge.TxID = trx.TxID
 					feeCharge.Address = detail.From[0].Address
-					feeStr := strconv.FormatUint(fee, 10)
+					feeCoin, feeDecimals := bs.wm.denomCoin(Symbol)
+					feeStr := convertToAmount(fee, feeDecimals)
 					feeCharge.Amount = feeStr
-					feeCharge.Coin = openwallet.Coin{
-						Symbol:bs.wm.Symbol(),
-						IsContract:true,
-						ContractID:openwallet.GenContractID(bs.wm.Symbol(), "BNB"),
-						Contract:openwallet.SmartContract{
-							Symbol:bs.wm.Symbol(),
-							ContractID:openwallet.GenContractID(bs.wm.Symbol(), "BNB"),
-							Address:"BNB",
-							Token:"",
-							Name:bs.wm.FullName(),
-							Decimals:0,
-						},
-					}
+					feeCharge.Coin = feeCoin
 					feeCharge.Index = 0
 					feeCharge.Sid = openwallet.GenTxInputSID(trx.TxID, bs.wm.Symbol(), "BNB", feeCharge.Index)
 					feeCharge.CreateAt = createAt
@@ -714,23 +835,11 @@ func (bs *BNBBlockScanner) extractTransaction(trx *Transaction, result *ExtractR
 						To:[]string{""},
 						Amount:feeStr,
 						Fees:"0",
-						Coin:openwallet.Coin{
-							Symbol:bs.wm.Symbol(),
-							IsContract:true,
-							ContractID:openwallet.GenContractID(bs.wm.Symbol(), "BNB"),
-							Contract:openwallet.SmartContract{
-								Symbol:bs.wm.Symbol(),
-								ContractID:openwallet.GenContractID(bs.wm.Symbol(), "BNB"),
-								Address:"BNB",
-								Token:"",
-								Name:bs.wm.FullName(),
-								Decimals:0,
-							},
-						},
+						Coin:feeCoin,
 						BlockHash:blockhash,
 						BlockHeight:trx.BlockHeight,
 						TxID:trx.TxID,
-						Decimal:0,
+						Decimal:int32(feeDecimals),
 						Status:"1",
 						IsMemo:true,
 						Memo:trx.Memo,
@@ -753,20 +862,8 @@ func (bs *BNBBlockScanner) extractTransaction(trx *Transaction, result *ExtractR
 							output := openwallet.TxOutPut{}
 							output.TxID = trx.TxID
 							output.Address = to.Address
-							output.Amount = strconv.FormatUint(to.Amount, 10)
-							output.Coin = openwallet.Coin{
-								Symbol:bs.wm.Symbol(),
-								IsContract:true,
-								ContractID:openwallet.GenContractID(bs.wm.Symbol(), denom),
-								Contract:openwallet.SmartContract{
-									Symbol:bs.wm.Symbol(),
-									ContractID:openwallet.GenContractID(bs.wm.Symbol(), denom),
-									Address:denom,
-									Token:"",
-									Name:bs.wm.FullName(),
-									Decimals:0,
-								},
-							}
+							output.Amount = convertToAmount(to.Amount, decimals)
+							output.Coin = coin
 							output.Index = uint64(i)
 							output.Sid = openwallet.GenTxOutPutSID(trx.TxID, bs.wm.Symbol(), denom, output.Index)
 							output.CreateAt = createAt
@@ -782,11 +879,11 @@ func (bs *BNBBlockScanner) extractTransaction(trx *Transaction, result *ExtractR
 							}
 							ed.TxOutputs = append(ed.TxOutputs, &output)
 
-							toArray = append(toArray, to.Address+":"+strconv.FormatUint(to.Amount, 10))
+							toArray = append(toArray, to.Address+":"+convertToAmount(to.Amount, decimals))
 						}
 
 						for _, from := range detail.From {
-							fromArray = append(fromArray, from.Address+":"+strconv.FormatUint(from.Amount, 10))
+							fromArray = append(fromArray, from.Address+":"+convertToAmount(from.Amount, decimals))
 						}
 
 						ed := result.extractData[denom+":"+sourceKey]
@@ -799,23 +896,11 @@ func (bs *BNBBlockScanner) extractTransaction(trx *Transaction, result *ExtractR
 								From:fromArray,
 								To:toArray,
 								Fees:"0",
-								Coin:openwallet.Coin{
-									Symbol:bs.wm.Symbol(),
-									IsContract:true,
-									ContractID:openwallet.GenContractID(bs.wm.Symbol(), denom),
-									Contract:openwallet.SmartContract{
-										ContractID:openwallet.GenContractID(bs.wm.Symbol(), denom),
-										Symbol:bs.wm.Symbol(),
-										Address:denom,
-										Token:"",
-										Name:bs.wm.FullName(),
-										Decimals:0,
-									},
-								},
+								Coin:coin,
 								BlockHash:blockhash,
 								BlockHeight:trx.BlockHeight,
 								TxID:trx.TxID,
-								Decimal:0,
+								Decimal:int32(decimals),
 								Status:"1",
 								IsMemo:true,
 								Memo:trx.Memo,
@@ -837,6 +922,29 @@ func (bs *BNBBlockScanner) extractTransaction(trx *Transaction, result *ExtractR
 	result.Success = success
 }
 
+//recordUnscanByError 扫描失败时记录未扫记录等待重扫，交易单不存在的记录在下一次重扫后删除。
+//节点错误无法可靠区分是否永久失败，除扫描被停止外都记录，避免丢失充值。返回是否已记录。
+func (bs *BNBBlockScanner) recordUnscanByError(height uint64, txID string, err error) bool {
+
+	reason := ""
+	if err != nil {
+		reason = err.Error()
+	}
+
+	if err == context.Canceled {
+		//扫描被停止，交易单会在下次扫描该区块时重新提取
+		return false
+	}
+
+	unscanRecord := NewUnscanRecord(height, txID, reason)
+	saveErr := bs.SaveUnscanRecord(unscanRecord)
+	if saveErr != nil {
+		bs.wm.Log.Std.Error("block height: %d, txID: %s save unscan record failed. unexpected error: %v", height, txID, saveErr)
+		return false
+	}
+	return true
+}
+
 //newExtractDataNotify 发送通知
 func (bs *BNBBlockScanner) newExtractDataNotify(height uint64, extractData map[string]*openwallet.TxExtractData) error {
 
@@ -864,7 +972,7 @@ func (bs *BNBBlockScanner) newExtractDataNotify(height uint64, extractData map[s
 func (wm *WalletManager) DeleteUnscanRecordNotFindTX() error {
 
 	//删除找不到交易单
-	reason := "[-5]No information available about transaction"
+	reason := ErrTxNotFound.Error()
 
 	//获取本地区块高度
 	db, err := storm.Open(filepath.Join(wm.Config.dbPath, wm.Config.BlockchainFile))
@@ -942,7 +1050,7 @@ func (bs *BNBBlockScanner) GetCurrentBlockHeader() (*openwallet.BlockHeader, err
 		return nil, err
 	}
 
-	block, err := bs.wm.RpcClient.getBlockByHeight(blockHeight)
+	block, err := bs.wm.RpcClient.GetBlockByHeight(context.Background(), blockHeight)
 	if err != nil {
 		bs.wm.Log.Errorf("get block spec by block number failed, err=%v", err)
 		return nil, err
@@ -977,7 +1085,7 @@ func (bs *BNBBlockScanner) GetScannedBlockHeader() (*openwallet.BlockHeader, err
 		//就上一个区块链为当前区块
 		blockHeight = blockHeight - 1
 
-		block, err := bs.wm.RpcClient.getBlockByHeight(blockHeight)
+		block, err := bs.wm.RpcClient.GetBlockByHeight(context.Background(), blockHeight)
 		if err != nil {
 			bs.wm.Log.Errorf("get block spec by block number failed, err=%v", err)
 			return nil, err
@@ -1119,7 +1227,7 @@ func (bs *BNBBlockScanner) GetSourceKeyByAddress(address string) (string, bool)
 
 //GetBlockHeight 获取区块链高度
 func (wm *WalletManager) GetBlockHeight() (uint64, error) {
-	return wm.RpcClient.getBlockHeight()
+	return wm.RpcClient.GetBlockHeight(context.Background())
 }
 
 //GetLocalNewBlock 获取本地记录的区块高度和hash
@@ -1174,12 +1282,14 @@ func (wm *WalletManager) SaveLocalBlock(block *Block) {
 	}
 	defer db.Close()
 
-	db.Save(block)
+	if err := db.Save(block); err != nil {
+		wm.Log.Std.Error("block height: %d, save local block failed. unexpected error: %v", block.Height, err)
+	}
 }
 
 //GetBlockHash 根据区块高度获得区块hash
 func (wm *WalletManager) GetBlockHash(height uint64) (string, error) {
-	return wm.RpcClient.getBlockHash(height)
+	return wm.RpcClient.GetBlockHash(context.Background(), height)
 }
 
 //GetLocalBlock 获取本地区块数据
@@ -1210,17 +1320,31 @@ func (wm *WalletManager) GetBlock(hash string) (*Block, error) {
 
 //GetTxIDsInMemPool 获取待处理的交易池中的交易单IDs
 func (wm *WalletManager) GetTxIDsInMemPool() ([]string, error) {
-	return nil, nil
+	txids, _, err := wm.getTxIDsInMemPoolContext(context.Background())
+	return txids, err
+}
 
+//getTxIDsInMemPoolContext complete为false表示只获取到内存池的一部分交易单
+func (wm *WalletManager) getTxIDsInMemPoolContext(ctx context.Context) ([]string, bool, error) {
+	memPool, ok := wm.RpcClient.(MemPoolBackend)
+	if !ok {
+		return nil, false, errors.New("chain backend doesn't support mempool")
+	}
+	return memPool.GetUnconfirmedTxs(ctx)
 }
 
+//GetTransactionInMemPool 从最近一次获取的交易池中解码交易单
 func (wm *WalletManager) GetTransactionInMemPool(txid string) (*Transaction, error) {
-	return nil, nil
+	memPool, ok := wm.RpcClient.(MemPoolBackend)
+	if !ok {
+		return nil, errors.New("chain backend doesn't support mempool")
+	}
+	return memPool.GetMemPoolTransaction(context.Background(), txid)
 }
 
 //GetTransaction 获取交易单
 func (wm *WalletManager) GetTransaction(txid string) (*Transaction, error) {
-	return wm.RpcClient.getTransaction(txid)
+	return wm.RpcClient.GetTransaction(context.Background(), txid)
 }
 
 //获取未扫记录
@@ -1267,52 +1391,52 @@ func (bs *BNBBlockScanner) GetBalanceByAddress(address ...string) ([]*openwallet
 
 	addrsBalance := make([]*openwallet.Balance, 0)
 
-	for _, addr := range address {
-		balance, err := bs.wm.RpcClient.getBalance(addr, "BNB")
-		if err != nil {
-			return nil, err
-		}
+	infos, err := bs.wm.GetAccounts(address...)
+	if err != nil {
+		return nil, err
+	}
 
-		addrsBalance = append(addrsBalance, &openwallet.Balance{
-			Symbol:  bs.wm.Symbol(),
-			Address: addr,
-			Balance: convertToAmount(uint64(balance.Balance.Int64()), 8),
-		})
+	//主链币BNB的余额，代币余额由ContractDecoder查询
+	_, decimals := bs.wm.denomCoin(Symbol)
+	for _, info := range infos {
+		addrsBalance = append(addrsBalance, info.Balance(bs.wm.Symbol(), Symbol, decimals))
 	}
 
 	return addrsBalance, nil
 }
 
+//getMultiAddrTransactions 按高度从新到旧分页查询多个地址的转账交易单
 func (c *Client) getMultiAddrTransactions(offset, limit int, addresses ...string) ([]*Transaction, error) {
-	var (
-		trxs = make([]*Transaction, 0)
-	)
-
-	for _, addr := range addresses {
-		path := "/txs/" + addr
-
-		resp, err := c.Call(path, nil, "GET")
-		if err != nil {
-			return nil, err
-		}
-		txArray := resp.Array()[0].Array()
-
-		for _, txDetail := range txArray {
-			trxs = append(trxs, NewTransaction(&txDetail))
-		}
-	}
+	return c.getMultiAddrTransactionsContext(context.Background(), offset, limit, addresses...)
+}
 
-	return trxs, nil
+func (c *Client) getMultiAddrTransactionsContext(ctx context.Context, offset, limit int, addresses ...string) ([]*Transaction, error) {
+	return c.searchAddressTransactionsContext(ctx, AddressTxQuery{Addresses: addresses, Offset: offset, Limit: limit})
 }
 
-//GetAssetsAccountTransactionsByAddress 查询账户相关地址的交易记录
+//GetAssetsAccountTransactionsByAddress 查询账户相关地址的交易记录，按高度从新到旧分页，只返回coin的转账
 func (bs *BNBBlockScanner) GetTransactionsByAddress(offset, limit int, coin openwallet.Coin, address ...string) ([]*openwallet.TxExtractData, error) {
+	return bs.SearchTransactionsByAddress(AddressTxQuery{
+		Addresses: address,
+		Denom:     coinDenom(coin),
+		Offset:    offset,
+		Limit:     limit,
+	})
+}
+
+//SearchTransactionsByAddress 按条件查询地址相关的交易记录，可以限制高度范围和排序
+func (bs *BNBBlockScanner) SearchTransactionsByAddress(query AddressTxQuery) ([]*openwallet.TxExtractData, error) {
 
 	var (
 		array = make([]*openwallet.TxExtractData, 0)
 	)
 
-	trxs, err := bs.wm.RpcClient.getMultiAddrTransactions(offset, limit, address...)
+	history, ok := bs.wm.RpcClient.(AddressHistoryBackend)
+	if !ok {
+		return nil, errors.New("chain backend doesn't support address history")
+	}
+	ctx := context.Background()
+	trxs, err := history.GetAddressTransactions(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -1321,7 +1445,7 @@ func (bs *BNBBlockScanner) GetTransactionsByAddress(offset, limit int, coin open
 
 	//提取账户相关的交易单
 	var scanAddressFunc openwallet.BlockScanAddressFunc = func(findAddr string) (string, bool) {
-		for _, a := range address {
+		for _, a := range query.Addresses {
 			if findAddr == a {
 				return key, true
 			}
@@ -1329,8 +1453,6 @@ func (bs *BNBBlockScanner) GetTransactionsByAddress(offset, limit int, coin open
 		return "", false
 	}
 
-	//要检查一下tx.BlockHeight是否有值
-
 	for _, tx := range trxs {
 
 		result := ExtractResult{
@@ -1340,11 +1462,20 @@ func (bs *BNBBlockScanner) GetTransactionsByAddress(offset, limit int, coin open
 			Success:     true,
 		}
 
-		bs.extractTransaction(tx, &result, scanAddressFunc)
-		data := result.extractData
-		txExtract := data[key]
-		if txExtract != nil {
-			array = append(array, txExtract)
+		bs.extractTransaction(ctx, tx, &result, scanAddressFunc)
+
+		//提取结果按币种分开保存，键为denom:sourceKey
+		denoms := make([]string, 0, len(tx.TxDetails))
+		for denom := range tx.TxDetails {
+			if len(query.Denom) == 0 || denom == query.Denom {
+				denoms = append(denoms, denom)
+			}
+		}
+		sort.Strings(denoms)
+		for _, denom := range denoms {
+			if txExtract := result.extractData[denom+":"+key]; txExtract != nil {
+				array = append(array, txExtract)
+			}
 		}
 
 	}
@@ -1352,9 +1483,23 @@ func (bs *BNBBlockScanner) GetTransactionsByAddress(offset, limit int, coin open
 	return array, nil
 }
 
+//coinDenom 币种在链上的denom，合约币种为合约地址，未指定币种时返回空
+func coinDenom(coin openwallet.Coin) string {
+	if coin.IsContract {
+		return coin.Contract.Address
+	}
+	if len(coin.Symbol) > 0 {
+		return Symbol
+	}
+	return ""
+}
+
 //Run 运行
 func (bs *BNBBlockScanner) Run() error {
 
+	bs.resetScanContext()
+	bs.startWebsocket()
+	bs.startMemPoolScan()
 	bs.BlockScannerBase.Run()
 
 	return nil
@@ -1363,6 +1508,8 @@ func (bs *BNBBlockScanner) Run() error {
 ////Stop 停止扫描
 func (bs *BNBBlockScanner) Stop() error {
 
+	//取消正在进行的节点请求和交易提取
+	bs.cancelScan()
 	bs.BlockScannerBase.Stop()
 
 	return nil
@@ -1371,6 +1518,7 @@ func (bs *BNBBlockScanner) Stop() error {
 //Pause 暂停扫描
 func (bs *BNBBlockScanner) Pause() error {
 
+	bs.cancelScan()
 	bs.BlockScannerBase.Pause()
 
 	return nil
@@ -1379,94 +1527,167 @@ func (bs *BNBBlockScanner) Pause() error {
 //Restart 继续扫描
 func (bs *BNBBlockScanner) Restart() error {
 
+	bs.resetScanContext()
+	bs.startWebsocket()
+	bs.startMemPoolScan()
 	bs.BlockScannerBase.Restart()
 
 	return nil
 }
 
-/******************* 使用insight socket.io 监听区块 *******************/
+//startWebsocket 按配置启动websocket订阅，失败时只使用轮询
+func (bs *BNBBlockScanner) startWebsocket() {
+	if !bs.wm.Config.EnableWebsocket {
+		return
+	}
+	ctx := bs.scanContext()
 
-//setupSocketIO 配置socketIO监听新区块
-func (bs *BNBBlockScanner) setupSocketIO() error {
+	//当前扫描上下文已有订阅在运行
+	bs.wsMu.Lock()
+	running := bs.ws != nil && bs.wsCtx == ctx
+	bs.wsMu.Unlock()
+	if running {
+		return
+	}
 
-	bs.wm.Log.Info("block scanner use socketIO to listen new data")
+	err := bs.setupWebsocket(ctx)
+	if err != nil {
+		bs.wm.Log.Std.Warning("block scanner can not setup websocket, use polling only; unexpected error: %v", err)
+	}
+}
 
-	var (
-		room = "inv"
-	)
+//scanContext 当前扫描上下文
+func (bs *BNBBlockScanner) scanContext() context.Context {
+	bs.ctxMu.Lock()
+	defer bs.ctxMu.Unlock()
+	if bs.scanCtx == nil {
+		bs.scanCtx, bs.scanCancel = context.WithCancel(context.Background())
+	}
+	return bs.scanCtx
+}
 
-	if bs.socketIO == nil {
+//resetScanContext 创建新的扫描上下文，已取消的上下文不再影响后续扫描
+func (bs *BNBBlockScanner) resetScanContext() {
+	bs.ctxMu.Lock()
+	defer bs.ctxMu.Unlock()
+	if bs.scanCtx != nil && bs.scanCtx.Err() == nil {
+		return
+	}
+	bs.scanCtx, bs.scanCancel = context.WithCancel(context.Background())
+}
 
-		apiUrl, err := url.Parse(bs.wm.Config.RpcAPI)
-		if err != nil {
-			return err
-		}
-		domain := apiUrl.Hostname()
-		port := common.NewString(apiUrl.Port()).Int()
-		c, err := gosocketio.Dial(
-			gosocketio.GetUrl(domain, port, false),
-			transport.GetDefaultWebsocketTransport())
-		if err != nil {
-			return err
-		}
+//cancelScan 取消正在进行的扫描
+func (bs *BNBBlockScanner) cancelScan() {
+	bs.ctxMu.Lock()
+	defer bs.ctxMu.Unlock()
+	if bs.scanCancel != nil {
+		bs.scanCancel()
+	}
+}
+
+/******************* 使用Tendermint websocket 监听区块 *******************/
 
-		bs.socketIO = c
+//setupWebsocket 订阅节点的NewBlock和Tx事件，收到新高度马上扫描，
+//连接断开或长时间没有事件时由定时任务继续轮询
+func (bs *BNBBlockScanner) setupWebsocket(ctx context.Context) error {
 
+	bs.wm.Log.Info("block scanner use websocket to listen new data")
+
+	ws, err := newWSSubscriber(bs.wm.Config.RpcAPI, QueryNewBlock, QueryTx)
+	if err != nil {
+		return err
 	}
 
-	err := bs.socketIO.On("tx", func(h *gosocketio.Channel, args interface{}) {
-		//bs.wm.Log.Info("block scanner socketIO get new transaction received: ", args)
-		txMap, ok := args.(map[string]interface{})
-		if ok {
-			txid := txMap["txid"].(string)
-			errInner := bs.BatchExtractTransaction(0, "", []string{txid}, false)
-			if errInner != nil {
-				bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", errInner)
+	//每次重连按健康程度重新选择节点，断开的节点降级，与RPC请求一样切换节点
+	var node *NodeEndpoint
+	c := bs.wm.tendermintClient()
+	if c != nil {
+		//与RPC请求使用相同的认证、证书和代理
+		ws.Dialer, ws.Header = c.wsDialer()
+		ws.Resolve = func(ctx context.Context) (string, error) {
+			node = c.wsNode(ctx)
+			if node == nil {
+				return bs.wm.Config.RpcAPI, nil
 			}
+			return node.URL, nil
 		}
+	}
+	if bs.wm.Config.WebsocketReconnectInterval > 0 {
+		ws.ReconnectInterval = bs.wm.Config.WebsocketReconnectInterval
+	}
 
-	})
-	if err != nil {
-		return err
+	ws.OnConnected = func() {
+		bs.wm.Log.Info("block scanner websocket connected:", ws.URL)
+		if node != nil {
+			c.nodes.markSucceeded(node)
+		}
+	}
+	ws.OnDisconnected = func(err error) {
+		bs.wm.Log.Std.Warning("block scanner websocket disconnected, fall back to polling; unexpected error: %v", err)
+		if node != nil {
+			c.nodes.markFailed(node)
+		}
 	}
+	ws.OnEvent = func(event *WSEvent) {
+		bs.wsMu.Lock()
+		bs.wsLastEvent = time.Now()
+		bs.wsMu.Unlock()
+
+		//已广播的交易单直接得到DeliverTx结果
+		if len(event.TxID) > 0 && bs.wm.TxTracker != nil {
+			bs.wm.TxTracker.onTxEvent(event)
+		}
 
-	/*
-		err = bs.socketIO.On("block", func(h *gosocketio.Channel, args interface{}) {
-			bs.wm.Log.Info("block scanner socketIO get new block received: ", args)
-			hash, ok := args.(string)
-			if ok {
+		//只通知有新高度，扫描统一由ScanBlockTask完成，避免重复提取
+		select {
+		case bs.newHeightCH <- event.Height:
+		default:
+		}
+	}
 
-				block, errInner := bs.wm.GetBlock(hash)
-				if errInner != nil {
-					bs.wm.Log.Std.Info("block scanner can not get new block data; unexpected error: %v", errInner)
-				}
+	bs.wsMu.Lock()
+	bs.ws = ws
+	bs.wsCtx = ctx
+	bs.wsMu.Unlock()
 
-				errInner = bs.scanBlock(block)
-				if errInner != nil {
-					bs.wm.Log.Std.Info("block scanner can not block: %d; unexpected error: %v", block.Height, errInner)
-				}
-			}
+	go ws.Run(ctx)
+	go bs.wsScanLoop(ctx)
 
-		})
-		if err != nil {
-			return err
-		}
-	*/
+	return nil
+}
 
-	err = bs.socketIO.On(gosocketio.OnDisconnection, func(h *gosocketio.Channel) {
-		bs.wm.Log.Info("block scanner socketIO disconnected")
-	})
-	if err != nil {
-		return err
+//wsScanLoop 收到新高度通知后执行扫描任务
+func (bs *BNBBlockScanner) wsScanLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case height := <-bs.newHeightCH:
+			if !bs.Scanning {
+				continue
+			}
+			if height > 0 && height <= bs.GetScannedBlockHeight() {
+				continue
+			}
+			bs.ScanBlockTask()
+		}
 	}
+}
 
-	err = bs.socketIO.On(gosocketio.OnConnection, func(h *gosocketio.Channel) {
-		bs.wm.Log.Info("block scanner socketIO connected")
-		h.Emit("subscribe", room)
-	})
-	if err != nil {
-		return err
+//websocketActive websocket是否已连接且持续收到事件
+func (bs *BNBBlockScanner) websocketActive() bool {
+	bs.wsMu.Lock()
+	defer bs.wsMu.Unlock()
+	if bs.ws == nil || !bs.ws.IsConnected() {
+		return false
 	}
+	return time.Since(bs.wsLastEvent) < wsStaleInterval
+}
 
-	return nil
+//pollBlockTask 定时扫描任务，websocket正常推送时跳过轮询
+func (bs *BNBBlockScanner) pollBlockTask() {
+	if bs.websocketActive() {
+		return
+	}
+	bs.ScanBlockTask()
 }
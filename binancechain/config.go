@@ -42,12 +42,26 @@ type WalletConfig struct {
 	RpcUser string
 	//RPC认证账户密码
 	RpcPassword string
+	//RPC Bearer认证令牌，配置时代替账户名和密码
+	RpcBearerToken string
 	//证书目录
 	CertsDir string
+	//节点的CA证书文件，相对路径时在证书目录下
+	RpcCAFile string
+	//mTLS客户端证书文件，相对路径时在证书目录下
+	RpcCertFile string
+	//mTLS客户端私钥文件，相对路径时在证书目录下
+	RpcKeyFile string
+	//访问节点的HTTP代理
+	RpcProxy string
 	//钥匙备份路径
 	keyDir string
 	//是否测试网络
 	IsTestNet bool
+	//期望的链ID，为空时主网要求Binance-Chain-Tigris，测试网只要求不是主网
+	ChainID string
+	//节点链ID复查间隔
+	NetworkCheckInterval time.Duration
 	//地址导出路径
 	addressDir string
 	//配置文件路径
@@ -68,6 +82,52 @@ type WalletConfig struct {
 	backupDir string
 	// rest API
 	RpcAPI string
+	// rest API 节点列表，多节点时自动故障切换
+	RpcAPIs []string
+	//节点接口类型，0: Tendermint RPC，1: Binance DEX HTTP API
+	RpcServerType int
+	//Binance DEX HTTP API 节点列表，RpcServerType为1时使用
+	ServerAPIs []string
+	//节点健康检查间隔
+	HealthCheckInterval time.Duration
+	//节点允许落后最高节点的区块数
+	MaxHeightLag uint64
+	//节点调用可重试错误的重试次数
+	RpcRetryCount int
+	//节点调用首次重试等待时间，之后按指数增长
+	RpcRetryBackoff time.Duration
+	//节点单次请求超时时间
+	RpcTimeout time.Duration
+	//账户查询结果缓存有效期
+	AccountCacheTTL time.Duration
+	//账户查询是否要求节点返回Merkle证明，并用轻客户端验证过的区块头验证
+	VerifyQueryProof bool
+	//扫描区块时是否验证commit的验证人签名
+	VerifyBlockCommit bool
+	//初始信任的验证人集合hash，开启验证时必须配置
+	TrustedValidatorsHash string
+	//最新手续费参数的缓存有效期
+	FeeCacheTTL time.Duration
+	//批量查询余额的并发数
+	BalanceQueryWorkers int
+	//批量查询余额每秒请求数上限
+	BalanceQueryRateLimit int
+	//是否通过Tendermint websocket订阅新区块
+	EnableWebsocket bool
+	//websocket断线重连间隔
+	WebsocketReconnectInterval time.Duration
+	//查询广播交易单上链状态的间隔
+	TxTrackInterval time.Duration
+	//等待广播交易单上链的最长时间
+	TxTrackTimeout time.Duration
+	//是否扫描内存池中未确认的交易单
+	ScanMemPool bool
+	//内存池扫描间隔
+	MemPoolScanInterval time.Duration
+	//节点最新区块的最大时间差，超过时暂停扫描，0为不检查
+	MaxBlockAge time.Duration
+	//助记词恢复钱包时连续无链上记录的地址数上限
+	RecoveryGapLimit int
 	//钱包安装的路径
 	NodeInstallPath string
 	//钱包数据文件目录
@@ -121,6 +181,8 @@ func NewConfig(symbol string, masterKey string) *WalletConfig {
 	c.BlockchainFile = "blockchain.db"
 	//是否测试网络
 	c.IsTestNet = false
+	//节点链ID复查间隔
+	c.NetworkCheckInterval = defaultNetworkCheckInterval
 	// 核心钱包是否只做监听
 	c.CoreWalletWatchOnly = true
 	//最大的输入数量
@@ -143,6 +205,46 @@ func NewConfig(symbol string, masterKey string) *WalletConfig {
 	c.CoinDecimal = decimal.NewFromFloat(100000000)
 	//核心钱包密码，配置有值用于自动解锁钱包
 	c.WalletPassword = ""
+	//节点接口类型
+	c.RpcServerType = RpcServerTendermint
+	//节点健康检查间隔
+	c.HealthCheckInterval = defaultHealthCheckInterval
+	//节点允许落后最高节点的区块数
+	c.MaxHeightLag = defaultMaxHeightLag
+	//节点调用可重试错误的重试次数
+	c.RpcRetryCount = defaultRetryCount
+	//节点调用首次重试等待时间
+	c.RpcRetryBackoff = defaultRetryBackoff
+	//节点单次请求超时时间
+	c.RpcTimeout = defaultRPCTimeout
+	//账户查询结果缓存有效期
+	c.AccountCacheTTL = defaultAccountCacheTTL
+	//账户查询是否要求节点返回Merkle证明，并用轻客户端验证过的区块头验证
+	c.VerifyQueryProof = false
+	//扫描区块时是否验证commit的验证人签名
+	c.VerifyBlockCommit = false
+	//最新手续费参数的缓存有效期
+	c.FeeCacheTTL = defaultFeeCacheTTL
+	//批量查询余额的并发数
+	c.BalanceQueryWorkers = defaultBatchWorkers
+	//批量查询余额每秒请求数上限
+	c.BalanceQueryRateLimit = 0
+	//是否通过Tendermint websocket订阅新区块
+	c.EnableWebsocket = false
+	//websocket断线重连间隔
+	c.WebsocketReconnectInterval = defaultWSReconnectInterval
+	//查询广播交易单上链状态的间隔
+	c.TxTrackInterval = defaultTxTrackInterval
+	//等待广播交易单上链的最长时间
+	c.TxTrackTimeout = defaultTxTrackTimeout
+	//是否扫描内存池中未确认的交易单
+	c.ScanMemPool = false
+	//内存池扫描间隔
+	c.MemPoolScanInterval = defaultMemPoolScanInterval
+	//节点最新区块的最大时间差
+	c.MaxBlockAge = defaultMaxBlockAge
+	//助记词恢复钱包的地址间隔上限
+	c.RecoveryGapLimit = defaultRecoveryGapLimit
 
 	//默认配置内容
 	c.DefaultConfig = `
@@ -156,16 +258,78 @@ nodeInstallPath = ""
 mainNetDataPath = ""
 # testnet data path
 testNetDataPath = ""
-# RPC Server Type，0: Rest API
+# RPC Server Type，0: Tendermint RPC nodes of [rpcAPI], 1: Binance DEX HTTP API nodes of [serverAPI]
+# the DEX HTTP API serves the latest accounts and fees only, it can't verify proofs, subscribe websocket or scan the mempool
+# it returns no block hashes either, so the block scanner can't detect forks with rpcServerType = 1
 rpcServerType = 0
-# RPC api url
+# Binance DEX HTTP API urls, separated by ';', such as https://dex.binance.org
 serverAPI = ""
-# RPC Authentication Username
+# Tendermint RPC node urls, separated by ';'. The healthiest in-sync node is used and calls fail over to the others
+rpcAPI = ""
+# node health check cycle time, sample: 1m , 30s, 3m20s etc
+nodeHealthCheckCycle = "30s"
+# max blocks a node may lag behind the highest node and still be considered in sync
+nodeMaxHeightLag = 5
+# retry times of retryable rpc errors, such as node unavailable or rate limited
+rpcRetryCount = 2
+# wait time before the first retry, doubled on every further retry, sample: 500ms, 1s etc
+rpcRetryBackoff = "500ms"
+# timeout of a single rpc request, 0 means no timeout, sample: 10s, 1m etc
+rpcTimeout = "30s"
+# cache time of queried accounts, 0 means no cache, sample: 3s, 10s etc
+accountCacheTTL = "3s"
+# query accounts with prove=true and verify the merkle proof against the app hash of the next block header, the header is verified by the light client like verifyBlockCommit, unverifiable answers are refused
+verifyQueryProof = false
+# verify every scanned block by the +2/3 precommit signatures of the validator set tracked from /validators, unverified blocks are not extracted
+verifyBlockCommit = false
+# hex hash of the initially trusted validator set, required by verifyQueryProof and verifyBlockCommit
+trustedValidatorsHash = ""
+# refresh cycle of the latest fee params, history fee params are cached by height range, sample: 30s, 1m etc
+feeCacheTTL = "1m"
+# concurrent workers of batch balance queries
+balanceQueryWorkers = 10
+# max requests per second of batch balance queries, 0 means no limit
+balanceQueryRateLimit = 0
+# subscribe NewBlock and Tx events by the node's Tendermint /websocket, polling is used when the socket drops
+enableWebsocket = false
+# websocket reconnect cycle time, sample: 5s, 1m etc
+websocketReconnectCycle = "5s"
+# transactions are broadcast by broadcast_tx_sync, then tracked by /tx or websocket until DeliverTx
+# track cycle time, sample: 1s, 3s etc
+txTrackCycle = "1s"
+# give up tracking when the transaction is not committed in this time
+txTrackTimeout = "2m"
+# scan unconfirmed transactions by /unconfirmed_txs, deposits are notified with block height 0 and confirmed or failed after leaving the mempool
+scanMemPool = false
+# mempool scan cycle time, sample: 500ms, 1s etc
+memPoolScanCycle = "500ms"
+# scanning is paused while the node reports catching_up or its latest block is older than this, 0 means no age check, sample: 1m, 5m etc
+maxBlockAge = "2m"
+# mnemonic recovery stops after this many consecutive addresses without on-chain activity
+recoveryGapLimit = 20
+# RPC Authentication Username, sent by HTTP Basic authentication
 rpcUser = ""
 # RPC Authentication Password
 rpcPassword = ""
-# Is network test?
+# RPC Bearer token, used instead of rpcUser and rpcPassword when set
+rpcBearerToken = ""
+# certificates directory, default = ./data/bnb/certs
+certsDir = ""
+# PEM bundle of CAs trusted for the nodes' TLS certificates, empty means the system CAs
+rpcCAFile = ""
+# client certificate and private key in PEM for mutual TLS, relative paths are in [certsDir]
+rpcCertFile = ""
+rpcKeyFile = ""
+# HTTP proxy of rpc and websocket requests, such as http://127.0.0.1:3128, empty means HTTP_PROXY and HTTPS_PROXY
+rpcProxy = ""
+# Is network test? testnet addresses use the tbnb prefix and transactions are signed with the testnet chain id
 isTestNet = false
+# expected chain id of node_info.network in /status, such as Binance-Chain-Tigris or Binance-Chain-Nile
+# empty means Binance-Chain-Tigris on mainnet and any chain id but the mainnet one on testnet
+# scanning and signing are refused while the node serves another network
+chainID = ""
+# re-check cycle of the node's chain id, sample: 1m, 5m etc
+networkCheckCycle = "5m"
 # the safe address that wallet send money to.
 sumAddress = ""
 # when wallet's balance is over this value, the wallet willl send money to [sumAddress]
@@ -184,6 +348,27 @@ walletPassword = ""
 	return &c
 }
 
+//certPath 证书文件路径，相对路径时在证书目录下
+func (wc *WalletConfig) certPath(name string) string {
+	if len(name) == 0 || filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(wc.CertsDir, name)
+}
+
+//TransportOptions 节点请求的认证和传输设置
+func (wc *WalletConfig) TransportOptions() TransportOptions {
+	return TransportOptions{
+		User:        wc.RpcUser,
+		Password:    wc.RpcPassword,
+		BearerToken: wc.RpcBearerToken,
+		CAFile:      wc.certPath(wc.RpcCAFile),
+		CertFile:    wc.certPath(wc.RpcCertFile),
+		KeyFile:     wc.certPath(wc.RpcKeyFile),
+		Proxy:       wc.RpcProxy,
+	}
+}
+
 //printConfig Print config information
 func (wc *WalletConfig) PrintConfig() error {
 
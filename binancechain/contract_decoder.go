@@ -42,23 +42,31 @@ func (decoder *ContractDecoder) GetTokenBalanceByAddress(contract openwallet.Sma
 
 	 var tokenBalanceList []*openwallet.TokenBalance
 
-	for i := 0; i < len(address); i++ {
+	infos, err := decoder.wm.GetAccounts(address...)
+	if err != nil {
+		log.Error("Get balance of addresses failed with error : [%v]", err)
+		return nil, err
+	}
+
+	//调用方未提供小数位时使用代币登记表的信息
+	if contract.Decimals == 0 {
+		token := decoder.wm.TokenContract(contract.Address)
+		contract.Decimals = token.Decimals
+		if len(contract.Name) == 0 {
+			contract.Name = token.Name
+		}
+		if len(contract.Token) == 0 {
+			contract.Token = token.Token
+		}
+	}
+
+	for _, info := range infos {
 		tokenBalance := openwallet.TokenBalance{
 			Contract: &contract,
 		}
 
-		balance, err := decoder.wm.RpcClient.getBalance(address[i], contract.Address)
-		if err != nil {
-			log.Error("Get balance of address [%v] failed with error : [%v]", address[i], err)
-			return nil, err
-		}
-		tokenBalance.Balance = &openwallet.Balance{
-			Address:          address[i],
-			Symbol:           contract.Symbol,
-			Balance:          convertToAmountWithDecimal(balance.Balance.Uint64(), contract.Decimals),
-			ConfirmBalance:   convertToAmountWithDecimal(balance.Balance.Uint64(), contract.Decimals),
-			UnconfirmBalance: "0",
-		}
+		//冻结和锁定的余额计入UnconfirmBalance
+		tokenBalance.Balance = info.Balance(contract.Symbol, contract.Address, contract.Decimals)
 
 		tokenBalanceList = append(tokenBalanceList, &tokenBalance)
 	}
@@ -0,0 +1,676 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package binancechain
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/binance-chain/go-sdk/common/bech32"
+	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/tendermint/tendermint/crypto/secp256k1"
+	"github.com/tidwall/gjson"
+)
+
+//节点接口类型，对应配置rpcServerType
+const (
+	RpcServerTendermint = 0 //Tendermint RPC节点
+	RpcServerDex        = 1 //Binance DEX HTTP API，如加速节点
+)
+
+const (
+	dexAPIPrefix     = "/api/v1"
+	dexAmountDecimal = 8    //HTTP API中金额的小数位
+	dexTxsPageSize   = 1000 ///transactions单页最大数量
+)
+
+//DexClient 使用Binance DEX HTTP API的数据源，节点切换、重试和缓存由Client处理。
+//HTTP API没有区块hash、内存池、证明和签名区块头，不支持这些功能
+type DexClient struct {
+	Client *Client
+}
+
+//NewDexClient 创建使用Binance DEX HTTP API的客户端，调用失败时自动切换到其他节点
+func NewDexClient(urls []string, debug bool) *DexClient {
+	c := NewMultiNodeClient(urls, debug)
+	c.ServerType = RpcServerDex
+	return &DexClient{Client: c}
+}
+
+//isDex 节点是否为Binance DEX HTTP API，只影响健康检查接口和错误格式
+func (c *Client) isDex() bool {
+	return c.ServerType == RpcServerDex
+}
+
+func (d *DexClient) GetNodeStatus(ctx context.Context) (*NodeStatus, error) {
+	return d.Client.dexGetNodeStatusContext(ctx)
+}
+
+func (d *DexClient) GetBlockHeight(ctx context.Context) (uint64, error) {
+	status, err := d.Client.dexGetNodeStatusContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return status.LatestBlockHeight, nil
+}
+
+//GetBlockHash HTTP API不提供区块hash，区块扫描无法做分叉检查
+func (d *DexClient) GetBlockHash(ctx context.Context, height uint64) (string, error) {
+	return "", nil
+}
+
+func (d *DexClient) GetBlockByHeight(ctx context.Context, height uint64) (*Block, error) {
+	return d.Client.dexGetBlockByHeightContext(ctx, height)
+}
+
+func (d *DexClient) GetTransaction(ctx context.Context, txid string) (*Transaction, error) {
+	return d.Client.dexGetTransactionContext(ctx, txid)
+}
+
+func (d *DexClient) GetTxStatus(ctx context.Context, txid string) (TxStatus, error) {
+	return d.Client.dexGetTxStatusContext(ctx, txid)
+}
+
+func (d *DexClient) GetAccount(ctx context.Context, address string) (*AccountInfo, error) {
+	acc, err := d.Client.dexAccountContext(ctx, address, true)
+	if err != nil {
+		return nil, err
+	}
+	return NewAccountInfo(address, acc), nil
+}
+
+func (d *DexClient) GetAccounts(ctx context.Context, addresses []string) ([]*AccountInfo, error) {
+	return d.Client.batchAccountInfosContext(ctx, addresses, d.GetAccount)
+}
+
+func (d *DexClient) GetAccountSequence(ctx context.Context, address string) (int64, int64, error) {
+	acc, err := d.Client.dexAccountContext(ctx, address, false)
+	if err != nil {
+		return 0, 0, err
+	}
+	if acc == nil {
+		return 0, 0, errors.New("Failed to get account number and sequence!")
+	}
+	return acc.GetAccountNumber(), acc.GetSequence(), nil
+}
+
+//GetFeeSchedule HTTP API只提供最新的手续费参数，忽略height
+func (d *DexClient) GetFeeSchedule(ctx context.Context, height uint64) (*FeeSchedule, error) {
+	return d.Client.dexGetFeeScheduleContext(ctx)
+}
+
+func (d *DexClient) BroadcastTransaction(ctx context.Context, txHex string) (string, error) {
+	return d.Client.dexSendTransactionContext(ctx, txHex)
+}
+
+func (d *DexClient) GetAddressTransactions(ctx context.Context, query AddressTxQuery) ([]*Transaction, error) {
+	if err := query.validate(); err != nil {
+		return nil, err
+	}
+	return d.Client.dexSearchAddressTransactionsContext(ctx, query)
+}
+
+func (d *DexClient) GetToken(ctx context.Context, symbol string) (*types.Token, error) {
+	return d.Client.dexGetTokenContext(ctx, symbol)
+}
+
+func (d *DexClient) GetTokens(ctx context.Context, offset, limit int) ([]types.Token, error) {
+	return d.Client.dexGetTokensContext(ctx, offset, limit)
+}
+
+//dexUnsupported HTTP API没有提供的功能
+func dexUnsupported(feature string) error {
+	return &RPCError{Kind: ErrRPCFailed, Message: feature + " is not supported by DEX HTTP API"}
+}
+
+//dexGetNodeStatusContext 获取节点状态
+func (c *Client) dexGetNodeStatusContext(ctx context.Context) (*NodeStatus, error) {
+
+	/*
+		{
+			"node_info": {
+				"network": "Binance-Chain-Tigris",
+				...
+			},
+			"sync_info": {
+				"latest_block_hash": "A1D4...",
+				"latest_block_height": 12345,
+				"latest_block_time": "2019-06-01T08:00:00.000Z",
+				"catching_up": false
+			}
+		}
+	*/
+
+	resp, err := c.CallContext(ctx, dexAPIPrefix+"/node-info", nil, "GET")
+	if err != nil {
+		return nil, err
+	}
+
+	return newNodeStatus(*resp), nil
+}
+
+//dexGetBlockByHeightContext 通过/transactions-in-block获取区块中的交易单，
+//HTTP API不提供区块hash，Binance Chain出块即确认，扫描时不需要分叉检查
+func (c *Client) dexGetBlockByHeightContext(ctx context.Context, height uint64) (*Block, error) {
+
+	/*
+		{
+			"blockHeight": 12345,
+			"tx": [
+				{
+					"txHash": "A1D4...",
+					"blockHeight": 12345,
+					"txType": "TRANSFER",
+					"timeStamp": "2019-06-01T08:00:00.000Z",
+					...
+				}
+			]
+		}
+	*/
+
+	resp, err := c.CallContext(ctx, fmt.Sprintf("%s/transactions-in-block/%d", dexAPIPrefix, height), nil, "GET")
+	if err != nil {
+		return nil, err
+	}
+
+	obj := &Block{Height: height}
+	exist := make(map[string]bool)
+	for _, tx := range resp.Get("tx").Array() {
+		txid := strings.ToLower(tx.Get("txHash").String())
+		if len(txid) == 0 || exist[txid] {
+			continue
+		}
+		exist[txid] = true
+		obj.Transactions = append(obj.Transactions, txid)
+		if obj.Timestamp == 0 {
+			timestamp, _ := time.Parse(time.RFC3339Nano, tx.Get("timeStamp").String())
+			obj.Timestamp = uint64(timestamp.Unix())
+		}
+	}
+
+	return obj, nil
+}
+
+//dexGetTransactionContext 获取交易单，只解析转账消息
+func (c *Client) dexGetTransactionContext(ctx context.Context, txid string) (*Transaction, error) {
+
+	/*
+		{
+			"code": 0,
+			"hash": "A1D4...",
+			"height": "12345",
+			"log": "Msg 0: ",
+			"ok": true,
+			"tx": {
+				"type": "auth/StdTx",
+				"value": {
+					"memo": "",
+					"msg": [
+						{
+							"type": "cosmos-sdk/Send",
+							"value": {
+								"inputs": [{"address": "bnb1...", "coins": [{"amount": "100000000", "denom": "BNB"}]}],
+								"outputs": [{"address": "bnb1...", "coins": [{"amount": "100000000", "denom": "BNB"}]}]
+							}
+						}
+					]
+				}
+			}
+		}
+	*/
+
+	resp, err := c.dexGetTxContext(ctx, txid)
+	if err != nil {
+		return nil, err
+	}
+
+	return newDexTransaction(resp), nil
+}
+
+//dexGetTxContext 查询交易单的JSON结果，交易单不存在时返回ErrTxNotFound，返回的hash与请求不一致时返回ErrRPCFailed
+func (c *Client) dexGetTxContext(ctx context.Context, txid string) (*gjson.Result, error) {
+	resp, err := c.CallContext(ctx, dexAPIPrefix+"/tx/"+strings.ToUpper(txid)+"?format=json", nil, "GET")
+	if err != nil {
+		if rpcErr, ok := err.(*RPCError); ok && rpcErr.StatusCode == http.StatusNotFound {
+			return nil, &RPCError{Kind: ErrTxNotFound, StatusCode: rpcErr.StatusCode, Message: rpcErr.Message}
+		}
+		return nil, err
+	}
+
+	//HTTP API只返回JSON，无法按交易单内容校验，至少要求返回的hash与请求的一致
+	if hash := resp.Get("hash").String(); !strings.EqualFold(hash, txid) {
+		return nil, &RPCError{Kind: ErrRPCFailed, Message: "transaction hash " + hash + " doesn't match " + txid}
+	}
+	return resp, nil
+}
+
+//newDexTransaction 解析HTTP API返回的交易单，非转账交易返回nil
+func newDexTransaction(json *gjson.Result) *Transaction {
+
+	msgs := json.Get("tx.value.msg").Array()
+	if len(msgs) == 0 || msgs[0].Get("type").String() != "cosmos-sdk/Send" {
+		return nil
+	}
+
+	obj := Transaction{}
+	obj.TxDetails = make(map[string](*TxDetail))
+	obj.TxID = strings.ToUpper(json.Get("hash").String())
+	obj.BlockHeight = json.Get("height").Uint()
+	obj.Memo = json.Get("tx.value.memo").String()
+
+	detailOf := func(denom string) *TxDetail {
+		if obj.TxDetails[denom] == nil {
+			obj.TxDetails[denom] = &TxDetail{Denom: denom}
+		}
+		return obj.TxDetails[denom]
+	}
+
+	for _, input := range msgs[0].Get("value.inputs").Array() {
+		for _, coin := range input.Get("coins").Array() {
+			detail := detailOf(coin.Get("denom").String())
+			detail.From = append(detail.From, AddrAmount{input.Get("address").String(), coin.Get("amount").Uint()})
+		}
+	}
+
+	for _, output := range msgs[0].Get("value.outputs").Array() {
+		for _, coin := range output.Get("coins").Array() {
+			detail := detailOf(coin.Get("denom").String())
+			detail.To = append(detail.To, AddrAmount{output.Get("address").String(), coin.Get("amount").Uint()})
+		}
+	}
+
+	return &obj
+}
+
+//dexAccountContext 获取最新的账户并更新缓存，cached为true时优先使用缓存，账户不存在时返回nil
+func (c *Client) dexAccountContext(ctx context.Context, address string, cached bool) (types.Account, error) {
+
+	if cached {
+		if acc, ok := c.accounts.get(address, 0); ok {
+			return acc, nil
+		}
+	}
+
+	if _, err := DecodeAddress(address, c.AddressPrefix); err != nil {
+		return nil, err
+	}
+
+	acc, err := c.dexGetAccountContext(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	c.accounts.set(address, 0, acc)
+
+	return acc, nil
+}
+
+//dexGetAccountContext 获取最新的账户，账户不存在时返回nil
+func (c *Client) dexGetAccountContext(ctx context.Context, address string) (types.Account, error) {
+
+	/*
+		{
+			"account_number": 12,
+			"address": "bnb1...",
+			"balances": [
+				{"free": "1.00000000", "frozen": "0.00000000", "locked": "0.00000000", "symbol": "BNB"}
+			],
+			"flags": 0,
+			"public_key": [3, 186, ...],
+			"sequence": 3
+		}
+	*/
+
+	resp, err := c.CallContext(ctx, dexAPIPrefix+"/account/"+address, nil, "GET")
+	if err != nil {
+		if rpcErr, ok := err.(*RPCError); ok && rpcErr.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	_, hash, err := bech32.DecodeAndConvert(address)
+	if err != nil {
+		return nil, err
+	}
+
+	acc := &types.AppAccount{
+		BaseAccount: types.BaseAccount{
+			Address:       types.AccAddress(hash),
+			AccountNumber: resp.Get("account_number").Int(),
+			Sequence:      resp.Get("sequence").Int(),
+		},
+		Flags: resp.Get("flags").Uint(),
+	}
+
+	pubKey := make([]byte, 0)
+	for _, b := range resp.Get("public_key").Array() {
+		pubKey = append(pubKey, byte(b.Uint()))
+	}
+	if len(pubKey) == secp256k1.PubKeySecp256k1Size {
+		var key secp256k1.PubKeySecp256k1
+		copy(key[:], pubKey)
+		acc.BaseAccount.PubKey = key
+	}
+
+	for _, balance := range resp.Get("balances").Array() {
+		denom := balance.Get("symbol").String()
+		if free := dexAmount(balance.Get("free")); free > 0 {
+			acc.BaseAccount.Coins = append(acc.BaseAccount.Coins, types.Coin{Denom: denom, Amount: free})
+		}
+		if frozen := dexAmount(balance.Get("frozen")); frozen > 0 {
+			acc.FrozenCoins = append(acc.FrozenCoins, types.Coin{Denom: denom, Amount: frozen})
+		}
+		if locked := dexAmount(balance.Get("locked")); locked > 0 {
+			acc.LockedCoins = append(acc.LockedCoins, types.Coin{Denom: denom, Amount: locked})
+		}
+	}
+
+	return acc, nil
+}
+
+//dexAmount HTTP API中带8位小数的金额转为最小单位
+func dexAmount(amount gjson.Result) int64 {
+	return int64(convertFromAmount(amount.String(), dexAmountDecimal))
+}
+
+//dexGetFeeScheduleContext 获取最新的手续费参数，HTTP API不提供历史高度的参数
+func (c *Client) dexGetFeeScheduleContext(ctx context.Context) (*FeeSchedule, error) {
+
+	/*
+		[
+			{"msg_type": "submit_proposal", "fee": 1000000000, "fee_for": 1},
+			{"fixed_fee_params": {"msg_type": "send", "fee": 37500, "fee_for": 1}, "multi_transfer_fee": 30000, "lower_limit_as_multi": 2},
+			{"dex_fee_fields": [{"fee_name": "ExpireFee", "fee_value": 25000}]}
+		]
+	*/
+
+	if schedule, ok := c.fees.get(0); ok {
+		return schedule, nil
+	}
+
+	resp, err := c.CallContext(ctx, dexAPIPrefix+"/fees", nil, "GET")
+	if err != nil {
+		return nil, err
+	}
+
+	params := make([]types.FeeParam, 0)
+	for _, param := range resp.Array() {
+		switch {
+		case param.Get("fixed_fee_params").Exists():
+			params = append(params, &types.TransferFeeParam{
+				FixedFeeParams:    dexFixedFeeParams(param.Get("fixed_fee_params")),
+				MultiTransferFee:  param.Get("multi_transfer_fee").Int(),
+				LowerLimitAsMulti: param.Get("lower_limit_as_multi").Int(),
+			})
+		case param.Get("dex_fee_fields").Exists():
+			fields := make([]types.DexFeeField, 0)
+			for _, field := range param.Get("dex_fee_fields").Array() {
+				fields = append(fields, types.DexFeeField{FeeName: field.Get("fee_name").String(), FeeValue: field.Get("fee_value").Int()})
+			}
+			params = append(params, &types.DexFeeParam{DexFeeFields: fields})
+		case param.Get("msg_type").Exists():
+			fixed := dexFixedFeeParams(param)
+			params = append(params, &fixed)
+		}
+	}
+	if len(params) == 0 {
+		return nil, &RPCError{Kind: ErrRPCFailed, Message: "Get fee failed!"}
+	}
+
+	schedule := NewFeeSchedule(0, params)
+	digest := sha256.Sum256([]byte(resp.Raw))
+	schedule.digest = string(digest[:])
+
+	c.fees.set(true, schedule)
+
+	return schedule, nil
+}
+
+func dexFixedFeeParams(param gjson.Result) types.FixedFeeParams {
+	return types.FixedFeeParams{
+		MsgType: param.Get("msg_type").String(),
+		Fee:     param.Get("fee").Int(),
+		FeeFor:  types.FeeDistributeType(param.Get("fee_for").Int()),
+	}
+}
+
+//dexSendTransactionContext 通过/broadcast?sync=true广播交易单，等待CheckTx的结果
+func (c *Client) dexSendTransactionContext(ctx context.Context, txHex string) (string, error) {
+
+	/*
+		[
+			{
+				"code": 0,
+				"hash": "A1D4...",
+				"log": "",
+				"ok": true
+			}
+		]
+	*/
+
+	resp, err := c.CallContext(ctx, dexAPIPrefix+"/broadcast?sync=true", []byte(txHex), "POST")
+	if err != nil {
+		return "", err
+	}
+
+	result := resp.Get("0")
+	if !result.Exists() {
+		return "", &RPCError{Kind: ErrRPCFailed, Message: "Response is empty! "}
+	}
+	if code := result.Get("code").Int(); code != 0 || !result.Get("ok").Bool() {
+		return "", &RPCError{Kind: ErrCheckTxFailed, StatusCode: http.StatusOK, Code: code, Message: result.Get("log").String()}
+	}
+
+	//账户序号和余额已改变
+	c.accounts.purge()
+
+	return strings.ToUpper(result.Get("hash").String()), nil
+}
+
+//dexSearchAddressTransactionsContext 通过/transactions分页查询地址的转账记录，HTTP API按高度从新到旧返回
+func (c *Client) dexSearchAddressTransactionsContext(ctx context.Context, q AddressTxQuery) ([]*Transaction, error) {
+
+	if q.Ascending {
+		return nil, dexUnsupported("ascending address history")
+	}
+
+	//单个地址且不限制高度时由节点分页，否则每个地址从头查询后合并
+	single := len(q.Addresses) == 1 && q.MinHeight == 0 && q.MaxHeight == 0
+
+	sources := make([][]searchedTx, 0, len(q.Addresses))
+	for _, addr := range q.Addresses {
+		offset, want := 0, q.want()
+		if single {
+			offset, want = q.Offset, q.Limit
+			if offset < 0 {
+				offset = 0
+			}
+			if want <= 0 {
+				want = -1
+			}
+		}
+		txs, err := c.dexTransactionsContext(ctx, addr, q, offset, want)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, txs)
+	}
+
+	if single {
+		q.Offset = 0
+	}
+	return mergeAddressTxs(q, sources...), nil
+}
+
+//dexTransactionsContext 从offset开始逐页查询地址的转账记录，直到找到want个符合条件的交易单或查完全部结果
+func (c *Client) dexTransactionsContext(ctx context.Context, address string, q AddressTxQuery, offset, want int) ([]searchedTx, error) {
+
+	/*
+		{
+			"total": 1,
+			"tx": [
+				{
+					"txHash": "A1D4...",
+					"blockHeight": 12345,
+					"txType": "TRANSFER",
+					"fromAddr": "bnb1...",
+					"toAddr": "bnb1...",
+					"value": "1.00000000",
+					"txAsset": "BNB",
+					"memo": ""
+				}
+			]
+		}
+	*/
+
+	found := make([]searchedTx, 0)
+
+	for {
+		limit := dexTxsPageSize
+		if want > 0 && want-len(found) < limit {
+			limit = want - len(found)
+		}
+
+		query := url.Values{}
+		query.Set("address", address)
+		query.Set("txType", "TRANSFER")
+		if len(q.Denom) > 0 {
+			query.Set("txAsset", q.Denom)
+		}
+		query.Set("offset", fmt.Sprintf("%d", offset))
+		query.Set("limit", fmt.Sprintf("%d", limit))
+
+		resp, err := c.CallContext(ctx, dexAPIPrefix+"/transactions?"+query.Encode(), nil, "GET")
+		if err != nil {
+			return nil, err
+		}
+
+		txs := resp.Get("tx").Array()
+		for _, tx := range txs {
+			height := tx.Get("blockHeight").Uint()
+			if q.MinHeight > 0 && height < q.MinHeight {
+				//更早的记录都低于最低高度
+				return found, nil
+			}
+			trx := newDexTransferRow(tx)
+			if trx == nil {
+				//多输入或多输出的转账只有汇总记录，查询完整的交易单
+				trx, err = c.dexGetTransactionContext(ctx, tx.Get("txHash").String())
+				if err != nil {
+					return nil, err
+				}
+				if trx != nil {
+					trx.BlockHeight = height
+				}
+			}
+			if !q.match(trx) {
+				continue
+			}
+			found = append(found, searchedTx{trx: trx})
+			if want > 0 && len(found) >= want {
+				return found, nil
+			}
+		}
+
+		offset += len(txs)
+		if len(txs) == 0 || uint64(offset) >= resp.Get("total").Uint() {
+			return found, nil
+		}
+	}
+}
+
+//newDexTransferRow 解析/transactions中单输入单输出的转账记录，多输入或多输出的转账返回nil
+func newDexTransferRow(tx gjson.Result) *Transaction {
+
+	from, to := tx.Get("fromAddr").String(), tx.Get("toAddr").String()
+	if len(from) == 0 || len(to) == 0 || tx.Get("hasChildren").Int() != 0 {
+		return nil
+	}
+
+	denom := tx.Get("txAsset").String()
+	amount := uint64(dexAmount(tx.Get("value")))
+	return &Transaction{
+		TxID:        strings.ToUpper(tx.Get("txHash").String()),
+		BlockHeight: tx.Get("blockHeight").Uint(),
+		Memo:        tx.Get("memo").String(),
+		TxDetails: map[string](*TxDetail){
+			denom: {
+				Denom: denom,
+				From:  []AddrAmount{{from, amount}},
+				To:    []AddrAmount{{to, amount}},
+			},
+		},
+	}
+}
+
+//dexGetTokensContext 通过/tokens分页获取代币信息
+func (c *Client) dexGetTokensContext(ctx context.Context, offset, limit int) ([]types.Token, error) {
+
+	/*
+		[
+			{
+				"mintable": false,
+				"name": "Binance Chain Native Token",
+				"original_symbol": "BNB",
+				"owner": "bnb1...",
+				"symbol": "BNB",
+				"total_supply": "200000000.00000000"
+			}
+		]
+	*/
+
+	resp, err := c.CallContext(ctx, fmt.Sprintf("%s/tokens?offset=%d&limit=%d", dexAPIPrefix, offset, limit), nil, "GET")
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make([]types.Token, 0)
+	for _, token := range resp.Array() {
+		_, owner, _ := bech32.DecodeAndConvert(token.Get("owner").String())
+		tokens = append(tokens, types.Token{
+			Name:        token.Get("name").String(),
+			Symbol:      token.Get("symbol").String(),
+			OrigSymbol:  token.Get("original_symbol").String(),
+			TotalSupply: types.Fixed8(dexAmount(token.Get("total_supply"))),
+			Owner:       types.AccAddress(owner),
+			Mintable:    token.Get("mintable").Bool(),
+		})
+	}
+
+	return tokens, nil
+}
+
+//dexGetTxStatusContext 查询交易单的上链结果
+func (c *Client) dexGetTxStatusContext(ctx context.Context, txid string) (TxStatus, error) {
+
+	resp, err := c.dexGetTxContext(ctx, txid)
+	if err != nil {
+		return TxStatus{}, err
+	}
+
+	return TxStatus{
+		TxID:   txid,
+		Height: resp.Get("height").Uint(),
+		Code:   uint32(resp.Get("code").Uint()),
+		Log:    resp.Get("log").String(),
+	}, nil
+}
@@ -0,0 +1,150 @@
+package binancechain
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/astaxie/beego/config"
+	"github.com/binance-chain/go-sdk/common/bech32"
+)
+
+func Test_dexClient(t *testing.T) {
+	const (
+		addr    = "bnb1grpf0955h0ykzq3ar5nmum7y6gdfl6lxfn46h2"
+		txid    = "A1D4B2F8F4C1F3EA0B8A8E4B6A2E2F5C3B9F7E1D0C2B4A6987F5E3D1C0B2A4F6"
+		rawTxID = "C1D4B2F8F4C1F3EA0B8A8E4B6A2E2F5C3B9F7E1D0C2B4A6987F5E3D1C0B2A4F6"
+		multiID = "E1D4B2F8F4C1F3EA0B8A8E4B6A2E2F5C3B9F7E1D0C2B4A6987F5E3D1C0B2A4F6"
+		forged  = "F1D4B2F8F4C1F3EA0B8A8E4B6A2E2F5C3B9F7E1D0C2B4A6987F5E3D1C0B2A4F6"
+	)
+
+	broadcast := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/v1/node-info":
+			fmt.Fprint(w, `{"node_info":{"network":"Binance-Chain-Tigris"},"sync_info":{"latest_block_height":12345,"catching_up":false}}`)
+		case r.URL.Path == "/api/v1/account/"+addr:
+			fmt.Fprintf(w, `{"account_number":12,"address":"%s","balances":[{"free":"1.50000000","frozen":"0.20000000","locked":"0.00000000","symbol":"BNB"}],"flags":0,"public_key":null,"sequence":3}`, addr)
+		case strings.HasPrefix(r.URL.Path, "/api/v1/account/"):
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"code":404,"message":"account not found"}`)
+		case r.URL.Path == "/api/v1/fees":
+			fmt.Fprint(w, `[{"msg_type":"submit_proposal","fee":1000000000,"fee_for":1},{"fixed_fee_params":{"msg_type":"send","fee":37500,"fee_for":1},"multi_transfer_fee":30000,"lower_limit_as_multi":2},{"dex_fee_fields":[{"fee_name":"ExpireFee","fee_value":25000}]}]`)
+		case r.URL.Path == "/api/v1/broadcast":
+			body, _ := ioutil.ReadAll(r.Body)
+			broadcast = string(body)
+			fmt.Fprintf(w, `[{"code":0,"hash":"%s","log":"","ok":true}]`, rawTxID)
+		case r.URL.Path == "/api/v1/tx/"+txid:
+			fmt.Fprintf(w, `{"code":0,"hash":"%s","height":"12000","log":"Msg 0: ","ok":true,"tx":{"type":"auth/StdTx","value":{"memo":"10086","msg":[{"type":"cosmos-sdk/Send","value":{"inputs":[{"address":"bnb1from","coins":[{"amount":"100000000","denom":"BNB"}]}],"outputs":[{"address":"%s","coins":[{"amount":"100000000","denom":"BNB"}]}]}}]}}}`, txid, addr)
+		case r.URL.Path == "/api/v1/tx/"+multiID:
+			fmt.Fprintf(w, `{"code":0,"hash":"%s","height":"11990","log":"Msg 0: ","ok":true,"tx":{"type":"auth/StdTx","value":{"memo":"","msg":[{"type":"cosmos-sdk/Send","value":{"inputs":[{"address":"bnb1from","coins":[{"amount":"300000000","denom":"BNB"}]}],"outputs":[{"address":"%s","coins":[{"amount":"100000000","denom":"BNB"}]},{"address":"bnb1other","coins":[{"amount":"200000000","denom":"BNB"}]}]}}]}}}`, multiID, addr)
+		case r.URL.Path == "/api/v1/tx/"+forged:
+			//返回了其它交易单
+			fmt.Fprintf(w, `{"code":0,"hash":"%s","height":"12000","log":"Msg 0: ","ok":true,"tx":{"type":"auth/StdTx","value":{"memo":"","msg":[]}}}`, txid)
+		case strings.HasPrefix(r.URL.Path, "/api/v1/tx/"):
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"code":404,"message":"tx not found"}`)
+		case r.URL.Path == "/api/v1/transactions-in-block/12000":
+			fmt.Fprintf(w, `{"blockHeight":12000,"tx":[{"txHash":"%s","blockHeight":12000,"txType":"TRANSFER","timeStamp":"2019-06-01T08:00:00.000Z"}]}`, txid)
+		case r.URL.Path == "/api/v1/transactions":
+			if r.URL.Query().Get("address") != addr || r.URL.Query().Get("offset") != "10" || r.URL.Query().Get("limit") != "5" {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"code":400,"message":"unexpected query"}`)
+				return
+			}
+			//多输出的转账只有汇总记录
+			fmt.Fprintf(w, `{"total":12,"tx":[{"txHash":"%s","blockHeight":12000,"txType":"TRANSFER","fromAddr":"bnb1from","toAddr":"%s","value":"1.00000000","txAsset":"BNB","memo":"10086"},{"txHash":"%s","blockHeight":11990,"txType":"TRANSFER","fromAddr":"bnb1from","toAddr":null,"value":"3.00000000","txAsset":"BNB","hasChildren":1}]}`, txid, addr, multiID)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"code":404,"message":"not found"}`)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	c := NewDexClient([]string{server.URL}, false)
+	c.Client.SetRetry(0, 0)
+
+	height, err := c.GetBlockHeight(ctx)
+	if err != nil || height != 12345 {
+		t.Errorf("unexpected block height: %d, %v", height, err)
+	}
+
+	info, err := c.GetAccount(ctx, addr)
+	if err != nil {
+		t.Fatalf("get account failed unexpected error: %v", err)
+	}
+	if bnb := info.Coin("BNB"); info.AccountNumber != 12 || info.Sequence != 3 || bnb.Free != 150000000 || bnb.Frozen != 20000000 {
+		t.Errorf("unexpected account: %+v", info)
+	}
+
+	empty, _ := bech32.ConvertAndEncode("bnb", make([]byte, 20))
+	missing, err := c.GetAccount(ctx, empty)
+	if err != nil || missing.Coin("BNB").Free != 0 {
+		t.Errorf("missing account should have zero balance, got: %v, %v", missing, err)
+	}
+
+	schedule, err := c.GetFeeSchedule(ctx, 12000)
+	if err != nil {
+		t.Fatalf("get fee failed unexpected error: %v", err)
+	}
+	if schedule.TransferFeeOf(1) != 37500 || schedule.TransferFeeOf(3) != 90000 || schedule.Dex["ExpireFee"] != 25000 {
+		t.Errorf("unexpected fee schedule: %+v", schedule)
+	}
+
+	hash, err := c.BroadcastTransaction(ctx, "c001d0de")
+	if err != nil || hash != rawTxID || broadcast != "c001d0de" {
+		t.Errorf("unexpected broadcast result: %s, %v, body: %s", hash, err, broadcast)
+	}
+
+	trx, err := c.GetTransaction(ctx, txid)
+	if err != nil {
+		t.Fatalf("get transaction failed unexpected error: %v", err)
+	}
+	if trx.BlockHeight != 12000 || trx.Memo != "10086" || trx.TxDetails["BNB"].To[0].Address != addr || trx.TxDetails["BNB"].To[0].Amount != 100000000 {
+		t.Errorf("unexpected transaction: %+v", trx)
+	}
+
+	if _, err := c.GetTransaction(ctx, rawTxID); ErrorKind(err) != ErrTxNotFound {
+		t.Errorf("expected transaction not found, got: %v", err)
+	}
+	if _, err := c.GetTransaction(ctx, strings.ToLower(txid)); err != nil {
+		t.Errorf("lowercase txid failed unexpected error: %v", err)
+	}
+	if _, err := c.GetTransaction(ctx, forged); ErrorKind(err) != ErrRPCFailed {
+		t.Errorf("expected mismatched transaction hash refused, got: %v", err)
+	}
+	if _, err := c.GetTxStatus(ctx, forged); ErrorKind(err) != ErrRPCFailed {
+		t.Errorf("expected mismatched transaction status refused, got: %v", err)
+	}
+
+	block, err := c.GetBlockByHeight(ctx, 12000)
+	if err != nil || len(block.Transactions) != 1 || block.Transactions[0] != strings.ToLower(txid) {
+		t.Errorf("unexpected block: %+v, %v", block, err)
+	}
+
+	trxs, err := c.GetAddressTransactions(ctx, AddressTxQuery{Addresses: []string{addr}, Offset: 10, Limit: 5})
+	if err != nil || len(trxs) != 2 || trxs[0].TxDetails["BNB"].From[0].Amount != 100000000 {
+		t.Fatalf("unexpected address transactions: %v, %v", trxs, err)
+	}
+	if multi := trxs[1].TxDetails["BNB"]; trxs[1].TxID != multiID || trxs[1].BlockHeight != 11990 || len(multi.To) != 2 || multi.To[0].Address != addr {
+		t.Errorf("unexpected multi-output transaction: %+v", trxs[1])
+	}
+
+	var backend ChainBackend = c
+	if _, ok := backend.(MemPoolBackend); ok {
+		t.Errorf("mempool scan should not be supported")
+	}
+
+	//HTTP API不提供/commit，不能开启轻客户端验证
+	for _, verify := range []string{"verifyBlockCommit", "verifyQueryProof"} {
+		conf, _ := config.NewConfigData("ini", []byte("rpcServerType = 1\nserverAPI = "+server.URL+"\n"+verify+" = true\n"))
+		if err := NewWalletManager().LoadAssetsConfig(conf); err == nil {
+			t.Errorf("expected %s refused with the DEX HTTP API", verify)
+		}
+	}
+}
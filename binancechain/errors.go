@@ -0,0 +1,178 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package binancechain
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+//节点调用错误类别
+var (
+	ErrNodeUnavailable = errors.New("node unavailable")      //节点无法访问、超时或内部错误
+	ErrHeightNotFound  = errors.New("height not available")  //区块高度不存在或未同步
+	ErrTxNotFound      = errors.New("transaction not found") //交易单不存在
+	ErrTokenNotFound   = errors.New("token not found")       //代币未发行
+	ErrRateLimited     = errors.New("rate limited")          //请求过于频繁
+	ErrCheckTxFailed   = errors.New("check tx failed")       //广播的交易单未通过CheckTx
+	ErrProofInvalid    = errors.New("proof invalid")         //查询结果无法通过Merkle证明验证
+	ErrBlockUnverified = errors.New("block unverified")      //区块头无法通过验证人签名验证
+	ErrNetworkMismatch = errors.New("network mismatch")      //节点所在网络与配置的网络或链ID不一致
+	ErrRPCFailed       = errors.New("rpc request failed")    //其他无法重试的错误
+)
+
+//RPCError 节点调用错误，Kind为错误类别
+type RPCError struct {
+	Kind       error  //错误类别
+	StatusCode int    //HTTP状态码
+	Code       int64  //JSON-RPC错误码
+	Message    string //错误信息
+}
+
+func (e *RPCError) Error() string {
+	if e.Code != 0 {
+		return fmt.Sprintf("%s: [%d]%s", e.Kind.Error(), e.Code, e.Message)
+	}
+	if e.StatusCode != 0 && e.StatusCode != http.StatusOK {
+		return fmt.Sprintf("%s: [HTTP %d]%s", e.Kind.Error(), e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Kind.Error(), e.Message)
+}
+
+//Unwrap 返回错误类别
+func (e *RPCError) Unwrap() error {
+	return e.Kind
+}
+
+//ErrorKind 错误类别，非节点调用错误原样返回
+func ErrorKind(err error) error {
+	if rpcErr, ok := err.(*RPCError); ok {
+		return rpcErr.Kind
+	}
+	return err
+}
+
+//IsRetryable 错误是否可以重试
+func IsRetryable(err error) bool {
+	switch ErrorKind(err) {
+	case ErrNodeUnavailable, ErrRateLimited:
+		return true
+	}
+	return false
+}
+
+//shouldFailover 错误是否需要切换到其他节点
+func shouldFailover(err error) bool {
+	return IsRetryable(err) || ErrorKind(err) == ErrHeightNotFound
+}
+
+//newRPCError 根据HTTP状态码和JSON-RPC错误生成节点调用错误
+func newRPCError(statusCode int, body []byte) *RPCError {
+
+	/*
+		//failed 返回错误
+		{
+			"jsonrpc": "2.0",
+			"id": "",
+			"error": {
+				"code": -32603,
+				"message": "Internal error",
+				"data": "Height 100 must be less than or equal to the current blockchain height 50"
+			}
+		}
+	*/
+
+	result := gjson.ParseBytes(body)
+	if result.Get("error").IsObject() {
+		code := result.Get("error.code").Int()
+		message := result.Get("error.message").String()
+		if data := result.Get("error.data").String(); len(data) > 0 {
+			message = message + ": " + data
+		}
+		return &RPCError{
+			Kind:       classifyError(statusCode, message),
+			StatusCode: statusCode,
+			Code:       code,
+			Message:    message,
+		}
+	}
+
+	/*
+		//DEX HTTP API 返回错误
+		{
+			"code": 404,
+			"message": "account not found"
+		}
+	*/
+
+	if message := result.Get("message").String(); len(message) > 0 {
+		return &RPCError{
+			Kind:       classifyError(statusCode, message),
+			StatusCode: statusCode,
+			Message:    message,
+		}
+	}
+
+	return &RPCError{
+		Kind:       statusErrorKind(statusCode),
+		StatusCode: statusCode,
+		Message:    strings.TrimSpace(string(body)),
+	}
+}
+
+//classifyError 先按HTTP状态码判断错误类别，反向代理返回的429和5xx即使带有JSON-RPC错误也可以重试，
+//其他状态码再按错误信息判断
+func classifyError(statusCode int, message string) error {
+	if kind := statusErrorKind(statusCode); kind != ErrRPCFailed {
+		return kind
+	}
+	return classifyRPCError(message)
+}
+
+//statusErrorKind 根据HTTP状态码判断错误类别
+func statusErrorKind(statusCode int) error {
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case statusCode >= http.StatusInternalServerError, statusCode == http.StatusRequestTimeout:
+		return ErrNodeUnavailable
+	}
+	return ErrRPCFailed
+}
+
+//classifyRPCError 根据Tendermint返回的错误信息判断错误类别
+func classifyRPCError(message string) error {
+	msg := strings.ToLower(message)
+	switch {
+	case strings.Contains(msg, "too many requests"):
+		return ErrRateLimited
+	case strings.Contains(msg, "must be less than or equal to the current blockchain height"),
+		strings.Contains(msg, "height") && strings.Contains(msg, "not available"),
+		strings.Contains(msg, "could not find results for height"),
+		strings.Contains(msg, "height must be greater than 0"):
+		return ErrHeightNotFound
+	case strings.Contains(msg, "tx (") && strings.Contains(msg, "not found"),
+		strings.Contains(msg, "transaction") && strings.Contains(msg, "not found"):
+		return ErrTxNotFound
+	case strings.Contains(msg, "timed out"), strings.Contains(msg, "timeout"):
+		return ErrNodeUnavailable
+	}
+	return ErrRPCFailed
+}
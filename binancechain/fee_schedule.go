@@ -0,0 +1,289 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package binancechain
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/blocktree/openwallet/log"
+)
+
+const (
+	defaultFeeCacheTTL = 1 * time.Minute //默认最新手续费的缓存有效期
+)
+
+//手续费参数中的消息类型，来自/param/fees的msg_type
+const (
+	FeeMsgSend            = "send"
+	FeeMsgOrderNew        = "orderNew"
+	FeeMsgOrderCancel     = "orderCancel"
+	FeeMsgDexList         = "dexList"
+	FeeMsgIssue           = "issueMsg"
+	FeeMsgMint            = "mintMsg"
+	FeeMsgBurn            = "tokensBurn"
+	FeeMsgFreeze          = "tokensFreeze"
+	FeeMsgTimeLock        = "timeLock"
+	FeeMsgTimeUnlock      = "timeUnlock"
+	FeeMsgTimeRelock      = "timeRelock"
+	FeeMsgSetAccountFlags = "setAccountFlags"
+	FeeMsgSubmitProposal  = "submit_proposal"
+	FeeMsgDeposit         = "deposit"
+	FeeMsgVote            = "vote"
+)
+
+//FixedFee 固定手续费
+type FixedFee struct {
+	MsgType string
+	Fee     int64
+	FeeFor  types.FeeDistributeType //手续费分配方式
+}
+
+//TransferFee 转账手续费
+type TransferFee struct {
+	Fee               int64 //单笔转账手续费
+	MultiTransferFee  int64 //批量转账每个输出的手续费
+	LowerLimitAsMulti int64 //输出数量达到该值时按批量转账收费
+	FeeFor            types.FeeDistributeType
+}
+
+//FeeSchedule 某个高度的全部手续费参数
+type FeeSchedule struct {
+	Height   uint64              //查询的高度
+	Fixed    map[string]FixedFee //按消息类型的固定手续费
+	Transfer TransferFee         //转账手续费
+	Dex      map[string]int64    //撮合交易手续费
+	digest   string              //参数摘要，用于判断参数是否变化
+}
+
+//NewFeeSchedule 根据/param/fees返回的参数生成手续费表
+func NewFeeSchedule(height uint64, params []types.FeeParam) *FeeSchedule {
+	obj := &FeeSchedule{
+		Height: height,
+		Fixed:  make(map[string]FixedFee),
+		Dex:    make(map[string]int64),
+	}
+
+	for _, param := range params {
+		switch p := param.(type) {
+		case *types.FixedFeeParams:
+			obj.Fixed[p.MsgType] = FixedFee{MsgType: p.MsgType, Fee: p.Fee, FeeFor: p.FeeFor}
+		case *types.TransferFeeParam:
+			obj.Transfer = TransferFee{
+				Fee:               p.Fee,
+				MultiTransferFee:  p.MultiTransferFee,
+				LowerLimitAsMulti: p.LowerLimitAsMulti,
+				FeeFor:            p.FeeFor,
+			}
+			obj.Fixed[p.MsgType] = FixedFee{MsgType: p.MsgType, Fee: p.Fee, FeeFor: p.FeeFor}
+		case *types.DexFeeParam:
+			for _, field := range p.DexFeeFields {
+				obj.Dex[field.FeeName] = field.FeeValue
+			}
+		}
+	}
+
+	return obj
+}
+
+//Fee 指定消息类型的固定手续费
+func (fs *FeeSchedule) Fee(msgType string) (int64, bool) {
+	fee, exist := fs.Fixed[msgType]
+	if !exist {
+		return 0, false
+	}
+	return fee.Fee, true
+}
+
+//TransferFeeOf 转账手续费，outputs为全部输出的币种数量之和，
+//达到LowerLimitAsMulti时每个输出按MultiTransferFee收费
+func (fs *FeeSchedule) TransferFeeOf(outputs int) int64 {
+	if outputs > 1 && fs.Transfer.LowerLimitAsMulti > 0 && int64(outputs) >= fs.Transfer.LowerLimitAsMulti {
+		return fs.Transfer.MultiTransferFee * int64(outputs)
+	}
+	return fs.Transfer.Fee
+}
+
+//feeRange 手续费参数相同的高度区间
+type feeRange struct {
+	from     uint64
+	to       uint64
+	schedule *FeeSchedule
+}
+
+//feeCache 按高度区间缓存手续费参数，最新参数定期刷新，参数变化时开始新的区间
+type feeCache struct {
+	mu       sync.Mutex
+	TTL      time.Duration
+	ranges   []*feeRange //按from排序
+	latest   *FeeSchedule
+	latestAt time.Time
+}
+
+func newFeeCache(ttl time.Duration) *feeCache {
+	return &feeCache{TTL: ttl}
+}
+
+//get 查找缓存的手续费，height为0表示最新
+func (fc *feeCache) get(height uint64) (*FeeSchedule, bool) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	if height == 0 {
+		if fc.latest != nil && time.Since(fc.latestAt) < fc.TTL {
+			return fc.latest, true
+		}
+		return nil, false
+	}
+
+	for _, r := range fc.ranges {
+		if r.from <= height && height <= r.to {
+			return r.schedule, true
+		}
+	}
+	return nil, false
+}
+
+//set 保存查询到的手续费，与紧邻区间参数相同时合并区间
+func (fc *feeCache) set(latest bool, schedule *FeeSchedule) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	if latest {
+		if fc.latest != nil && fc.latest.digest != schedule.digest {
+			log.Std.Warning("fee params changed on height: %d", schedule.Height)
+		}
+		fc.latest = schedule
+		fc.latestAt = time.Now()
+	}
+
+	height := schedule.Height
+	if height == 0 {
+		return
+	}
+
+	var prev, next *feeRange
+	for _, r := range fc.ranges {
+		if r.from <= height && height <= r.to {
+			return
+		}
+		if r.to < height {
+			prev = r
+		} else if next == nil {
+			next = r
+		}
+	}
+
+	//只合并紧邻的高度，两个采样高度之间参数可能改过又改回，不能按摘要相同推断中间高度
+	joinPrev := prev != nil && prev.to+1 == height && prev.schedule.digest == schedule.digest
+	joinNext := next != nil && height+1 == next.from && next.schedule.digest == schedule.digest
+
+	switch {
+	case joinPrev && joinNext:
+		prev.to = next.to
+		fc.remove(next)
+	case joinPrev:
+		prev.to = height
+	case joinNext:
+		next.from = height
+	default:
+		fc.ranges = append(fc.ranges, &feeRange{from: height, to: height, schedule: schedule})
+		sort.Slice(fc.ranges, func(i, j int) bool {
+			return fc.ranges[i].from < fc.ranges[j].from
+		})
+	}
+}
+
+//remove 删除区间，调用方需持有锁
+func (fc *feeCache) remove(target *feeRange) {
+	for i, r := range fc.ranges {
+		if r == target {
+			fc.ranges = append(fc.ranges[:i], fc.ranges[i+1:]...)
+			return
+		}
+	}
+}
+
+//purge 清空缓存
+func (fc *feeCache) purge() {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.ranges = nil
+	fc.latest = nil
+}
+
+//SetFeeCacheTTL 设置最新手续费的缓存有效期
+func (c *Client) SetFeeCacheTTL(ttl time.Duration) {
+	c.fees.mu.Lock()
+	defer c.fees.mu.Unlock()
+	if ttl >= 0 {
+		c.fees.TTL = ttl
+	}
+}
+
+//getFeeSchedule 获取指定高度的手续费表，height为0时获取最新
+func (c *Client) getFeeSchedule(height uint64) (*FeeSchedule, error) {
+	return c.getFeeScheduleContext(context.Background(), height)
+}
+
+func (c *Client) getFeeScheduleContext(ctx context.Context, height uint64) (*FeeSchedule, error) {
+
+	if schedule, ok := c.fees.get(height); ok {
+		return schedule, nil
+	}
+
+	path := fmt.Sprintf("/abci_query?path=\"/param/fees\"&height=%d", height)
+
+	resp, err := c.CallContext(ctx, path, nil, "GET")
+	if err != nil {
+		return nil, err
+	}
+
+	response := resp.Get("result").Get("response")
+	data, err := base64.StdEncoding.DecodeString(response.Get("value").String())
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("Get fee failed!")
+	}
+
+	var params []types.FeeParam
+	err = cdc.UnmarshalBinaryLengthPrefixed(data, &params)
+	if err != nil {
+		return nil, err
+	}
+
+	queryHeight := height
+	if queryHeight == 0 {
+		queryHeight = response.Get("height").Uint()
+	}
+
+	schedule := NewFeeSchedule(queryHeight, params)
+	digest := sha256.Sum256(data)
+	schedule.digest = string(digest[:])
+
+	c.fees.set(height == 0, schedule)
+
+	return schedule, nil
+}
@@ -0,0 +1,388 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package binancechain
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/binance-chain/go-sdk/common/bech32"
+	"github.com/blocktree/go-owcdrivers/binancechainTransaction"
+	owcrypt "github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/pborman/uuid"
+	"github.com/tendermint/tendermint/crypto/secp256k1"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	keyStoreVersion   = 1             //Binance Chain钱包keystore版本
+	keyStoreCipher    = "aes-256-ctr" //私钥加密算法
+	keyStoreKDF       = "pbkdf2"      //密钥派生算法
+	keyStorePRF       = "hmac-sha256" //pbkdf2使用的伪随机函数
+	keyStoreKDFRounds = 262144        //pbkdf2迭代次数
+	keyStoreKeyLength = 32            //派生密钥长度
+)
+
+//ImportedKeyPath 导入私钥的地址和资产账户使用的HDPath，私钥即密钥文件中的种子，hdkeystore不能按此路径派生
+const ImportedKeyPath = "imported"
+
+//ErrKeyStoreDecrypt keystore密码错误或文件损坏
+var ErrKeyStoreDecrypt = errors.New("could not decrypt key with given password")
+
+//KeyStoreJSON Binance Chain官方钱包导出的加密keystore文件
+type KeyStoreJSON struct {
+	Address string         `json:"address,omitempty"`
+	Crypto  KeyStoreCrypto `json:"crypto"`
+	Id      string         `json:"id"`
+	Version int            `json:"version"`
+}
+
+//KeyStoreCrypto keystore的加密参数和密文
+type KeyStoreCrypto struct {
+	Cipher       string               `json:"cipher"`
+	CipherText   string               `json:"ciphertext"`
+	CipherParams KeyStoreCipherParams `json:"cipherparams"`
+	KDF          string               `json:"kdf"`
+	KDFParams    KeyStoreKDFParams    `json:"kdfparams"`
+	MAC          string               `json:"mac"`
+}
+
+//KeyStoreCipherParams aes-256-ctr的初始向量
+type KeyStoreCipherParams struct {
+	IV string `json:"iv"`
+}
+
+//KeyStoreKDFParams pbkdf2参数
+type KeyStoreKDFParams struct {
+	DKLen int    `json:"dklen"`
+	Salt  string `json:"salt"`
+	C     int    `json:"c"`
+	PRF   string `json:"prf"`
+}
+
+//validatePrivateKey 检查是否有效的secp256k1私钥
+func validatePrivateKey(priv []byte) error {
+	if len(priv) != 32 {
+		return fmt.Errorf("private key must be 32 bytes, got %d", len(priv))
+	}
+	k := new(big.Int).SetBytes(priv)
+	if k.Sign() == 0 || k.Cmp(new(big.Int).SetBytes(binancechainTransaction.CurveOrder)) >= 0 {
+		return errors.New("private key is out of the secp256k1 range")
+	}
+	return nil
+}
+
+//PrivateKeyAddress 私钥对应的地址
+func PrivateKeyAddress(priv []byte, isTestnet bool) (string, error) {
+	if err := validatePrivateKey(priv); err != nil {
+		return "", err
+	}
+	var key secp256k1.PrivKeySecp256k1
+	copy(key[:], priv)
+	return bech32.ConvertAndEncode(AddressPrefix(isTestnet), key.PubKey().Address())
+}
+
+//EncryptKeyStore 按Binance Chain钱包的格式加密私钥，
+//pbkdf2-sha256派生密钥，aes-256-ctr加密，keccak512计算MAC
+func EncryptKeyStore(priv []byte, password string, isTestnet bool) ([]byte, error) {
+
+	if len(password) == 0 {
+		return nil, errors.New("password is required")
+	}
+	address, err := PrivateKeyAddress(priv, isTestnet)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 32)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	derivedKey := pbkdf2.Key([]byte(password), salt, keyStoreKDFRounds, keyStoreKeyLength, sha256.New)
+	cipherText, err := aesCTRXOR(derivedKey, priv, iv)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(&KeyStoreJSON{
+		Address: address,
+		Crypto: KeyStoreCrypto{
+			Cipher:       keyStoreCipher,
+			CipherText:   hex.EncodeToString(cipherText),
+			CipherParams: KeyStoreCipherParams{IV: hex.EncodeToString(iv)},
+			KDF:          keyStoreKDF,
+			KDFParams: KeyStoreKDFParams{
+				DKLen: keyStoreKeyLength,
+				Salt:  hex.EncodeToString(salt),
+				C:     keyStoreKDFRounds,
+				PRF:   keyStorePRF,
+			},
+			MAC: hex.EncodeToString(keyStoreMAC(derivedKey, cipherText)),
+		},
+		Id:      uuid.NewRandom().String(),
+		Version: keyStoreVersion,
+	})
+}
+
+//DecryptKeyStore 解密Binance Chain钱包的keystore，返回私钥。
+//兼容旧版使用sha256计算MAC的文件，文件包含地址时检查地址与私钥一致
+func DecryptKeyStore(keyjson []byte, password string) ([]byte, error) {
+
+	var ks KeyStoreJSON
+	if err := json.Unmarshal(keyjson, &ks); err != nil {
+		return nil, fmt.Errorf("invalid keystore json: %v", err)
+	}
+	if ks.Crypto.Cipher != keyStoreCipher {
+		return nil, fmt.Errorf("unsupported cipher: %s", ks.Crypto.Cipher)
+	}
+	if ks.Crypto.KDF != keyStoreKDF || ks.Crypto.KDFParams.PRF != keyStorePRF {
+		return nil, fmt.Errorf("unsupported kdf: %s %s", ks.Crypto.KDF, ks.Crypto.KDFParams.PRF)
+	}
+
+	mac, err := hex.DecodeString(ks.Crypto.MAC)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mac: %v", err)
+	}
+	iv, err := hex.DecodeString(ks.Crypto.CipherParams.IV)
+	if err != nil {
+		return nil, fmt.Errorf("invalid iv: %v", err)
+	}
+	cipherText, err := hex.DecodeString(ks.Crypto.CipherText)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ciphertext: %v", err)
+	}
+	salt, err := hex.DecodeString(ks.Crypto.KDFParams.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt: %v", err)
+	}
+	if ks.Crypto.KDFParams.C <= 0 || ks.Crypto.KDFParams.DKLen != keyStoreKeyLength {
+		return nil, fmt.Errorf("invalid kdf params: %+v", ks.Crypto.KDFParams)
+	}
+
+	derivedKey := pbkdf2.Key([]byte(password), salt, ks.Crypto.KDFParams.C, ks.Crypto.KDFParams.DKLen, sha256.New)
+	if !bytes.Equal(keyStoreMAC(derivedKey, cipherText), mac) {
+		legacyMAC := sha256.Sum256(append(append([]byte{}, derivedKey[16:32]...), cipherText...))
+		if !bytes.Equal(legacyMAC[:], mac) {
+			return nil, ErrKeyStoreDecrypt
+		}
+	}
+
+	priv, err := aesCTRXOR(derivedKey, cipherText, iv)
+	if err != nil {
+		return nil, err
+	}
+	if err := validatePrivateKey(priv); err != nil {
+		return nil, err
+	}
+
+	if len(ks.Address) > 0 {
+		prefix, hash, err := bech32.DecodeAndConvert(ks.Address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid keystore address: %v", err)
+		}
+		address, _ := PrivateKeyAddress(priv, prefix == TestnetAddressPrefix)
+		if _, expected, _ := bech32.DecodeAndConvert(address); !bytes.Equal(hash, expected) {
+			return nil, fmt.Errorf("keystore address %s does not match the private key", ks.Address)
+		}
+	}
+
+	return priv, nil
+}
+
+//keyStoreMAC keccak512(derivedKey[16:32] + cipherText)
+func keyStoreMAC(derivedKey, cipherText []byte) []byte {
+	hasher := sha3.NewLegacyKeccak512()
+	hasher.Write(derivedKey[16:32])
+	hasher.Write(cipherText)
+	return hasher.Sum(nil)
+}
+
+func aesCTRXOR(key, inText, iv []byte) ([]byte, error) {
+	aesBlock, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	stream := cipher.NewCTR(aesBlock, iv)
+	outText := make([]byte, len(inText))
+	stream.XORKeyStream(outText, inText)
+	return outText, nil
+}
+
+//decodePrivateKeyHex 解析十六进制私钥，可带0x前缀
+func decodePrivateKeyHex(s string) ([]byte, error) {
+	priv, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(s), "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key hex: %v", err)
+	}
+	if err := validatePrivateKey(priv); err != nil {
+		return nil, err
+	}
+	return priv, nil
+}
+
+//privateKeyOfAddress 从HD钱包派生地址的私钥
+func (wm *WalletManager) privateKeyOfAddress(wrapper openwallet.WalletDAI, address string) ([]byte, error) {
+
+	addr, err := wrapper.GetAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	if addr == nil || len(addr.HDPath) == 0 {
+		return nil, fmt.Errorf("address %s is not derived from the wallet", address)
+	}
+	key, err := wrapper.HDKey()
+	if err != nil {
+		return nil, err
+	}
+	priv, err := derivePrivateKey(key, addr, wm.Config.CurveType)
+	if err != nil {
+		return nil, err
+	}
+
+	//派生的私钥必须对应导出的地址
+	derived, err := PrivateKeyAddress(priv, wm.Config.IsTestNet)
+	if err != nil {
+		return nil, err
+	}
+	if derived != address {
+		return nil, fmt.Errorf("derived address %s does not match %s", derived, address)
+	}
+	return priv, nil
+}
+
+//ExportPrivateKey 导出HD钱包地址的十六进制私钥
+func (wm *WalletManager) ExportPrivateKey(wrapper openwallet.WalletDAI, address string) (string, error) {
+	priv, err := wm.privateKeyOfAddress(wrapper, address)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(priv), nil
+}
+
+//ExportKeyStore 把HD钱包地址的私钥导出为Binance Chain钱包可导入的keystore
+func (wm *WalletManager) ExportKeyStore(wrapper openwallet.WalletDAI, address, password string) ([]byte, error) {
+	priv, err := wm.privateKeyOfAddress(wrapper, address)
+	if err != nil {
+		return nil, err
+	}
+	return EncryptKeyStore(priv, password, wm.Config.IsTestNet)
+}
+
+//ImportPrivateKey 导入十六进制私钥，返回私钥和配置网络上的地址
+func (wm *WalletManager) ImportPrivateKey(privHex string) ([]byte, string, error) {
+	priv, err := decodePrivateKeyHex(privHex)
+	if err != nil {
+		return nil, "", err
+	}
+	address, err := PrivateKeyAddress(priv, wm.Config.IsTestNet)
+	if err != nil {
+		return nil, "", err
+	}
+	return priv, address, nil
+}
+
+//ImportKeyStore 导入Binance Chain钱包的keystore，返回私钥和配置网络上的地址
+func (wm *WalletManager) ImportKeyStore(keyjson []byte, password string) ([]byte, string, error) {
+	priv, err := DecryptKeyStore(keyjson, password)
+	if err != nil {
+		return nil, "", err
+	}
+	address, err := PrivateKeyAddress(priv, wm.Config.IsTestNet)
+	if err != nil {
+		return nil, "", err
+	}
+	return priv, address, nil
+}
+
+//ImportWalletFromPrivateKey 把十六进制私钥导入为单地址的钱包，私钥作为种子保存到keyDir下的密钥文件，
+//资产账户和地址保存到钱包数据库，返回钱包和地址
+func (wm *WalletManager) ImportWalletFromPrivateKey(alias, password, privHex string) (*openwallet.Wallet, *openwallet.Address, error) {
+	priv, _, err := wm.ImportPrivateKey(privHex)
+	if err != nil {
+		return nil, nil, err
+	}
+	return wm.importWallet(alias, password, priv)
+}
+
+//ImportWalletFromKeyStore 把Binance Chain钱包的keystore导入为单地址的钱包，keyPassword为keystore的密码，password为新钱包的密码
+func (wm *WalletManager) ImportWalletFromKeyStore(alias, password string, keyjson []byte, keyPassword string) (*openwallet.Wallet, *openwallet.Address, error) {
+	priv, _, err := wm.ImportKeyStore(keyjson, keyPassword)
+	if err != nil {
+		return nil, nil, err
+	}
+	return wm.importWallet(alias, password, priv)
+}
+
+//importWallet 登记导入私钥的钱包，资产账户的公钥不是扩展公钥，openwallet不会在账户下派生新地址
+func (wm *WalletManager) importWallet(alias, password string, priv []byte) (*openwallet.Wallet, *openwallet.Address, error) {
+
+	if len(alias) == 0 {
+		return nil, nil, errors.New("wallet alias is required")
+	}
+	if len(password) == 0 {
+		return nil, nil, errors.New("wallet password is required")
+	}
+
+	pub := owcrypt.Point_mulBaseG(priv, owcrypt.ECC_CURVE_SECP256K1)
+	address, err := wm.Decoder.PublicKeyToAddress(pub, wm.Config.IsTestNet)
+	if err != nil {
+		return nil, nil, err
+	}
+	pubHex := hex.EncodeToString(pub)
+
+	account := &openwallet.AssetsAccount{
+		Alias:     alias,
+		AccountID: openwallet.GenAccountIDByHex(pubHex),
+		HDPath:    ImportedKeyPath,
+		PublicKey: pubHex,
+		OwnerKeys: []string{pubHex},
+		Required:  1,
+		Symbol:    wm.Symbol(),
+	}
+	addr := &openwallet.Address{
+		Address:     address,
+		PublicKey:   pubHex,
+		HDPath:      ImportedKeyPath,
+		Symbol:      wm.Symbol(),
+		CreatedTime: time.Now().Unix(),
+	}
+
+	wallet, err := wm.storeWallet(alias, password, priv, ImportedKeyPath, account, []*openwallet.Address{addr})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	wm.Log.Std.Info("wallet %s imported with address %s", wallet.WalletID, address)
+
+	return wallet, addr, nil
+}
@@ -0,0 +1,177 @@
+package binancechain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/blocktree/binance-chain-adapter/binancechaintest"
+	"github.com/blocktree/openwallet/hdkeystore"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+//官方SDK测试使用的keystore，密码Zjubfd@123，私钥和地址由go-sdk的keystore解密得到
+const (
+	sdkKeyStorePrivateKey = "22bcd2a6695ac42459ff61bf68ffc67dde44c6fe0285023820df454600aa45f8"
+	sdkKeyStoreAddress    = "bnb12v2fatnh3h7s44anqrm2azg6etr0kfyy8h54ed"
+)
+
+const sdkKeyStore = `{"version":1,"id":"0b3d7c68-c5e8-4b26-9b20-4690e0f52b73","crypto":{"ciphertext":"fdbaea9fa6672de0d607aa030eb0492a9023e837c82968ddfe374fee6f1e2f5a","cipherparams":{"iv":"5c9a03d8c23dd6bc5e812ebf3a68f425"},"cipher":"aes-256-ctr","kdf":"pbkdf2","kdfparams":{"dklen":32,"salt":"12fcaadc6cd8fab47edfe51017e7ab1d4bda1902219b86ff8d4cbf4661f60134","c":262144,"prf":"hmac-sha256"},"mac":"6bfa9ebdcc83278b7bcc04e53a5837b193cabdf7807116dfc5fff2049779b55531710fb5def1b941f59e18a69679126c2bd85baf2c85a88ce867ac1db2cef2ef"}}`
+
+func Test_keyStore(t *testing.T) {
+
+	priv, err := DecryptKeyStore([]byte(sdkKeyStore), "Zjubfd@123")
+	if err != nil || len(priv) != 32 {
+		t.Fatalf("decrypt sdk keystore failed unexpected error: %v", err)
+	}
+	if hex.EncodeToString(priv) != sdkKeyStorePrivateKey {
+		t.Errorf("private key = %x, expected %s", priv, sdkKeyStorePrivateKey)
+	}
+	if address, _ := PrivateKeyAddress(priv, false); address != sdkKeyStoreAddress {
+		t.Errorf("address = %s, expected %s", address, sdkKeyStoreAddress)
+	}
+	if _, err := DecryptKeyStore([]byte(sdkKeyStore), "wrong"); err != ErrKeyStoreDecrypt {
+		t.Errorf("expected ErrKeyStoreDecrypt, got %v", err)
+	}
+
+	keyjson, err := EncryptKeyStore(priv, "secret", true)
+	if err != nil {
+		t.Fatalf("encrypt keystore failed unexpected error: %v", err)
+	}
+	var ks KeyStoreJSON
+	json.Unmarshal(keyjson, &ks)
+	if !strings.HasPrefix(ks.Address, "tbnb1") || ks.Crypto.KDFParams.C != 262144 || ks.Crypto.Cipher != "aes-256-ctr" {
+		t.Errorf("unexpected keystore: %s", keyjson)
+	}
+	decrypted, err := DecryptKeyStore(keyjson, "secret")
+	if err != nil || !bytes.Equal(decrypted, priv) {
+		t.Errorf("keystore round trip failed: %v", err)
+	}
+
+	//地址与私钥不一致
+	other, _ := PrivateKeyAddress(append([]byte{1}, make([]byte, 31)...), true)
+	ks.Address = other
+	tampered, _ := json.Marshal(&ks)
+	if _, err := DecryptKeyStore(tampered, "secret"); err == nil {
+		t.Errorf("expected address mismatch error")
+	}
+
+	//十六进制私钥
+	wm := NewWalletManager()
+	wif, err := wm.Decoder.PrivateKeyToWIF(priv, false)
+	if err != nil || wif != hex.EncodeToString(priv) {
+		t.Errorf("unexpected private key hex: %s, %v", wif, err)
+	}
+	if key, err := wm.Decoder.WIFToPrivateKey("0x"+wif, false); err != nil || !bytes.Equal(key, priv) {
+		t.Errorf("import private key hex failed: %v", err)
+	}
+	for _, invalid := range []string{"", "zz", hex.EncodeToString(make([]byte, 32)), wif[2:], strings.Repeat("ff", 32)} {
+		if _, err := wm.Decoder.WIFToPrivateKey(invalid, false); err == nil {
+			t.Errorf("expected invalid private key %s rejected", invalid)
+		}
+	}
+}
+
+func Test_exportKeyStore(t *testing.T) {
+	wm := NewWalletManager()
+
+	hdKey, _ := hdkeystore.NewHDKey(make([]byte, 32), "mock", "m/44'/714'/0'")
+	hdPath := "m/44'/714'/0'/0/0"
+	childKey, _ := hdKey.DerivedKeyWithPath(hdPath, wm.Config.CurveType)
+	address, _ := wm.Decoder.PublicKeyToAddress(childKey.GetPublicKeyBytes(), false)
+	wallet := &mockWallet{
+		key:     hdKey,
+		address: &openwallet.Address{AccountID: "mock", Address: address, HDPath: hdPath},
+	}
+
+	keyjson, err := wm.ExportKeyStore(wallet, address, "secret")
+	if err != nil {
+		t.Fatalf("export keystore failed unexpected error: %v", err)
+	}
+	priv, imported, err := wm.ImportKeyStore(keyjson, "secret")
+	if err != nil || imported != address {
+		t.Fatalf("imported address = %s, %v, expected %s", imported, err, address)
+	}
+	privHex, _ := wm.ExportPrivateKey(wallet, address)
+	if _, imported, err := wm.ImportPrivateKey(privHex); err != nil || imported != address || privHex != hex.EncodeToString(priv) {
+		t.Errorf("imported address = %s, %v, expected %s", imported, err, address)
+	}
+
+	wallet.address.HDPath = "m/44'/714'/0'/0/1"
+	if _, err := wm.ExportKeyStore(wallet, address, "secret"); err == nil {
+		t.Errorf("expected derived address mismatch error")
+	}
+}
+
+func Test_importWallet(t *testing.T) {
+	node := binancechaintest.NewNode("")
+	defer node.Close()
+
+	wm, cleanup := newMockNodeWalletManager(t, node)
+	defer cleanup()
+	wm.Config.keyDir = filepath.Join(wm.Config.dbPath, "key")
+
+	if _, _, err := wm.ImportWalletFromKeyStore("legacy", "12345678", []byte(sdkKeyStore), "wrong"); err != ErrKeyStoreDecrypt {
+		t.Errorf("expected ErrKeyStoreDecrypt, got %v", err)
+	}
+	wallet, address, err := wm.ImportWalletFromKeyStore("legacy", "12345678", []byte(sdkKeyStore), "Zjubfd@123")
+	if err != nil {
+		t.Fatalf("import keystore failed unexpected error: %v", err)
+	}
+	if address.Address != sdkKeyStoreAddress || address.HDPath != ImportedKeyPath {
+		t.Fatalf("imported address = %+v, expected %s", address, sdkKeyStoreAddress)
+	}
+
+	//钱包已登记，地址已保存到钱包数据库
+	wallets, _ := wm.GetWallets()
+	if len(wallets) != 1 || wallets[0].WalletID != wallet.WalletID {
+		t.Errorf("imported wallet not registered: %+v", wallets)
+	}
+	saved := wallet.GetAddress(sdkKeyStoreAddress)
+	if saved == nil || saved.AccountID != address.AccountID || saved.HDPath != ImportedKeyPath {
+		t.Fatalf("imported address not saved: %+v", saved)
+	}
+
+	//同一私钥导入得到同一个钱包
+	again, _, err := wm.ImportWalletFromPrivateKey("legacy", "12345678", sdkKeyStorePrivateKey)
+	if err != nil || again.WalletID != wallet.WalletID {
+		t.Errorf("reimported wallet = %v, %v, expected %s", again, err, wallet.WalletID)
+	}
+
+	//导入的私钥可以导出和签名
+	key, err := wallet.HDKey("12345678")
+	if err != nil {
+		t.Fatalf("decrypt wallet key failed unexpected error: %v", err)
+	}
+	saved.AccountID = "mock"
+	mock := &mockWallet{key: key, address: saved, extParam: make(map[string]interface{})}
+	if privHex, err := wm.ExportPrivateKey(mock, sdkKeyStoreAddress); err != nil || privHex != sdkKeyStorePrivateKey {
+		t.Errorf("exported private key = %s, %v, expected %s", privHex, err, sdkKeyStorePrivateKey)
+	}
+
+	to := types.AccAddress(append([]byte{2}, make([]byte, 19)...)).String()
+	node.Mint(sdkKeyStoreAddress, types.Coins{{Denom: "BNB", Amount: 100000000}})
+	node.ProduceBlock()
+	rawTx := &openwallet.RawTransaction{
+		Coin:    openwallet.Coin{Symbol: Symbol, IsContract: true, Contract: openwallet.SmartContract{Symbol: Symbol, Address: "BNB", Decimals: 8}},
+		Account: &openwallet.AssetsAccount{AccountID: "mock"},
+		To:      map[string]string{to: "0.5"},
+	}
+	decoder := wm.TxDecoder
+	if err := decoder.CreateRawTransaction(mock, rawTx); err != nil {
+		t.Fatalf("create transaction failed unexpected error: %v", err)
+	}
+	if err := decoder.SignRawTransaction(mock, rawTx); err != nil {
+		t.Fatalf("sign transaction failed unexpected error: %v", err)
+	}
+	if err := decoder.VerifyRawTransaction(mock, rawTx); err != nil || !rawTx.IsCompleted {
+		t.Fatalf("verify transaction failed: %v", err)
+	}
+	if _, err := decoder.SubmitRawTransaction(mock, rawTx); err != nil {
+		t.Errorf("submit transaction failed unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,262 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package binancechain
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/blocktree/openwallet/log"
+	core_types "github.com/tendermint/tendermint/rpc/core/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+)
+
+const (
+	lightClientHeaderKeep = 1000 //保留已验证区块头的数量
+)
+
+//LightClient 轻客户端区块头验证，跟踪/validators的验证人集合，
+//要求每个区块的/commit有超过2/3投票权的有效签名
+type LightClient struct {
+	ChainID               string //链ID，为空时使用首个区块头中的链ID
+	TrustedValidatorsHash []byte //初始信任的验证人集合hash，不能为空
+
+	client        func() *Client
+	mu            sync.Mutex
+	trusted       *tmtypes.ValidatorSet
+	trustedHeight int64
+	nextValsHash  []byte
+	headers       map[int64]*tmtypes.Header
+}
+
+//NewLightClient 创建轻客户端，client返回当前使用的节点客户端
+func NewLightClient(client func() *Client) *LightClient {
+	return &LightClient{
+		client:  client,
+		headers: make(map[int64]*tmtypes.Header),
+	}
+}
+
+//TrustedHeight 当前信任的验证人集合所在高度及其hash
+func (lc *LightClient) TrustedHeight() (uint64, string) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if lc.trusted == nil {
+		return 0, ""
+	}
+	return uint64(lc.trustedHeight), hex.EncodeToString(lc.trusted.Hash())
+}
+
+//VerifyBlock 验证区块哈希和交易列表与已签名的区块头一致
+func (lc *LightClient) VerifyBlock(block *Block) error {
+	return lc.VerifyBlockContext(context.Background(), block)
+}
+
+func (lc *LightClient) VerifyBlockContext(ctx context.Context, block *Block) error {
+
+	header, err := lc.VerifyHeaderContext(ctx, block.Height)
+	if err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(block.Hash, hex.EncodeToString(header.Hash())) {
+		return unverifiedError("block hash %s of height %d doesn't match signed header %X", block.Hash, block.Height, header.Hash())
+	}
+	if !bytes.Equal(block.rawTxs.Hash(), header.DataHash) {
+		return unverifiedError("transactions of height %d don't match data hash %X", block.Height, header.DataHash)
+	}
+
+	return nil
+}
+
+//VerifyHeader 获取指定高度的区块头并验证commit签名
+func (lc *LightClient) VerifyHeader(height uint64) (*tmtypes.Header, error) {
+	return lc.VerifyHeaderContext(context.Background(), height)
+}
+
+func (lc *LightClient) VerifyHeaderContext(ctx context.Context, height uint64) (*tmtypes.Header, error) {
+
+	//网络请求不持有锁，只在读取和提交信任状态时加锁
+	lc.mu.Lock()
+	header, exist := lc.headers[int64(height)]
+	chainID := lc.ChainID
+	state := lightClientState{trusted: lc.trusted, trustedHeight: lc.trustedHeight, nextValsHash: lc.nextValsHash}
+	lc.mu.Unlock()
+
+	if exist {
+		return header, nil
+	}
+
+	c := lc.client()
+	if c == nil {
+		return nil, unverifiedError("no rpc client")
+	}
+
+	result, err := c.getCommitContext(ctx, height)
+	if err != nil {
+		return nil, err
+	}
+
+	header, commit := result.Header, result.Commit
+	if header == nil || commit == nil {
+		return nil, unverifiedError("commit of height %d has no signed header", height)
+	}
+	if header.Height != int64(height) {
+		return nil, unverifiedError("commit of height %d returned height %d", height, header.Height)
+	}
+	if !bytes.Equal(header.Hash(), commit.BlockID.Hash) {
+		return nil, unverifiedError("header hash %X of height %d doesn't match commit block id %X", header.Hash(), height, commit.BlockID.Hash)
+	}
+
+	if len(chainID) == 0 {
+		chainID = header.ChainID
+	} else if header.ChainID != chainID {
+		return nil, unverifiedError("chain id %s of height %d, expected %s", header.ChainID, height, chainID)
+	}
+
+	vals, err := lc.validatorSet(ctx, c, state, chainID, header, commit)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := vals.VerifyCommit(chainID, commit.BlockID, header.Height, commit); err != nil {
+		return nil, unverifiedError("commit of height %d: %v", height, err)
+	}
+
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	if len(lc.ChainID) == 0 {
+		lc.ChainID = chainID
+	}
+	//只向前推进信任的验证人集合，重扫旧区块不改变信任状态
+	if header.Height > lc.trustedHeight {
+		lc.trusted = vals
+		lc.trustedHeight = header.Height
+		lc.nextValsHash = header.NextValidatorsHash
+	}
+	lc.remember(header)
+
+	return header, nil
+}
+
+//lightClientState 验证开始时的信任状态
+type lightClientState struct {
+	trusted       *tmtypes.ValidatorSet
+	trustedHeight int64
+	nextValsHash  []byte
+}
+
+//validatorSet 获取签名区块头的验证人集合，新集合必须由已信任的状态推导出来
+func (lc *LightClient) validatorSet(ctx context.Context, c *Client, state lightClientState, chainID string, header *tmtypes.Header, commit *tmtypes.Commit) (*tmtypes.ValidatorSet, error) {
+
+	if state.trusted != nil && bytes.Equal(state.trusted.Hash(), header.ValidatorsHash) {
+		return state.trusted, nil
+	}
+
+	vals, err := c.getValidatorsContext(ctx, uint64(header.Height))
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(vals.Hash(), header.ValidatorsHash) {
+		return nil, unverifiedError("validators hash %X of height %d doesn't match header %X", vals.Hash(), header.Height, header.ValidatorsHash)
+	}
+
+	switch {
+	case state.trusted == nil:
+		//不信任节点首次返回的验证人集合，必须与配置的hash一致
+		if len(lc.TrustedValidatorsHash) == 0 {
+			return nil, unverifiedError("no trusted validator set configured")
+		}
+		if !bytes.Equal(vals.Hash(), lc.TrustedValidatorsHash) {
+			return nil, unverifiedError("validator set %X of height %d is not trusted", vals.Hash(), header.Height)
+		}
+	case header.Height == state.trustedHeight+1 && bytes.Equal(state.nextValsHash, header.ValidatorsHash):
+		//上一个已验证的区块头已承诺了新的验证人集合
+	default:
+		//跨越多个区块的验证人集合变化，要求已信任的集合超过2/3的投票权也签名了该区块
+		if err := state.trusted.VerifyFutureCommit(vals, chainID, commit.BlockID, header.Height, commit); err != nil {
+			return nil, unverifiedError("validator set of height %d changed too much since height %d: %v", header.Height, state.trustedHeight, err)
+		}
+	}
+
+	log.Std.Info("light client validator set changed on height %d: %X", header.Height, vals.Hash())
+	return vals, nil
+}
+
+//remember 保存已验证的区块头，超出数量时删除最低的高度，调用方需持有锁
+func (lc *LightClient) remember(header *tmtypes.Header) {
+	lc.headers[header.Height] = header
+	if len(lc.headers) <= lightClientHeaderKeep {
+		return
+	}
+	lowest := header.Height
+	for height := range lc.headers {
+		if height < lowest {
+			lowest = height
+		}
+	}
+	delete(lc.headers, lowest)
+}
+
+//unverifiedError 区块头验证失败的错误
+func unverifiedError(format string, args ...interface{}) error {
+	return &RPCError{Kind: ErrBlockUnverified, Message: fmt.Sprintf(format, args...)}
+}
+
+//SetLightClient 设置轻客户端，设置后带证明的查询使用已验证区块头中的app hash
+func (c *Client) SetLightClient(lc *LightClient) {
+	c.lightClient = lc
+}
+
+//getCommitContext 获取区块的签名区块头和commit
+func (c *Client) getCommitContext(ctx context.Context, height uint64) (*core_types.ResultCommit, error) {
+
+	resp, err := c.CallContext(ctx, fmt.Sprintf("/commit?height=%d", height), nil, "GET")
+	if err != nil {
+		return nil, err
+	}
+
+	var result core_types.ResultCommit
+	if err := cdc.UnmarshalJSON([]byte(resp.Get("result").Raw), &result); err != nil {
+		return nil, unverifiedError("invalid commit of height %d: %v", height, err)
+	}
+
+	return &result, nil
+}
+
+//getValidatorsContext 获取指定高度的验证人集合
+func (c *Client) getValidatorsContext(ctx context.Context, height uint64) (*tmtypes.ValidatorSet, error) {
+
+	resp, err := c.CallContext(ctx, fmt.Sprintf("/validators?height=%d", height), nil, "GET")
+	if err != nil {
+		return nil, err
+	}
+
+	var result core_types.ResultValidators
+	if err := cdc.UnmarshalJSON([]byte(resp.Get("result").Raw), &result); err != nil {
+		return nil, unverifiedError("invalid validators of height %d: %v", height, err)
+	}
+	if len(result.Validators) == 0 {
+		return nil, unverifiedError("no validators of height %d", height)
+	}
+
+	return tmtypes.NewValidatorSet(result.Validators), nil
+}
@@ -0,0 +1,186 @@
+package binancechain
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	core_types "github.com/tendermint/tendermint/rpc/core/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+	"github.com/tidwall/gjson"
+)
+
+//mockValidators 模拟的验证人集合及其私钥
+type mockValidators struct {
+	pvs  map[string]*tmtypes.MockPV
+	vals *tmtypes.ValidatorSet
+}
+
+func newMockValidators(n int) *mockValidators {
+	mv := &mockValidators{pvs: make(map[string]*tmtypes.MockPV)}
+	list := make([]*tmtypes.Validator, 0)
+	for i := 0; i < n; i++ {
+		pv := tmtypes.NewMockPV()
+		mv.pvs[pv.GetPubKey().Address().String()] = pv
+		list = append(list, tmtypes.NewValidator(pv.GetPubKey(), 10))
+	}
+	mv.vals = tmtypes.NewValidatorSet(list)
+	return mv
+}
+
+//sign 全部验证人对区块头签名
+func (mv *mockValidators) sign(chainID string, header *tmtypes.Header) *tmtypes.Commit {
+	blockID := tmtypes.BlockID{Hash: header.Hash()}
+	precommits := make([]*tmtypes.CommitSig, mv.vals.Size())
+	for idx, val := range mv.vals.Validators {
+		vote := &tmtypes.Vote{
+			Type:             tmtypes.PrecommitType,
+			Height:           header.Height,
+			BlockID:          blockID,
+			Timestamp:        header.Time,
+			ValidatorAddress: val.Address,
+			ValidatorIndex:   idx,
+		}
+		mv.pvs[val.Address.String()].SignVote(chainID, vote)
+		precommits[idx] = vote.CommitSig()
+	}
+	return &tmtypes.Commit{BlockID: blockID, Precommits: precommits}
+}
+
+//mockLightChain 模拟节点的/commit和/validators
+type mockLightChain struct {
+	mu      sync.Mutex
+	chainID string
+	headers map[int64]*tmtypes.Header
+	commits map[int64]*tmtypes.Commit
+	vals    map[int64]*tmtypes.ValidatorSet
+	txs     map[int64]tmtypes.Txs
+	appHash []byte //新区块头中的app hash
+}
+
+func newMockLightChain(chainID string) *mockLightChain {
+	return &mockLightChain{
+		chainID: chainID,
+		headers: make(map[int64]*tmtypes.Header),
+		commits: make(map[int64]*tmtypes.Commit),
+		vals:    make(map[int64]*tmtypes.ValidatorSet),
+		txs:     make(map[int64]tmtypes.Txs),
+	}
+}
+
+//addBlock 生成由signer签名的区块，next为下一个区块的验证人集合
+func (chain *mockLightChain) addBlock(height int64, signer, next *mockValidators, txs tmtypes.Txs) {
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
+	header := &tmtypes.Header{
+		ChainID:            chain.chainID,
+		Height:             height,
+		Time:               time.Unix(1560000000+height, 0).UTC(),
+		NumTxs:             int64(len(txs)),
+		DataHash:           txs.Hash(),
+		ValidatorsHash:     signer.vals.Hash(),
+		NextValidatorsHash: next.vals.Hash(),
+		AppHash:            chain.appHash,
+	}
+	chain.headers[height] = header
+	chain.commits[height] = signer.sign(chain.chainID, header)
+	chain.vals[height] = signer.vals
+	chain.txs[height] = txs
+}
+
+//block 生成/block的返回结果
+func (chain *mockLightChain) block(height int64) *Block {
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
+	txs := ""
+	for i, tx := range chain.txs[height] {
+		if i > 0 {
+			txs += ","
+		}
+		txs += `"` + base64.StdEncoding.EncodeToString(tx) + `"`
+	}
+	result := gjson.Parse(fmt.Sprintf(`{"block_meta":{"block_id":{"hash":"%X"},"header":{"height":"%d","num_txs":"%d"}},"block":{"data":{"txs":[%s]}}}`,
+		chain.headers[height].Hash(), height, len(chain.txs[height]), txs))
+	return NewBlock(&result)
+}
+
+func (chain *mockLightChain) serve() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(chain.handle))
+}
+
+//handle 返回/commit和/validators的结果
+func (chain *mockLightChain) handle(w http.ResponseWriter, r *http.Request) {
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
+
+	height, _ := strconv.ParseInt(r.URL.Query().Get("height"), 10, 64)
+	var result interface{}
+	switch r.URL.Path {
+	case "/commit":
+		result = &core_types.ResultCommit{SignedHeader: tmtypes.SignedHeader{Header: chain.headers[height], Commit: chain.commits[height]}, CanonicalCommit: true}
+	case "/validators":
+		result = &core_types.ResultValidators{BlockHeight: height, Validators: chain.vals[height].Validators}
+	}
+	bz, _ := cdc.MarshalJSON(result)
+	fmt.Fprintf(w, `{"jsonrpc":"2.0","id":"","result":%s}`, bz)
+}
+
+func Test_lightClientVerifyBlock(t *testing.T) {
+	setA := newMockValidators(4)
+	setB := newMockValidators(4)
+
+	chain := newMockLightChain("Binance-Chain-Tigris")
+	chain.addBlock(10, setA, setA, tmtypes.Txs{tmtypes.Tx("tx1"), tmtypes.Tx("tx2")})
+	chain.addBlock(11, setA, setB, nil)
+	chain.addBlock(12, setB, setB, tmtypes.Txs{tmtypes.Tx("tx3")})
+	server := chain.serve()
+	defer server.Close()
+
+	c := NewClient(server.URL, false)
+	lc := NewLightClient(func() *Client { return c })
+	lc.TrustedValidatorsHash = setA.vals.Hash()
+
+	for height := int64(10); height <= 12; height++ {
+		if err := lc.VerifyBlock(chain.block(height)); err != nil {
+			t.Fatalf("verify block %d failed unexpected error: %v", height, err)
+		}
+	}
+	if height, _ := lc.TrustedHeight(); height != 12 {
+		t.Errorf("trusted height = %d, expected 12", height)
+	}
+
+	//节点在区块中伪造交易单
+	fabricated := chain.block(10)
+	fabricated.rawTxs = append(fabricated.rawTxs, tmtypes.Tx("deposit"))
+	if err := lc.VerifyBlock(fabricated); ErrorKind(err) != ErrBlockUnverified {
+		t.Errorf("fabricated transactions should be unverified, got: %v", err)
+	}
+
+	//未经已信任集合承诺的验证人集合签名的区块
+	setC := newMockValidators(4)
+	chain.addBlock(20, setC, setC, nil)
+	if err := lc.VerifyBlock(chain.block(20)); ErrorKind(err) != ErrBlockUnverified {
+		t.Errorf("block signed by unknown validators should be unverified, got: %v", err)
+	}
+
+	//初始验证人集合与配置不一致
+	untrusted := NewLightClient(func() *Client { return c })
+	untrusted.TrustedValidatorsHash = setB.vals.Hash()
+	if err := untrusted.VerifyBlock(chain.block(10)); ErrorKind(err) != ErrBlockUnverified {
+		t.Errorf("untrusted validator set should be refused, got: %v", err)
+	}
+
+	//未配置初始验证人集合时不信任节点返回的集合
+	unconfigured := NewLightClient(func() *Client { return c })
+	if err := unconfigured.VerifyBlock(chain.block(10)); ErrorKind(err) != ErrBlockUnverified {
+		t.Errorf("validator set without trusted hash should be refused, got: %v", err)
+	}
+	if height, _ := unconfigured.TrustedHeight(); height != 0 {
+		t.Errorf("trusted height = %d after refused block, expected 0", height)
+	}
+}
@@ -16,10 +16,13 @@
 package binancechain
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"path/filepath"
+	"strings"
 
+	"github.com/blocktree/openwallet/common/file"
 	"github.com/blocktree/openwallet/hdkeystore"
 	"github.com/blocktree/openwallet/log"
 	"github.com/blocktree/openwallet/openwallet"
@@ -29,7 +32,7 @@ type WalletManager struct {
 	openwallet.AssetsAdapterBase
 
 	Storage    *hdkeystore.HDKeystore //秘钥存取
-	RpcClient *Client
+	RpcClient ChainBackend //链上数据源
 	Config          *WalletConfig                 //钱包管理配置
 	WalletsInSum    map[string]*openwallet.Wallet //参与汇总的钱包
 	Blockscanner    *BNBBlockScanner             //区块扫描器
@@ -37,6 +40,10 @@ type WalletManager struct {
 	TxDecoder       openwallet.TransactionDecoder //交易单编码器
 	Log             *log.OWLogger                 //日志工具
 	ContractDecoder *ContractDecoder              //智能合约解析器
+	TxTracker       *TxTracker                    //广播交易单跟踪器
+	LightClient     *LightClient                  //区块头签名验证
+	Tokens          *TokenRegistry                //代币信息登记表
+	Network         *NetworkChecker               //节点链ID检查
 }
 
 func NewWalletManager() *WalletManager {
@@ -52,6 +59,10 @@ func NewWalletManager() *WalletManager {
 	wm.TxDecoder = NewTransactionDecoder(&wm)
 	wm.Log = log.NewOWLogger(wm.Symbol())
 	wm.ContractDecoder = NewContractDecoder(&wm)
+	wm.TxTracker = NewTxTracker(func() ChainBackend { return wm.RpcClient })
+	wm.LightClient = NewLightClient(wm.tendermintClient)
+	wm.Tokens = NewTokenRegistry(func() ChainBackend { return wm.RpcClient })
+	wm.Network = NewNetworkChecker(func() ChainBackend { return wm.RpcClient })
 
 	//	wm.RPCClient = NewRpcClient("http://localhost:20336/")
 	return &wm
@@ -92,14 +103,187 @@ func (wm *WalletManager) GetWallets() ([]*openwallet.Wallet, error) {
 
 }
 
-//SendRawTransaction 广播交易
+//storeWallet 把种子保存到keyDir下的密钥文件登记钱包，并把钱包、资产账户和地址保存到钱包数据库，
+//钱包ID由种子计算，重复导入得到同一个钱包
+func (wm *WalletManager) storeWallet(alias, password string, seed []byte, rootPath string, account *openwallet.AssetsAccount, addresses []*openwallet.Address) (*openwallet.Wallet, error) {
+
+	key, keyFile, err := hdkeystore.StoreHDKeyWithSeed(wm.Config.keyDir, alias, password, seed, hdkeystore.StandardScryptN, hdkeystore.StandardScryptP)
+	if err != nil {
+		return nil, err
+	}
+	wallet := &openwallet.Wallet{
+		WalletID: key.KeyID,
+		Alias:    key.Alias,
+		RootPath: rootPath,
+		KeyFile:  keyFile,
+		DBFile:   filepath.Join(wm.Config.dbPath, strings.TrimSuffix(filepath.Base(keyFile), ".key")+".db"),
+	}
+
+	account.WalletID = wallet.WalletID
+	for _, address := range addresses {
+		address.AccountID = account.AccountID
+	}
+
+	file.MkdirAll(wm.Config.dbPath)
+	db, err := wallet.OpenDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := tx.Save(wallet); err != nil {
+		return nil, err
+	}
+	if err := tx.Save(account); err != nil {
+		return nil, err
+	}
+	for _, address := range addresses {
+		if err := tx.Save(address); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return wallet, nil
+}
+
+//GetAccount 获取账户信息，包括全部币种的可用、冻结和锁定余额
+func (wm *WalletManager) GetAccount(address string) (*AccountInfo, error) {
+	return wm.RpcClient.GetAccount(context.Background(), address)
+}
+
+//GetAccounts 并发获取多个地址的账户信息，按输入顺序返回
+func (wm *WalletManager) GetAccounts(address ...string) ([]*AccountInfo, error) {
+	if batch, ok := wm.RpcClient.(AccountBatchBackend); ok {
+		return batch.GetAccounts(context.Background(), address)
+	}
+
+	//数据源不支持批量查询时逐个查询
+	infos := make([]*AccountInfo, 0, len(address))
+	for _, addr := range address {
+		info, err := wm.GetAccount(addr)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+//verifyNetwork 检查节点所在网络与配置一致，不一致时拒绝扫描和签名
+func (wm *WalletManager) verifyNetwork(ctx context.Context) error {
+	if wm.Network == nil {
+		return nil
+	}
+	return wm.Network.Verify(ctx)
+}
+
+//addressPrefix 配置的网络使用的地址前缀
+func (wm *WalletManager) addressPrefix() string {
+	return AddressPrefix(wm.Config.IsTestNet)
+}
+
+//signChainID 签名文档使用的链ID
+func (wm *WalletManager) signChainID() string {
+	if wm.Network != nil {
+		return wm.Network.SignChainID()
+	}
+	if len(wm.Config.ChainID) > 0 {
+		return wm.Config.ChainID
+	}
+	if wm.Config.IsTestNet {
+		return TestnetChainID
+	}
+	return MainnetChainID
+}
+
+//TokenContract 代币的合约信息，查询失败时名称使用代币符号，小数位仍为BEP2固定的8位
+func (wm *WalletManager) TokenContract(denom string) openwallet.SmartContract {
+	contract, err := wm.Tokens.Contract(context.Background(), wm.Symbol(), denom)
+	if err != nil {
+		wm.Log.Std.Warning("can not get token %s info; unexpected error: %v", denom, err)
+	}
+	return contract
+}
+
+//coinAsset 币种在链上的denom和小数位，主链币为BNB，合约币种为合约地址
+func (wm *WalletManager) coinAsset(coin openwallet.Coin) (string, uint64) {
+	if coin.IsContract {
+		return coin.Contract.Address, coin.Contract.Decimals
+	}
+	return Symbol, uint64(wm.Decimal())
+}
+
+//denomCoin 链上denom对应的币种和小数位，BNB为主链币，其他为BEP2代币
+func (wm *WalletManager) denomCoin(denom string) (openwallet.Coin, uint64) {
+	if denom == Symbol {
+		return openwallet.Coin{Symbol: wm.Symbol()}, uint64(wm.Decimal())
+	}
+	contract := wm.TokenContract(denom)
+	return openwallet.Coin{
+		Symbol:     wm.Symbol(),
+		IsContract: true,
+		ContractID: contract.ContractID,
+		Contract:   contract,
+	}, contract.Decimals
+}
+
+//GetFeeSchedule 获取指定高度的手续费表，height为0时获取最新
+func (wm *WalletManager) GetFeeSchedule(height uint64) (*FeeSchedule, error) {
+	return wm.RpcClient.GetFeeSchedule(context.Background(), height)
+}
+
+//getTransferFee 最新的单笔转账手续费
+func (wm *WalletManager) getTransferFee() (uint64, error) {
+	schedule, err := wm.GetFeeSchedule(0)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(schedule.Transfer.Fee), nil
+}
+
+//getAccountNumberAndSequence 获取签名需要的账户编号和序号，账户不存在时返回错误
+func (wm *WalletManager) getAccountNumberAndSequence(address string) (int64, int64, error) {
+	if seq, ok := wm.RpcClient.(AccountSequenceBackend); ok {
+		return seq.GetAccountSequence(context.Background(), address)
+	}
+	info, err := wm.GetAccount(address)
+	if err != nil {
+		return 0, 0, err
+	}
+	if info.AccountNumber == 0 && info.Sequence == 0 && len(info.Coins) == 0 {
+		return 0, 0, errors.New("Failed to get account number and sequence!")
+	}
+	return info.AccountNumber, info.Sequence, nil
+}
+
+//SendRawTransaction 广播交易，CheckTx通过后返回交易单ID，并在后台跟踪上链结果
 func (wm *WalletManager) SendRawTransaction(txHex string) (string, error) {
-	return wm.sendRawTransactionByNode(txHex)
+	txid, err := wm.sendRawTransactionByNode(txHex)
+	if err != nil {
+		return "", err
+	}
+	if wm.TxTracker != nil {
+		wm.TxTracker.Track(txid)
+	}
+	return txid, nil
+}
+
+//GetTxStatus 查询已广播交易单的上链状态
+func (wm *WalletManager) GetTxStatus(txid string) (TxStatus, bool) {
+	return wm.TxTracker.Status(txid)
 }
 
 func (wm *WalletManager) sendRawTransactionByNode(txHex string) (string, error) {
 
-	txid, err := wm.RpcClient.sendTransaction(txHex)
+	txid, err := wm.RpcClient.BroadcastTransaction(context.Background(), txHex)
 	if err != nil {
 		fmt.Println(err)
 		return "", err
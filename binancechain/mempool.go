@@ -0,0 +1,326 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package binancechain
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+const (
+	defaultMemPoolScanInterval = 500 * time.Millisecond //默认内存池扫描间隔
+	memPoolDropDelay           = 5 * time.Second        //默认离开内存池后等待上链的时间
+	memPoolPromotedKeep        = time.Hour              //已发送上链通知的交易单保留时间，期间区块扫描不再通知
+	unconfirmedTxsLimit        = 100                    ///unconfirmed_txs单次返回的最大数量
+)
+
+//memPoolSnapshot 最近一次/unconfirmed_txs的结果，按txid保存原始交易单
+type memPoolSnapshot struct {
+	mu  sync.Mutex
+	txs map[string][]byte
+}
+
+//getUnconfirmedTxs 获取内存池中的交易单ID，原始交易单保存在快照中供解码。
+//内存池交易单超过unconfirmedTxsLimit时只返回一部分，complete为false
+func (c *Client) getUnconfirmedTxs() ([]string, bool, error) {
+	return c.getUnconfirmedTxsContext(context.Background())
+}
+
+func (c *Client) getUnconfirmedTxsContext(ctx context.Context) ([]string, bool, error) {
+
+	/*
+		{
+			"jsonrpc": "2.0",
+			"id": "",
+			"result": {
+				"n_txs": "1",
+				"total": "1",
+				"total_bytes": "230",
+				"txs": ["2AHwYl3uCmIqLIf6..."]
+			}
+		}
+	*/
+
+	resp, err := c.CallContext(ctx, fmt.Sprintf("/unconfirmed_txs?limit=%d", unconfirmedTxsLimit), nil, "GET")
+	if err != nil {
+		return nil, false, err
+	}
+
+	result := resp.Get("result")
+	rawTxs := result.Get("txs").Array()
+	complete := result.Get("total").Uint() <= uint64(len(rawTxs))
+
+	txs := make(map[string][]byte)
+	txids := make([]string, 0)
+	for _, tx := range rawTxs {
+		raw, err := base64.StdEncoding.DecodeString(tx.String())
+		if err != nil {
+			continue
+		}
+		txid := txHash(raw)
+		if _, exist := txs[txid]; exist {
+			continue
+		}
+		txs[txid] = raw
+		txids = append(txids, txid)
+	}
+
+	c.memPool.mu.Lock()
+	c.memPool.txs = txs
+	c.memPool.mu.Unlock()
+
+	return txids, complete, nil
+}
+
+//getMemPoolTransaction 从最近一次内存池快照中解码交易单，非转账交易返回nil
+func (c *Client) getMemPoolTransaction(txid string) (*Transaction, error) {
+
+	c.memPool.mu.Lock()
+	raw, exist := c.memPool.txs[strings.ToUpper(txid)]
+	c.memPool.mu.Unlock()
+
+	if !exist {
+		return nil, &RPCError{Kind: ErrTxNotFound, Message: "transaction not in mempool: " + txid}
+	}
+
+	trx := newTransactionFromBytes(raw, c.AddressPrefix)
+	if trx == nil {
+		return nil, nil
+	}
+	trx.TxID = strings.ToUpper(txid)
+
+	return trx, nil
+}
+
+//memPoolTx 已提取的内存池交易单
+type memPoolTx struct {
+	extractData map[string]*openwallet.TxExtractData //已发送的待确认通知，为空表示与钱包地址无关
+	leftAt      time.Time                            //离开内存池的时间，仍在内存池时为零
+}
+
+//memPoolTracker 跟踪已通知的内存池交易单，上链后发送确认通知，被丢弃后发送失败通知。
+//同一笔交易单的上链通知只由内存池或区块扫描中先处理的一方发送。
+//区块中的txid是小写，内存池的是大写，跟踪时统一转为大写
+type memPoolTracker struct {
+	mu        sync.Mutex
+	txs       map[string]*memPoolTx
+	promoted  map[string]time.Time //离开内存池后已发送上链通知的交易单
+	dropDelay time.Duration        //离开内存池超过该时间仍未上链视为被丢弃
+}
+
+func newMemPoolTracker() *memPoolTracker {
+	return &memPoolTracker{
+		txs:       make(map[string]*memPoolTx),
+		promoted:  make(map[string]time.Time),
+		dropDelay: memPoolDropDelay,
+	}
+}
+
+//update 根据当前内存池更新跟踪状态，返回未提取过的交易单。
+//complete为false时txids只是内存池的一部分，不在其中的交易单不能视为已离开内存池
+func (mt *memPoolTracker) update(txids []string, complete bool) []string {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+
+	inPool := make(map[string]bool, len(txids))
+	unseen := make([]string, 0)
+	for _, txid := range txids {
+		txid = strings.ToUpper(txid)
+		inPool[txid] = true
+		tx, exist := mt.txs[txid]
+		if !exist {
+			unseen = append(unseen, txid)
+			continue
+		}
+		tx.leftAt = time.Time{}
+	}
+
+	now := time.Now()
+	for txid, at := range mt.promoted {
+		if now.Sub(at) >= memPoolPromotedKeep {
+			delete(mt.promoted, txid)
+		}
+	}
+
+	if !complete {
+		return unseen
+	}
+	for txid, tx := range mt.txs {
+		if !inPool[txid] && tx.leftAt.IsZero() {
+			tx.leftAt = now
+		}
+	}
+
+	return unseen
+}
+
+//add 记录已提取的交易单
+func (mt *memPoolTracker) add(txid string, extractData map[string]*openwallet.TxExtractData) {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	mt.txs[strings.ToUpper(txid)] = &memPoolTx{extractData: extractData}
+}
+
+//left 已离开内存池的交易单
+func (mt *memPoolTracker) left() map[string]*memPoolTx {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	txs := make(map[string]*memPoolTx)
+	for txid, tx := range mt.txs {
+		if !tx.leftAt.IsZero() {
+			txs[txid] = tx
+		}
+	}
+	return txs
+}
+
+func (mt *memPoolTracker) remove(txid string) {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	delete(mt.txs, strings.ToUpper(txid))
+}
+
+//promote 内存池扫描发现交易单已上链，区块扫描未处理过时返回true，由内存池发送上链通知
+func (mt *memPoolTracker) promote(txid string) bool {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	txid = strings.ToUpper(txid)
+	if _, exist := mt.txs[txid]; !exist {
+		return false
+	}
+	delete(mt.txs, txid)
+	mt.promoted[txid] = time.Now()
+	return true
+}
+
+//confirm 区块扫描提取到交易单，内存池已发送过上链通知时返回true，否则不再由内存池通知
+func (mt *memPoolTracker) confirm(txid string) bool {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	txid = strings.ToUpper(txid)
+	if _, exist := mt.promoted[txid]; exist {
+		return true
+	}
+	delete(mt.txs, txid)
+	return false
+}
+
+//settleMemPoolTxs 处理离开内存池的交易单：已上链的按上链高度重新通知，
+//超过dropDelay仍查不到的发送失败通知
+func (bs *BNBBlockScanner) settleMemPoolTxs(ctx context.Context) {
+
+	for txid, tx := range bs.memPool.left() {
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		if len(tx.extractData) == 0 {
+			bs.memPool.remove(txid)
+			continue
+		}
+
+		trx, err := bs.wm.RpcClient.GetTransaction(ctx, txid)
+		switch {
+		case err == nil:
+			result := ExtractResult{
+				TxID:        txid,
+				extractData: make(map[string]*openwallet.TxExtractData),
+				Success:     true,
+			}
+			if trx != nil {
+				result.BlockHeight = trx.BlockHeight
+			}
+			bs.extractTransaction(ctx, trx, &result, bs.ScanAddressFunc)
+			if !bs.memPool.promote(txid) {
+				//区块扫描已通知
+				continue
+			}
+			bs.wm.Log.Std.Info("mempool transaction [%s] committed on height: %d", txid, result.BlockHeight)
+			bs.newExtractDataNotify(result.BlockHeight, result.extractData)
+		case ErrorKind(err) == ErrTxNotFound && time.Since(tx.leftAt) >= bs.memPool.dropDelay:
+			bs.wm.Log.Std.Warning("mempool transaction [%s] dropped without being committed", txid)
+			bs.newExtractDataNotify(0, droppedExtractData(tx.extractData))
+			bs.memPool.remove(txid)
+		}
+	}
+}
+
+//droppedExtractData 复制待确认通知，交易单状态改为失败
+func droppedExtractData(extractData map[string]*openwallet.TxExtractData) map[string]*openwallet.TxExtractData {
+	dropped := make(map[string]*openwallet.TxExtractData, len(extractData))
+	for key, data := range extractData {
+		ed := openwallet.NewBlockExtractData()
+		ed.TxInputs = data.TxInputs
+		ed.TxOutputs = data.TxOutputs
+		if data.Transaction != nil {
+			tx := *data.Transaction
+			tx.Status = openwallet.TxStatusFail
+			tx.Reason = "dropped from mempool"
+			ed.Transaction = &tx
+		}
+		dropped[key] = ed
+	}
+	return dropped
+}
+
+//startMemPoolScan 开启内存池扫描时定时扫描，当前扫描上下文已有扫描在运行时不重复启动
+func (bs *BNBBlockScanner) startMemPoolScan() {
+	if !bs.IsScanMemPool {
+		return
+	}
+	ctx := bs.scanContext()
+
+	bs.ctxMu.Lock()
+	running := bs.memPoolCtx == ctx
+	bs.memPoolCtx = ctx
+	bs.ctxMu.Unlock()
+	if running {
+		return
+	}
+
+	go bs.memPoolScanLoop(ctx)
+}
+
+//memPoolScanLoop 按memPoolScanCycle扫描内存池，不等待区块扫描任务
+func (bs *BNBBlockScanner) memPoolScanLoop(ctx context.Context) {
+
+	interval := bs.wm.Config.MemPoolScanInterval
+	if interval <= 0 {
+		interval = defaultMemPoolScanInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !bs.Scanning {
+				continue
+			}
+			bs.ScanTxMemPool()
+		}
+	}
+}
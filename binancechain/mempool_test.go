@@ -0,0 +1,203 @@
+package binancechain
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/binance-chain/go-sdk/types/msg"
+	"github.com/binance-chain/go-sdk/types/tx"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+//memPoolObserver 记录扫描器发送的交易单通知
+type memPoolObserver struct {
+	mu    sync.Mutex
+	notes []*openwallet.Transaction
+}
+
+func (o *memPoolObserver) BlockScanNotify(header *openwallet.BlockHeader) error {
+	return nil
+}
+
+func (o *memPoolObserver) BlockExtractDataNotify(sourceKey string, data *openwallet.TxExtractData) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.notes = append(o.notes, data.Transaction)
+	return nil
+}
+
+func (o *memPoolObserver) take() []*openwallet.Transaction {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	notes := o.notes
+	o.notes = nil
+	return notes
+}
+
+//mockSendTx 生成from向to转账的交易单
+func mockSendTx(from, to types.AccAddress, amount int64) []byte {
+	coins := types.Coins{{Denom: "BNB", Amount: amount}}
+	sendMsg := msg.CreateSendMsg(from, coins, []msg.Transfer{{ToAddr: to, Coins: coins}})
+	stdTx := tx.NewStdTx([]msg.Msg{sendMsg}, []tx.StdSignature{}, "", 0, nil)
+	bz, _ := tx.Cdc.MarshalBinaryLengthPrefixed(stdTx)
+	return bz
+}
+
+func Test_scanTxMemPool(t *testing.T) {
+	sender := types.AccAddress(make([]byte, 20))
+	ours := types.AccAddress(append([]byte{1}, make([]byte, 19)...))
+
+	committed := mockSendTx(sender, ours, 100)
+	dropped := mockSendTx(sender, ours, 200)
+
+	var (
+		mu      sync.Mutex
+		pending = [][]byte{committed, dropped}
+		hidden  = 0 //超出返回数量未返回的交易单数
+		onChain = map[string][]byte{}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/status":
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":"","result":{"node_info":{"network":"Binance-Chain-Tigris"},"sync_info":{"latest_block_height":"50"}}}`)
+		case "/unconfirmed_txs":
+			txs := ""
+			for i, raw := range pending {
+				if i > 0 {
+					txs += ","
+				}
+				txs += `"` + base64.StdEncoding.EncodeToString(raw) + `"`
+			}
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":"","result":{"n_txs":"%d","total":"%d","txs":[%s]}}`, len(pending), len(pending)+hidden, txs)
+		case "/tx":
+			hash := strings.ToUpper(r.URL.Query().Get("hash")[2:])
+			raw, exist := onChain[hash]
+			if !exist {
+				fmt.Fprintf(w, `{"jsonrpc":"2.0","id":"","error":{"code":-32603,"message":"Internal error","data":"Tx (%s) not found"}}`, hash)
+				return
+			}
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":"","result":{"hash":"%s","height":"50","tx":"%s"}}`, hash, base64.StdEncoding.EncodeToString(raw))
+		case "/block":
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":"","result":{"block_meta":{"block_id":{"hash":"B10C"},"header":{"height":"50"}}}}`)
+		}
+	}))
+	defer server.Close()
+
+	wm := NewWalletManager()
+	c := NewClient(server.URL, false)
+	c.SetRetry(0, 0)
+	wm.RpcClient = c
+
+	bs := wm.Blockscanner
+	bs.memPool.dropDelay = 0
+	bs.ScanAddressFunc = func(address string) (string, bool) {
+		return "ours", address == ours.String()
+	}
+	observer := &memPoolObserver{}
+	bs.AddObserver(observer)
+
+	//进入内存池时发送未确认的通知
+	bs.ScanTxMemPool()
+	notes := observer.take()
+	if len(notes) != 2 {
+		t.Fatalf("expected 2 pending notifications, got %d", len(notes))
+	}
+	for _, note := range notes {
+		if note.BlockHeight != 0 || note.Status != openwallet.TxStatusSuccess {
+			t.Errorf("unexpected pending notification: %+v", note)
+		}
+	}
+
+	//仍在内存池时不重复通知
+	bs.ScanTxMemPool()
+	if notes := observer.take(); len(notes) != 0 {
+		t.Errorf("expected no repeated notification, got %d", len(notes))
+	}
+
+	//内存池超过单次返回数量时，未返回的交易单不视为已离开
+	mu.Lock()
+	pending, hidden = nil, 200
+	mu.Unlock()
+
+	bs.ScanTxMemPool()
+	if notes := observer.take(); len(notes) != 0 {
+		t.Errorf("expected no notification of a partial mempool, got %d", len(notes))
+	}
+
+	//一笔上链，一笔被丢弃
+	mu.Lock()
+	hidden = 0
+	onChain[txHash(committed)] = committed
+	mu.Unlock()
+
+	bs.ScanTxMemPool()
+	notes = observer.take()
+	if len(notes) != 2 {
+		t.Fatalf("expected 2 settled notifications, got %d", len(notes))
+	}
+	for _, note := range notes {
+		switch note.TxID {
+		case txHash(committed):
+			if note.BlockHeight != 50 || note.Status != openwallet.TxStatusSuccess {
+				t.Errorf("unexpected committed notification: %+v", note)
+			}
+		case txHash(dropped):
+			if note.Status != openwallet.TxStatusFail {
+				t.Errorf("unexpected dropped notification: %+v", note)
+			}
+		default:
+			t.Errorf("unexpected notification of [%s]", note.TxID)
+		}
+	}
+
+	bs.ScanTxMemPool()
+	if notes := observer.take(); len(notes) != 0 {
+		t.Errorf("expected settled transactions to be forgotten, got %d", len(notes))
+	}
+
+	//区块扫描不重复通知已按上链高度通知过的交易单，/block返回的txid是小写
+	if err := bs.BatchExtractTransaction(50, "B10C", []string{strings.ToLower(txHash(committed))}, false); err != nil {
+		t.Fatalf("extract block transactions failed unexpected error: %v", err)
+	}
+	if notes := observer.take(); len(notes) != 0 {
+		t.Errorf("expected no repeated notification from block scan, got %d", len(notes))
+	}
+
+	//区块扫描先提取到交易单时，离开内存池后不再由内存池通知
+	early := mockSendTx(sender, ours, 300)
+	mu.Lock()
+	pending = [][]byte{early}
+	mu.Unlock()
+
+	bs.ScanTxMemPool()
+	if notes := observer.take(); len(notes) != 1 {
+		t.Fatalf("expected 1 pending notification, got %d", len(notes))
+	}
+
+	mu.Lock()
+	onChain[txHash(early)] = early
+	mu.Unlock()
+	if err := bs.BatchExtractTransaction(50, "B10C", []string{strings.ToLower(txHash(early))}, false); err != nil {
+		t.Fatalf("extract block transactions failed unexpected error: %v", err)
+	}
+	if notes := observer.take(); len(notes) != 1 || notes[0].BlockHeight != 50 {
+		t.Fatalf("expected 1 committed notification from block scan, got %d", len(notes))
+	}
+
+	mu.Lock()
+	pending = nil
+	mu.Unlock()
+	bs.ScanTxMemPool()
+	bs.ScanTxMemPool()
+	if notes := observer.take(); len(notes) != 0 {
+		t.Errorf("expected no repeated notification from mempool, got %d", len(notes))
+	}
+}
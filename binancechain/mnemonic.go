@@ -0,0 +1,261 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package binancechain
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blocktree/go-owcdrivers/binancechainTransaction"
+	"github.com/blocktree/go-owcdrivers/owkeychain"
+	owcrypt "github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/openwallet/hdkeystore"
+	"github.com/blocktree/openwallet/openwallet"
+	bip39 "github.com/cosmos/go-bip39"
+)
+
+const (
+	BinanceAccountPath      = "m/44'/714'/0'" //Binance Chain钱包的账户路径，地址为m/44'/714'/0'/0/i
+	BIP39PathPrefix         = "bip39:"        //助记词恢复的地址HDPath前缀，与hdkeystore派生的路径区分，hdkeystore不能按此路径派生
+	defaultRecoveryGapLimit = 20              //默认连续无链上记录的地址数上限
+)
+
+//bip32MasterSeedKey BIP32根密钥的HMAC密钥
+var bip32MasterSeedKey = []byte("Bitcoin seed")
+
+//MnemonicSeed 校验12或24个单词的BIP39助记词，返回种子
+func MnemonicSeed(mnemonic, passphrase string) ([]byte, error) {
+	words := strings.Fields(mnemonic)
+	if len(words) != 12 && len(words) != 24 {
+		return nil, fmt.Errorf("mnemonic should have 12 or 24 words, got %d", len(words))
+	}
+	return bip39.NewSeedWithErrorChecking(strings.Join(words, " "), passphrase)
+}
+
+//DeriveBIP32PrivateKey 按BIP32从种子派生path的私钥。
+//hdkeystore的根密钥为sha512(seed)，与Binance Chain钱包的派生结果不同，助记词恢复的地址使用这里派生
+func DeriveBIP32PrivateKey(seed []byte, path string) ([]byte, error) {
+
+	path = strings.Replace(path, " ", "", -1)
+	if path != "m" && !strings.HasPrefix(path, "m/") {
+		return nil, owkeychain.ErrInvalidDerivedPath
+	}
+
+	i := hmacSHA512(bip32MasterSeedKey, seed)
+	key, chainCode := i[:32], i[32:]
+	if err := validatePrivateKey(key); err != nil {
+		return nil, owkeychain.ErrInvalidSeedLen
+	}
+
+	curveOrder := new(big.Int).SetBytes(binancechainTransaction.CurveOrder)
+	for _, elem := range strings.Split(path, "/")[1:] {
+		var serializes uint32
+		if strings.HasSuffix(elem, "'") {
+			elem = strings.TrimSuffix(elem, "'")
+			serializes = owkeychain.HardenedKeyStart
+		}
+		index, err := strconv.ParseUint(elem, 10, 31)
+		if err != nil {
+			return nil, owkeychain.ErrInvalidDerivedPath
+		}
+		serializes += uint32(index)
+
+		//强化扩展使用0x00+私钥，普通扩展使用压缩公钥
+		data := make([]byte, 0, 37)
+		if serializes >= owkeychain.HardenedKeyStart {
+			data = append(append(data, 0), key...)
+		} else {
+			data = append(data, owcrypt.Point_mulBaseG(key, owcrypt.ECC_CURVE_SECP256K1)...)
+		}
+		data = append(data, byte(serializes>>24), byte(serializes>>16), byte(serializes>>8), byte(serializes))
+
+		i = hmacSHA512(chainCode, data)
+		il := new(big.Int).SetBytes(i[:32])
+		if il.Cmp(curveOrder) >= 0 {
+			return nil, owkeychain.ErrInvalidChild
+		}
+		child := il.Add(il, new(big.Int).SetBytes(key))
+		child.Mod(child, curveOrder)
+		if child.Sign() == 0 {
+			return nil, owkeychain.ErrInvalidChild
+		}
+		key = make([]byte, 32)
+		b := child.Bytes()
+		copy(key[32-len(b):], b)
+		chainCode = i[32:]
+	}
+
+	return key, nil
+}
+
+func hmacSHA512(key, data []byte) []byte {
+	mac := hmac.New(sha512.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+//isBIP32Address 地址是否由助记词恢复，按BIP32派生
+func isBIP32Address(address *openwallet.Address) bool {
+	return address != nil && strings.HasPrefix(address.HDPath, BIP39PathPrefix)
+}
+
+//derivePrivateKey 派生钱包地址的私钥，导入私钥的地址使用种子，助记词恢复的地址按BIP32派生，其他地址使用hdkeystore的派生
+func derivePrivateKey(key *hdkeystore.HDKey, address *openwallet.Address, curveType uint32) ([]byte, error) {
+	if address != nil && address.HDPath == ImportedKeyPath {
+		return key.Seed(), nil
+	}
+	if isBIP32Address(address) {
+		return DeriveBIP32PrivateKey(key.Seed(), strings.TrimPrefix(address.HDPath, BIP39PathPrefix))
+	}
+	childKey, err := key.DerivedKeyWithPath(address.HDPath, curveType)
+	if err != nil {
+		return nil, err
+	}
+	return childKey.GetPrivateKeyBytes()
+}
+
+//RecoveredWallet 助记词恢复的钱包
+type RecoveredWallet struct {
+	Wallet    *openwallet.Wallet        //已保存密钥文件的钱包
+	Account   *openwallet.AssetsAccount //Binance Chain钱包路径的资产账户
+	Addresses []*openwallet.Address     //从0到最后一个有链上记录的地址，都没有记录时只有第一个地址
+	Active    []string                  //有链上记录的地址
+	Scanned   uint64                    //检查过的地址数
+}
+
+//RecoverWalletFromMnemonic 从Binance Chain钱包的助记词恢复钱包。
+//按m/44'/714'/0'/0/i派生地址并查询链上账户，连续RecoveryGapLimit个地址没有记录时停止，
+//种子保存到keyDir下的密钥文件，资产账户和地址保存到钱包数据库。
+//资产账户的公钥不是扩展公钥，openwallet不会在账户下按hdkeystore派生新地址
+func (wm *WalletManager) RecoverWalletFromMnemonic(alias, password, mnemonic, passphrase string) (*RecoveredWallet, error) {
+
+	if len(alias) == 0 {
+		return nil, errors.New("wallet alias is required")
+	}
+	if len(password) == 0 {
+		return nil, errors.New("wallet password is required")
+	}
+	seed, err := MnemonicSeed(mnemonic, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	gapLimit := wm.Config.RecoveryGapLimit
+	if gapLimit <= 0 {
+		gapLimit = defaultRecoveryGapLimit
+	}
+
+	var (
+		addresses  = make([]*openwallet.Address, 0)
+		active     = make([]string, 0)
+		lastActive = -1
+	)
+
+	//每批检查gapLimit个地址，批内一次并发查询
+	for len(addresses)-lastActive <= gapLimit {
+		batch := make([]string, 0, gapLimit)
+		for i, end := len(addresses), len(addresses)+gapLimit; i < end; i++ {
+			address, err := wm.bip32Address(seed, uint64(i))
+			if err != nil {
+				return nil, err
+			}
+			batch = append(batch, address.Address)
+			addresses = append(addresses, address)
+		}
+		infos, err := wm.GetAccounts(batch...)
+		if err != nil {
+			return nil, err
+		}
+		if len(infos) != len(batch) {
+			return nil, fmt.Errorf("queried %d accounts, got %d", len(batch), len(infos))
+		}
+		//账户信息按输入顺序返回，按派生序号记录
+		for i, info := range infos {
+			if info.AccountNumber == 0 && info.Sequence == 0 && len(info.Coins) == 0 {
+				continue
+			}
+			index := len(addresses) - len(batch) + i
+			active = append(active, addresses[index].Address)
+			lastActive = index
+		}
+	}
+
+	scanned := uint64(len(addresses))
+	if lastActive < 0 {
+		lastActive = 0
+	}
+	addresses = addresses[:lastActive+1]
+
+	accountPriv, err := DeriveBIP32PrivateKey(seed, BinanceAccountPath)
+	if err != nil {
+		return nil, err
+	}
+	accountPub := hex.EncodeToString(owcrypt.Point_mulBaseG(accountPriv, owcrypt.ECC_CURVE_SECP256K1))
+	account := &openwallet.AssetsAccount{
+		Alias:     alias,
+		AccountID: openwallet.GenAccountIDByHex(accountPub),
+		HDPath:    BIP39PathPrefix + BinanceAccountPath,
+		PublicKey: accountPub,
+		OwnerKeys: []string{accountPub},
+		Required:  1,
+		Symbol:    wm.Symbol(),
+	}
+
+	//登记钱包，钱包ID由种子计算，重复恢复得到同一个钱包
+	wallet, err := wm.storeWallet(alias, password, seed, BIP39PathPrefix+BinanceAccountPath, account, addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	wm.Log.Std.Info("wallet %s recovered from mnemonic, %d addresses, %d active in %d scanned", wallet.WalletID, len(addresses), len(active), scanned)
+
+	return &RecoveredWallet{
+		Wallet:    wallet,
+		Account:   account,
+		Addresses: addresses,
+		Active:    active,
+		Scanned:   scanned,
+	}, nil
+}
+
+//bip32Address 按Binance Chain钱包的路径派生第index个地址
+func (wm *WalletManager) bip32Address(seed []byte, index uint64) (*openwallet.Address, error) {
+	hdPath := fmt.Sprintf("%s/0/%d", BinanceAccountPath, index)
+	priv, err := DeriveBIP32PrivateKey(seed, hdPath)
+	if err != nil {
+		return nil, err
+	}
+	pub := owcrypt.Point_mulBaseG(priv, owcrypt.ECC_CURVE_SECP256K1)
+	address, err := wm.Decoder.PublicKeyToAddress(pub, wm.Config.IsTestNet)
+	if err != nil {
+		return nil, err
+	}
+	return &openwallet.Address{
+		Address:     address,
+		PublicKey:   hex.EncodeToString(pub),
+		Index:       index,
+		HDPath:      BIP39PathPrefix + hdPath,
+		Symbol:      wm.Symbol(),
+		CreatedTime: time.Now().Unix(),
+	}, nil
+}
@@ -0,0 +1,99 @@
+package binancechain
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/blocktree/binance-chain-adapter/binancechaintest"
+	"github.com/blocktree/openwallet/hdkeystore"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+//官方SDK测试使用的助记词，m/44'/714'/0'/0/0为bnb1ddt3ls9fjcd8mh69ujdg3fxc89qle2a7km33aa
+const sdkMnemonic = "bottom quick strong ranch section decide pepper broken oven demand coin run jacket curious business achieve mule bamboo remain vote kid rigid bench rubber"
+
+func Test_recoverWalletFromMnemonic(t *testing.T) {
+	node := binancechaintest.NewNode("")
+	defer node.Close()
+
+	wm, cleanup := newMockNodeWalletManager(t, node)
+	defer cleanup()
+	wm.Config.keyDir = filepath.Join(wm.Config.dbPath, "key")
+	wm.Config.RecoveryGapLimit = 3
+
+	seed, err := MnemonicSeed(sdkMnemonic, "")
+	if err != nil {
+		t.Fatalf("mnemonic seed failed unexpected error: %v", err)
+	}
+	first, _ := wm.bip32Address(seed, 0)
+	if first.Address != "bnb1ddt3ls9fjcd8mh69ujdg3fxc89qle2a7km33aa" {
+		t.Fatalf("first address = %s, expected the official wallet's address", first.Address)
+	}
+
+	//第3个地址在间隔内，第10个地址超过间隔
+	for _, i := range []uint64{0, 3, 10} {
+		address, _ := wm.bip32Address(seed, i)
+		node.Mint(address.Address, types.Coins{{Denom: "BNB", Amount: 100000000}})
+	}
+	node.ProduceBlock()
+
+	if _, err := wm.RecoverWalletFromMnemonic("legacy", "12345678", "bottom quick strong ranch", ""); err == nil {
+		t.Errorf("expected short mnemonic rejected")
+	}
+	recovered, err := wm.RecoverWalletFromMnemonic("legacy", "12345678", sdkMnemonic, "")
+	if err != nil {
+		t.Fatalf("recover wallet failed unexpected error: %v", err)
+	}
+	if len(recovered.Addresses) != 4 || len(recovered.Active) != 2 || recovered.Scanned != 9 {
+		t.Fatalf("recovered %d addresses, %d active in %d scanned, expected 4, 2 in 9", len(recovered.Addresses), len(recovered.Active), recovered.Scanned)
+	}
+	wallets, _ := wm.GetWallets()
+	if len(wallets) != 1 || wallets[0].WalletID != recovered.Wallet.WalletID {
+		t.Errorf("recovered wallet not registered: %+v", wallets)
+	}
+
+	//恢复的地址保存到钱包数据库，路径使用独立的命名空间
+	for i, address := range recovered.Addresses {
+		saved := recovered.Wallet.GetAddress(address.Address)
+		if saved == nil || saved.AccountID != recovered.Account.AccountID || saved.Index != uint64(i) || saved.HDPath != fmt.Sprintf("bip39:m/44'/714'/0'/0/%d", i) {
+			t.Errorf("recovered address %d not saved: %+v", i, saved)
+		}
+	}
+	if recovered.Active[0] != recovered.Addresses[0].Address || recovered.Active[1] != recovered.Addresses[3].Address {
+		t.Errorf("unexpected active addresses: %v", recovered.Active)
+	}
+
+	//恢复的地址按BIP32派生私钥签名
+	keyjson, _ := ioutil.ReadFile(recovered.Wallet.KeyFile)
+	key, err := hdkeystore.DecryptHDKey(keyjson, "12345678")
+	if err != nil {
+		t.Fatalf("decrypt wallet key failed unexpected error: %v", err)
+	}
+	address := recovered.Addresses[0]
+	if _, err := key.DerivedKeyWithPath(address.HDPath, wm.Config.CurveType); err == nil {
+		t.Errorf("expected hdkeystore derivation refused on recovered path %s", address.HDPath)
+	}
+	address.AccountID = "mock"
+	wallet := &mockWallet{key: key, address: address, extParam: make(map[string]interface{})}
+	rawTx := &openwallet.RawTransaction{
+		Coin:    openwallet.Coin{Symbol: Symbol, IsContract: true, Contract: openwallet.SmartContract{Symbol: Symbol, Address: "BNB", Decimals: 8}},
+		Account: &openwallet.AssetsAccount{AccountID: "mock"},
+		To:      map[string]string{recovered.Addresses[1].Address: "0.5"},
+	}
+	decoder := wm.TxDecoder
+	if err := decoder.CreateRawTransaction(wallet, rawTx); err != nil {
+		t.Fatalf("create transaction failed unexpected error: %v", err)
+	}
+	if err := decoder.SignRawTransaction(wallet, rawTx); err != nil {
+		t.Fatalf("sign transaction failed unexpected error: %v", err)
+	}
+	if err := decoder.VerifyRawTransaction(wallet, rawTx); err != nil || !rawTx.IsCompleted {
+		t.Fatalf("verify transaction failed: %v", err)
+	}
+	if _, err := decoder.SubmitRawTransaction(wallet, rawTx); err != nil {
+		t.Errorf("submit transaction failed unexpected error: %v", err)
+	}
+}
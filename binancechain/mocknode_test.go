@@ -0,0 +1,338 @@
+package binancechain
+
+import (
+	"context"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/blocktree/binance-chain-adapter/binancechaintest"
+	"github.com/blocktree/go-owcrypt"
+	"github.com/blocktree/openwallet/hdkeystore"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/tendermint/tendermint/crypto/secp256k1"
+)
+
+//scanObserver 记录扫描器发送的区块和交易单通知
+type scanObserver struct {
+	mu      sync.Mutex
+	headers []*openwallet.BlockHeader
+	txs     []*openwallet.Transaction
+}
+
+func (o *scanObserver) BlockScanNotify(header *openwallet.BlockHeader) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.headers = append(o.headers, header)
+	return nil
+}
+
+func (o *scanObserver) BlockExtractDataNotify(sourceKey string, data *openwallet.TxExtractData) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.txs = append(o.txs, data.Transaction)
+	return nil
+}
+
+func (o *scanObserver) take() ([]*openwallet.BlockHeader, []*openwallet.Transaction) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	headers, txs := o.headers, o.txs
+	o.headers, o.txs = nil, nil
+	return headers, txs
+}
+
+//newMockNodeWalletManager 连接模拟节点、使用临时数据目录的WalletManager
+func newMockNodeWalletManager(t *testing.T, node *binancechaintest.Node) (*WalletManager, func()) {
+	dir, err := ioutil.TempDir("", "binancechain")
+	if err != nil {
+		t.Fatalf("create temp dir failed unexpected error: %v", err)
+	}
+	wm := NewWalletManager()
+	wm.Config.dbPath = dir
+	c := NewClient(node.URL(), false)
+	c.SetRetry(0, 0)
+	wm.RpcClient = c
+	return wm, func() { os.RemoveAll(dir) }
+}
+
+func Test_mockNodeScanBlocks(t *testing.T) {
+	node := binancechaintest.NewNode("")
+	defer node.Close()
+
+	key := secp256k1.GenPrivKey()
+	sender := types.AccAddress(key.PubKey().Address())
+	ours := types.AccAddress(append([]byte{1}, make([]byte, 19)...))
+	node.Mint(sender.String(), types.Coins{{Denom: "BNB", Amount: 1000000000}})
+	node.ProduceBlock()
+
+	wm, cleanup := newMockNodeWalletManager(t, node)
+	defer cleanup()
+
+	bs := wm.Blockscanner
+	bs.Scanning = true
+	bs.RescanLastBlockCount = 0
+	bs.ScanAddressFunc = func(address string) (string, bool) {
+		return "ours", address == ours.String()
+	}
+	observer := &scanObserver{}
+	bs.AddObserver(observer)
+	wm.SaveLocalNewBlock(1, node.BlockHash(1))
+
+	deposit, _ := binancechaintest.NewSendTx(key, node.ChainID(), 0, 0, ours, types.Coins{{Denom: "BNB", Amount: 100000000}}, "10086")
+	if code, log, _ := node.Submit(deposit); code != binancechaintest.CodeOK {
+		t.Fatalf("submit deposit failed: [%d]%s", code, log)
+	}
+	node.ProduceBlock()
+
+	//节点暂时不可用时不记录未扫区块，下次任务继续
+	node.FailHTTP("block", 1, http.StatusServiceUnavailable)
+	bs.ScanBlockTask()
+	if height := bs.GetScannedBlockHeight(); height != 1 {
+		t.Fatalf("scanned height = %d after node error, expected 1", height)
+	}
+
+	bs.ScanBlockTask()
+	headers, txs := observer.take()
+	if height := bs.GetScannedBlockHeight(); height != 2 || len(headers) != 1 {
+		t.Fatalf("scanned height = %d with %d headers, expected 2 with 1", height, len(headers))
+	}
+	if len(txs) != 1 || txs[0].TxID != binancechaintest.TxHash(deposit) || txs[0].BlockHeight != 2 || txs[0].To[0] != ours.String()+":1" {
+		t.Fatalf("unexpected deposit notification: %+v", txs)
+	}
+
+	//分叉后的区块取代原区块，原充值不再存在
+	if err := node.Fork(1); err != nil {
+		t.Fatalf("fork failed unexpected error: %v", err)
+	}
+	replaced, _ := binancechaintest.NewSendTx(key, node.ChainID(), 0, 0, ours, types.Coins{{Denom: "BNB", Amount: 200000000}}, "")
+	node.Submit(replaced)
+	node.ProduceBlock()
+	node.ProduceBlock()
+
+	bs.ScanBlockTask()
+	headers, txs = observer.take()
+	forked := 0
+	for _, header := range headers {
+		if header.Fork {
+			forked++
+		}
+	}
+	if forked != 1 {
+		t.Errorf("expected 1 fork notification, got %d", forked)
+	}
+	if height, hash, _ := wm.GetLocalNewBlock(); height != 3 || hash != node.BlockHash(3) {
+		t.Errorf("scanned block = %d %s, expected 3 %s", height, hash, node.BlockHash(3))
+	}
+	if len(txs) != 1 || txs[0].TxID != binancechaintest.TxHash(replaced) || txs[0].To[0] != ours.String()+":2" {
+		t.Errorf("unexpected notifications after fork: %+v", txs)
+	}
+}
+
+//mockWallet 单个地址的钱包
+type mockWallet struct {
+	openwallet.WalletDAIBase
+	key      *hdkeystore.HDKey
+	address  *openwallet.Address
+	extParam map[string]interface{}
+}
+
+func (w *mockWallet) GetAddressList(offset, limit int, cols ...interface{}) ([]*openwallet.Address, error) {
+	return []*openwallet.Address{w.address}, nil
+}
+
+func (w *mockWallet) GetAddress(address string) (*openwallet.Address, error) {
+	return w.address, nil
+}
+
+func (w *mockWallet) HDKey(password ...string) (*hdkeystore.HDKey, error) {
+	return w.key, nil
+}
+
+func (w *mockWallet) SetAddressExtParam(address string, key string, val interface{}) error {
+	w.extParam[address+key] = val
+	return nil
+}
+
+func (w *mockWallet) GetAddressExtParam(address string, key string) (interface{}, error) {
+	return w.extParam[address+key], nil
+}
+
+func Test_mockNodeTransactionDecoder(t *testing.T) {
+	node := binancechaintest.NewNode("")
+	defer node.Close()
+
+	wm, cleanup := newMockNodeWalletManager(t, node)
+	defer cleanup()
+
+	seed := make([]byte, 32)
+	hdKey, err := hdkeystore.NewHDKey(seed, "mock", "m/44'/714'/0'")
+	if err != nil {
+		t.Fatalf("create hd key failed unexpected error: %v", err)
+	}
+	hdPath := "m/44'/714'/0'/0/0"
+	childKey, err := hdKey.DerivedKeyWithPath(hdPath, wm.Config.CurveType)
+	if err != nil {
+		t.Fatalf("derive key failed unexpected error: %v", err)
+	}
+	pubKey := childKey.GetPublicKeyBytes()
+	if len(pubKey) != secp256k1.PubKeySecp256k1Size {
+		pubKey = owcrypt.PointCompress(pubKey, wm.Config.CurveType)
+	}
+	from, _ := wm.Decoder.PublicKeyToAddress(pubKey, false)
+	to := types.AccAddress(append([]byte{2}, make([]byte, 19)...)).String()
+
+	wallet := &mockWallet{
+		key:      hdKey,
+		address:  &openwallet.Address{AccountID: "mock", Address: from, PublicKey: hex.EncodeToString(pubKey), HDPath: hdPath},
+		extParam: make(map[string]interface{}),
+	}
+
+	node.Mint(from, types.Coins{{Denom: "BNB", Amount: 100000000}})
+	node.ProduceBlock()
+
+	rawTx := &openwallet.RawTransaction{
+		Coin: openwallet.Coin{
+			Symbol:     Symbol,
+			IsContract: true,
+			Contract:   openwallet.SmartContract{Symbol: Symbol, Address: "BNB", Decimals: 8},
+		},
+		Account: &openwallet.AssetsAccount{AccountID: "mock"},
+		To:      map[string]string{to: "0.5"},
+	}
+
+	decoder := wm.TxDecoder
+	if err := decoder.CreateRawTransaction(wallet, rawTx); err != nil {
+		t.Fatalf("create transaction failed unexpected error: %v", err)
+	}
+	if rawTx.Fees != "0.000375" {
+		t.Errorf("fees = %s, expected 0.000375", rawTx.Fees)
+	}
+	if err := decoder.SignRawTransaction(wallet, rawTx); err != nil {
+		t.Fatalf("sign transaction failed unexpected error: %v", err)
+	}
+	if err := decoder.VerifyRawTransaction(wallet, rawTx); err != nil || !rawTx.IsCompleted {
+		t.Fatalf("verify transaction failed: %v", err)
+	}
+	trx, err := decoder.SubmitRawTransaction(wallet, rawTx)
+	if err != nil {
+		t.Fatalf("submit transaction failed unexpected error: %v", err)
+	}
+
+	node.ProduceBlock()
+
+	status, err := wm.RpcClient.GetTxStatus(context.Background(), trx.TxID)
+	if err != nil || status.Code != 0 || status.Height != 2 {
+		t.Errorf("unexpected transaction status: %+v, %v", status, err)
+	}
+	if acc := node.Account(to); acc == nil || acc.Coins.AmountOf("BNB") != 50000000 {
+		t.Errorf("unexpected recipient account: %+v", acc)
+	}
+	if acc := node.Account(from); acc.Coins.AmountOf("BNB") != 100000000-50000000-37500 || acc.Sequence != 1 {
+		t.Errorf("unexpected sender account: %+v", acc)
+	}
+
+	//余额不足时构建失败
+	rawTx.To = map[string]string{to: "1"}
+	rawTx.IsBuilt, rawTx.IsCompleted, rawTx.Signatures = false, false, nil
+	if err := decoder.CreateRawTransaction(wallet, rawTx); err == nil {
+		t.Errorf("expected insufficient balance error")
+	}
+}
+
+func Test_nativeCoinTransaction(t *testing.T) {
+	node := binancechaintest.NewNode("")
+	defer node.Close()
+
+	wm, cleanup := newMockNodeWalletManager(t, node)
+	defer cleanup()
+
+	hdKey, _ := hdkeystore.NewHDKey(make([]byte, 32), "mock", "m/44'/714'/0'")
+	hdPath := "m/44'/714'/0'/0/0"
+	childKey, _ := hdKey.DerivedKeyWithPath(hdPath, wm.Config.CurveType)
+	pubKey := childKey.GetPublicKeyBytes()
+	from, _ := wm.Decoder.PublicKeyToAddress(pubKey, false)
+	to := types.AccAddress(append([]byte{2}, make([]byte, 19)...)).String()
+	wallet := &mockWallet{
+		key:      hdKey,
+		address:  &openwallet.Address{AccountID: "mock", Address: from, PublicKey: hex.EncodeToString(pubKey), HDPath: hdPath},
+		extParam: make(map[string]interface{}),
+	}
+
+	node.Mint(from, types.Coins{{Denom: "BNB", Amount: 100000000}})
+	node.ProduceBlock()
+
+	//主链币不需要合约信息
+	decoder := wm.TxDecoder
+	account := &openwallet.AssetsAccount{AccountID: "mock"}
+	rawTx := &openwallet.RawTransaction{
+		Coin:    openwallet.Coin{Symbol: Symbol},
+		Account: account,
+		To:      map[string]string{to: "0.5"},
+	}
+	if err := decoder.CreateRawTransaction(wallet, rawTx); err != nil {
+		t.Fatalf("create transaction failed unexpected error: %v", err)
+	}
+	if err := decoder.SignRawTransaction(wallet, rawTx); err != nil {
+		t.Fatalf("sign transaction failed unexpected error: %v", err)
+	}
+	if err := decoder.VerifyRawTransaction(wallet, rawTx); err != nil || !rawTx.IsCompleted {
+		t.Fatalf("verify transaction failed: %v", err)
+	}
+	trx, err := decoder.SubmitRawTransaction(wallet, rawTx)
+	if err != nil || trx.Decimal != 8 {
+		t.Fatalf("submit transaction failed: %+v, %v", trx, err)
+	}
+	node.ProduceBlock()
+
+	//汇总剩余的BNB，扣除手续费
+	sumRawTxs, err := decoder.CreateSummaryRawTransaction(wallet, &openwallet.SummaryRawTransaction{
+		Coin:            openwallet.Coin{Symbol: Symbol},
+		Account:         account,
+		SummaryAddress:  to,
+		MinTransfer:     "0.1",
+		RetainedBalance: "0",
+		AddressLimit:    -1,
+	})
+	if err != nil || len(sumRawTxs) != 1 || sumRawTxs[0].To[to] != "0.49925" {
+		t.Fatalf("unexpected summary transactions: %+v, %v", sumRawTxs, err)
+	}
+	if err := decoder.SignRawTransaction(wallet, sumRawTxs[0]); err != nil {
+		t.Fatalf("sign summary transaction failed unexpected error: %v", err)
+	}
+	if err := decoder.VerifyRawTransaction(wallet, sumRawTxs[0]); err != nil || !sumRawTxs[0].IsCompleted {
+		t.Fatalf("verify summary transaction failed: %v", err)
+	}
+	if _, err := decoder.SubmitRawTransaction(wallet, sumRawTxs[0]); err != nil {
+		t.Fatalf("submit summary transaction failed unexpected error: %v", err)
+	}
+	node.ProduceBlock()
+	if acc := node.Account(from); acc.Coins.AmountOf("BNB") != 0 {
+		t.Errorf("unexpected sender account after summary: %+v", acc)
+	}
+
+	//扫描和余额按主链币返回
+	extracted, err := wm.Blockscanner.ExtractTransactionData(trx.TxID, func(target openwallet.ScanTarget) (string, bool) {
+		return "ours", target.Address == to
+	})
+	if err != nil || len(extracted["BNB:ours"]) != 1 {
+		t.Fatalf("extract transaction failed: %+v, %v", extracted, err)
+	}
+	if deposit := extracted["BNB:ours"][0]; deposit.Transaction.Coin.IsContract || deposit.Transaction.Decimal != 8 || deposit.TxOutputs[0].Coin.IsContract {
+		t.Errorf("unexpected deposit coin: %+v", deposit.Transaction.Coin)
+	}
+	balances, err := wm.Blockscanner.GetBalanceByAddress(to)
+	if err != nil || len(balances) != 1 || balances[0].Symbol != Symbol || balances[0].Balance != "0.99925" {
+		t.Errorf("unexpected BNB balance: %+v, %v", balances, err)
+	}
+
+	//合约币种缺少合约地址时拒绝构建
+	rawTx = &openwallet.RawTransaction{Coin: openwallet.Coin{Symbol: Symbol, IsContract: true}, Account: account, To: map[string]string{to: "0.1"}}
+	if err := decoder.CreateRawTransaction(wallet, rawTx); err == nil {
+		t.Errorf("expected missing contract error")
+	}
+}
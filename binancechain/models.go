@@ -19,7 +19,12 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/binance-chain/go-sdk/types/msg"
 	"github.com/blocktree/go-owcdrivers/binancechainTransaction"
+	"github.com/tendermint/tendermint/crypto/secp256k1"
+	tmtypes "github.com/tendermint/tendermint/types"
+	"sort"
 	"time"
 
 	"github.com/blocktree/go-owcrypt"
@@ -34,12 +39,142 @@ type Block struct {
 	VersionBlock  byte
 	VersionApp    byte
 	ChainID       string
-	Height        uint64
+	Height        uint64 `storm:"id"` //按高度保存，分叉后覆盖原区块
 	Timestamp     uint64
 	PrevBlockHash string
 	Transactions  []string
+	Verified      bool //区块头是否已通过验证人签名验证
+
+	rawTxs tmtypes.Txs
+}
+
+
+//NodeStatus 节点状态，来自/status
+type NodeStatus struct {
+	Network           string
+	LatestBlockHash   string
+	LatestBlockHeight uint64
+	LatestBlockTime   time.Time
+	CatchingUp        bool
+}
+
+func NewNodeStatus(json *gjson.Result) *NodeStatus {
+	return newNodeStatus(json.Get("result"))
+}
+
+//newNodeStatus 解析node_info和sync_info，HTTP API的/node-info没有result一层
+func newNodeStatus(result gjson.Result) *NodeStatus {
+	obj := &NodeStatus{}
+
+	obj.Network = result.Get("node_info").Get("network").String()
+	obj.LatestBlockHash = result.Get("sync_info").Get("latest_block_hash").String()
+	obj.LatestBlockHeight = result.Get("sync_info").Get("latest_block_height").Uint()
+	obj.LatestBlockTime, _ = time.Parse(time.RFC3339Nano, result.Get("sync_info").Get("latest_block_time").String())
+	obj.CatchingUp = result.Get("sync_info").Get("catching_up").Bool()
+
+	return obj
+}
+
+//AccountCoin 账户中一种币的余额，单位为最小单位
+type AccountCoin struct {
+	Denom  string
+	Free   int64 //可用余额
+	Frozen int64 //冻结余额，如挂单占用
+	Locked int64 //锁定余额，如时间锁
+}
+
+//Total 总余额
+func (coin AccountCoin) Total() int64 {
+	return coin.Free + coin.Frozen + coin.Locked
+}
+
+//AccountInfo 账户信息，来自/store/acc/key
+type AccountInfo struct {
+	Address       string
+	AccountNumber int64
+	Sequence      int64
+	Flags         uint64
+	PubKey        string        //公钥hex，账户未发送过交易时为空
+	Coins         []AccountCoin //按Denom排序
+}
+
+//NewAccountInfo 根据链上账户生成账户信息，acc为nil表示账户不存在
+func NewAccountInfo(address string, acc types.Account) *AccountInfo {
+	obj := &AccountInfo{
+		Address: address,
+		Coins:   make([]AccountCoin, 0),
+	}
+	if acc == nil {
+		return obj
+	}
+
+	obj.AccountNumber = acc.GetAccountNumber()
+	obj.Sequence = acc.GetSequence()
+
+	switch pubKey := acc.GetPubKey().(type) {
+	case nil:
+	case secp256k1.PubKeySecp256k1:
+		obj.PubKey = hex.EncodeToString(pubKey[:])
+	default:
+		obj.PubKey = hex.EncodeToString(pubKey.Bytes())
+	}
+
+	coins := make(map[string]*AccountCoin)
+	coinOf := func(denom string) *AccountCoin {
+		if coins[denom] == nil {
+			coins[denom] = &AccountCoin{Denom: denom}
+		}
+		return coins[denom]
+	}
+
+	for _, coin := range acc.GetCoins() {
+		coinOf(coin.Denom).Free = coin.Amount
+	}
+
+	if named, ok := acc.(types.NamedAccount); ok {
+		for _, coin := range named.GetFrozenCoins() {
+			coinOf(coin.Denom).Frozen = coin.Amount
+		}
+		for _, coin := range named.GetLockedCoins() {
+			coinOf(coin.Denom).Locked = coin.Amount
+		}
+	}
+	if appAcc, ok := acc.(*types.AppAccount); ok {
+		obj.Flags = appAcc.Flags
+	}
+
+	for _, coin := range coins {
+		obj.Coins = append(obj.Coins, *coin)
+	}
+	sort.Slice(obj.Coins, func(i, j int) bool {
+		return obj.Coins[i].Denom < obj.Coins[j].Denom
+	})
+
+	return obj
+}
+
+//Coin 指定币种的余额，没有该币种时余额为0
+func (info *AccountInfo) Coin(denom string) AccountCoin {
+	for _, coin := range info.Coins {
+		if coin.Denom == denom {
+			return coin
+		}
+	}
+	return AccountCoin{Denom: denom}
 }
 
+//Balance 转为openwallet余额：Balance为总余额，ConfirmBalance为可用余额，
+//UnconfirmBalance为冻结和锁定的余额
+func (info *AccountInfo) Balance(symbol, denom string, decimals uint64) *openwallet.Balance {
+	coin := info.Coin(denom)
+	return &openwallet.Balance{
+		Symbol:           symbol,
+		Address:          info.Address,
+		Balance:          convertToAmountWithDecimal(uint64(coin.Total()), decimals),
+		ConfirmBalance:   convertToAmountWithDecimal(uint64(coin.Free), decimals),
+		UnconfirmBalance: convertToAmountWithDecimal(uint64(coin.Frozen+coin.Locked), decimals),
+	}
+}
 
 type FeeValue struct {
 	Amount uint64
@@ -64,43 +199,70 @@ type Transaction struct {
 }
 
 
-func NewTransaction(json *gjson.Result) *Transaction {
-	obj := Transaction{}
-	obj.TxDetails = make(map[string](*TxDetail))
+//OutputCount 全部输出的币种数量之和，用于计算批量转账手续费
+func (trx *Transaction) OutputCount() int {
+	count := 0
+	for _, detail := range trx.TxDetails {
+		count += len(detail.To)
+	}
+	return count
+}
+
+//NewTransaction 解码节点返回的交易单，地址按prefix编码
+func NewTransaction(json *gjson.Result, prefix string) *Transaction {
 
 	base64decoder := base64.StdEncoding
 
 	trxBytes, _ := base64decoder.DecodeString(json.Get("tx").String())
+	obj := newTransactionFromBytes(trxBytes, prefix)
+	if obj == nil {
+		return nil
+	}
+
+	obj.TxID = json.Get("hash").String()
+	obj.BlockHeight = json.Get("height").Uint()
+
+	return obj
+}
+
+//newTransactionFromBytes 解码原始交易单，地址按prefix编码，无法解码时返回nil
+func newTransactionFromBytes(trxBytes []byte, prefix string) *Transaction {
+	obj := Transaction{}
+	obj.TxDetails = make(map[string](*TxDetail))
+
 	trx, err := binancechainTransaction.DecodeRawTransaction(trxBytes)
 	if err != nil {
 		return nil
 	}
 
-	for _, input := range gjson.Get(string(trx.GetMsgs()[0].GetSignBytes()), "inputs").Array() {
-		for _, coin := range input.Get("coins").Array() {
-			denom := coin.Get("denom").String()
+	//go-sdk的签名数据按全局的types.Network编码地址，这里按prefix编码
+	sendMsg, _ := trx.GetMsgs()[0].(msg.SendMsg)
+
+	for _, input := range sendMsg.Inputs {
+		address := encodeAddress(input.Address, prefix)
+		for _, coin := range input.Coins {
+			denom := coin.Denom
 			if obj.TxDetails[denom] == nil {
 				obj.TxDetails[denom] = &TxDetail{}
 				obj.TxDetails[denom].Denom = denom
 			}
-			obj.TxDetails[denom].From = append(obj.TxDetails[denom].From, AddrAmount{input.Get("address").String(), coin.Get("amount").Uint()})
+			obj.TxDetails[denom].From = append(obj.TxDetails[denom].From, AddrAmount{address, uint64(coin.Amount)})
 		}
 	}
 
-	for _, output := range gjson.Get(string(trx.GetMsgs()[0].GetSignBytes()), "outputs").Array() {
-		for _, coin := range output.Get("coins").Array() {
-			denom := coin.Get("denom").String()
+	for _, output := range sendMsg.Outputs {
+		address := encodeAddress(output.Address, prefix)
+		for _, coin := range output.Coins {
+			denom := coin.Denom
 			if obj.TxDetails[denom] == nil {
 				obj.TxDetails[denom] = &TxDetail{}
 				obj.TxDetails[denom].Denom = denom
 			}
-			obj.TxDetails[denom].To = append(obj.TxDetails[denom].To, AddrAmount{output.Get("address").String(), coin.Get("amount").Uint()})
+			obj.TxDetails[denom].To = append(obj.TxDetails[denom].To, AddrAmount{address, uint64(coin.Amount)})
 		}
 	}
 
 	obj.Memo = trx.Memo
-	obj.TxID = json.Get("hash").String()
-	obj.BlockHeight = json.Get("height").Uint()
 
 	return &obj
 }
@@ -124,6 +286,7 @@ func NewBlock(json *gjson.Result) *Block {
 
 		for _, tx := range txs {
 			txid, _ := base64.StdEncoding.DecodeString(tx.String())
+			obj.rawTxs = append(obj.rawTxs, txid)
 			obj.Transactions = append(obj.Transactions, hex.EncodeToString(owcrypt.Hash(txid, 0, owcrypt.HASH_ALG_SHA256)))
 		}
 	}
@@ -0,0 +1,145 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package binancechain
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	MainnetChainID = "Binance-Chain-Tigris" //主网链ID
+	TestnetChainID = "Binance-Chain-Nile"   //测试网链ID
+
+	MainnetAddressPrefix = "bnb"  //主网地址的bech32前缀
+	TestnetAddressPrefix = "tbnb" //测试网地址的bech32前缀
+
+	defaultNetworkCheckInterval = 5 * time.Minute //默认链ID复查间隔
+)
+
+//NetworkChecker 检查节点/status返回的node_info.network是否与配置的网络和链ID一致，
+//不一致时拒绝扫描和签名，并按Interval定期复查，防止负载均衡后的节点被替换
+type NetworkChecker struct {
+	mu        sync.Mutex
+	IsTestNet bool          //配置的网络是否测试网
+	ChainID   string        //期望的链ID，为空时只区分主网和测试网
+	Interval  time.Duration //复查间隔
+	backend   func() ChainBackend
+	network   string    //节点返回的链ID
+	checked   time.Time //最近一次成功检查的时间
+	err       error     //最近一次检查的结果
+}
+
+//NewNetworkChecker 创建链ID检查器，backend返回当前的数据源
+func NewNetworkChecker(backend func() ChainBackend) *NetworkChecker {
+	return &NetworkChecker{
+		Interval: defaultNetworkCheckInterval,
+		backend:  backend,
+	}
+}
+
+//ExpectedChainID 期望的链ID，未配置时主网为Binance-Chain-Tigris，测试网为Binance-Chain-Nile
+func (nc *NetworkChecker) ExpectedChainID() string {
+	if len(nc.ChainID) > 0 {
+		return nc.ChainID
+	}
+	if nc.IsTestNet {
+		return TestnetChainID
+	}
+	return MainnetChainID
+}
+
+//SignChainID 签名文档使用的链ID，只由配置决定，不使用节点返回的链ID
+func (nc *NetworkChecker) SignChainID() string {
+	return nc.ExpectedChainID()
+}
+
+//validate 检查配置的网络和链ID是否一致
+func (nc *NetworkChecker) validate() error {
+	if len(nc.ChainID) == 0 {
+		return nil
+	}
+	if nc.IsTestNet == (nc.ChainID == MainnetChainID) {
+		return fmt.Errorf("chainID %s conflicts with isTestNet = %v", nc.ChainID, nc.IsTestNet)
+	}
+	return nil
+}
+
+//match 节点返回的链ID是否与期望的链ID一致
+func (nc *NetworkChecker) match(network string) error {
+	if len(network) == 0 {
+		return mismatchError("node returned no network")
+	}
+	if expected := nc.ExpectedChainID(); network != expected {
+		return mismatchError("node serves %s, expected %s", network, expected)
+	}
+	return nil
+}
+
+//mismatchError 链ID不一致的错误
+func mismatchError(format string, a ...interface{}) error {
+	return &RPCError{Kind: ErrNetworkMismatch, Message: fmt.Sprintf(format, a...)}
+}
+
+//Check 立即通过/status检查节点的链ID，节点无法访问时返回节点错误，之前的检查结果不变
+func (nc *NetworkChecker) Check(ctx context.Context) error {
+
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	if err := nc.validate(); err != nil {
+		return err
+	}
+
+	status, err := nc.backend().GetNodeStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	nc.network = status.Network
+	nc.checked = time.Now()
+	nc.err = nc.match(status.Network)
+	return nc.err
+}
+
+//Verify 距上次检查未超过Interval时返回上次的结果，否则重新检查
+func (nc *NetworkChecker) Verify(ctx context.Context) error {
+	nc.mu.Lock()
+	checked, err := nc.checked, nc.err
+	nc.mu.Unlock()
+
+	if !checked.IsZero() && time.Since(checked) < nc.Interval {
+		return err
+	}
+	return nc.Check(ctx)
+}
+
+//Network 最近一次检查时节点返回的链ID
+func (nc *NetworkChecker) Network() string {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	return nc.network
+}
+
+//AddressPrefix 网络对应的地址bech32前缀
+func AddressPrefix(isTestNet bool) string {
+	if isTestNet {
+		return TestnetAddressPrefix
+	}
+	return MainnetAddressPrefix
+}
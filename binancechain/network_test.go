@@ -0,0 +1,242 @@
+package binancechain
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/astaxie/beego/config"
+	"github.com/binance-chain/go-sdk/common/bech32"
+	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/binance-chain/go-sdk/types/msg"
+	"github.com/binance-chain/go-sdk/types/tx"
+	"github.com/blocktree/binance-chain-adapter/binancechaintest"
+	"github.com/blocktree/openwallet/hdkeystore"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+func Test_networkChecker(t *testing.T) {
+	testnet := binancechaintest.NewNode(TestnetChainID)
+	defer testnet.Close()
+	mainnet := binancechaintest.NewNode(MainnetChainID)
+	defer mainnet.Close()
+	testnet.ProduceBlock()
+
+	wm, cleanup := newMockNodeWalletManager(t, testnet)
+	defer cleanup()
+
+	//主网配置连接测试网节点时拒绝扫描和构建交易
+	if err := wm.Network.Check(context.Background()); ErrorKind(err) != ErrNetworkMismatch || wm.Network.Network() != TestnetChainID {
+		t.Fatalf("expected network mismatch, got %v", err)
+	}
+	bs := wm.Blockscanner
+	bs.Scanning = true
+	bs.RescanLastBlockCount = 0
+	bs.ScanBlockTask()
+	if height := bs.GetScannedBlockHeight(); height != 0 {
+		t.Errorf("scanned height = %d on mismatched network, expected 0", height)
+	}
+	if err := bs.ScanBlock(1); ErrorKind(err) != ErrNetworkMismatch {
+		t.Errorf("expected ScanBlock refused, got %v", err)
+	}
+	rawTx := &openwallet.RawTransaction{
+		Coin:    openwallet.Coin{Symbol: Symbol, IsContract: true, Contract: openwallet.SmartContract{Address: "BNB", Decimals: 8}},
+		Account: &openwallet.AssetsAccount{AccountID: "mock"},
+	}
+	if err := wm.TxDecoder.CreateRawTransaction(&mockWallet{}, rawTx); err == nil {
+		t.Errorf("expected create transaction refused on mismatched network")
+	}
+
+	wm.Network.IsTestNet = true
+	if err := wm.Network.Check(context.Background()); err != nil {
+		t.Errorf("testnet check failed unexpected error: %v", err)
+	}
+	wm.Network.ChainID = "Binance-Chain-Ganges"
+	if err := wm.Network.Check(context.Background()); ErrorKind(err) != ErrNetworkMismatch {
+		t.Errorf("expected chain id mismatch, got %v", err)
+	}
+	wm.Network.IsTestNet = false
+	wm.Network.ChainID = TestnetChainID
+	if err := wm.Network.Check(context.Background()); err == nil || ErrorKind(err) == ErrNetworkMismatch {
+		t.Errorf("expected conflicting config error, got %v", err)
+	}
+
+	//复查间隔内使用上次结果，之后发现节点被替换
+	wm.Network.IsTestNet = true
+	wm.Network.ChainID = ""
+	wm.Network.Interval = time.Hour
+	if err := wm.Network.Check(context.Background()); err != nil {
+		t.Fatalf("testnet check failed unexpected error: %v", err)
+	}
+	c := NewClient(mainnet.URL(), false)
+	c.SetRetry(0, 0)
+	wm.RpcClient = c
+	if err := wm.Network.Verify(context.Background()); err != nil {
+		t.Errorf("expected cached result within interval, got %v", err)
+	}
+	wm.Network.Interval = 0
+	if err := wm.Network.Verify(context.Background()); ErrorKind(err) != ErrNetworkMismatch {
+		t.Errorf("expected mismatch after node swap, got %v", err)
+	}
+
+	//启动时发现网络不一致
+	conf, _ := config.NewConfigData("ini", []byte("rpcAPI = "+testnet.URL()+"\nisTestNet = false\n"))
+	if err := NewWalletManager().LoadAssetsConfig(conf); ErrorKind(err) != ErrNetworkMismatch {
+		t.Errorf("expected LoadAssetsConfig refused, got %v", err)
+	}
+
+	//测试网的签名链ID只由配置决定，节点返回其它测试网链ID时拒绝
+	ganges := binancechaintest.NewNode("Binance-Chain-Ganges")
+	defer ganges.Close()
+	c = NewClient(ganges.URL(), false)
+	c.SetRetry(0, 0)
+	wm.RpcClient = c
+	if err := wm.Network.Check(context.Background()); ErrorKind(err) != ErrNetworkMismatch {
+		t.Errorf("expected mismatch on unconfigured testnet chain id, got %v", err)
+	}
+	if chainID := wm.signChainID(); chainID != TestnetChainID {
+		t.Errorf("sign chain id = %s, expected %s", chainID, TestnetChainID)
+	}
+
+	//加载测试网配置不修改go-sdk全局的地址前缀
+	conf, _ = config.NewConfigData("ini", []byte("rpcAPI = "+testnet.URL()+"\nisTestNet = true\n"))
+	if err := NewWalletManager().LoadAssetsConfig(conf); err != nil {
+		t.Fatalf("load testnet config failed unexpected error: %v", err)
+	}
+	if types.Network != types.ProdNetwork {
+		t.Errorf("LoadAssetsConfig changed the go-sdk global network")
+	}
+}
+
+func Test_mismatchedNodeExcluded(t *testing.T) {
+	tigris := binancechaintest.NewNode(MainnetChainID)
+	defer tigris.Close()
+	ganges := binancechaintest.NewNode("Binance-Chain-Ganges")
+	defer ganges.Close()
+	tigris.ProduceBlock()
+	ganges.ProduceBlock()
+
+	network := NewNetworkChecker(nil)
+	c := NewMultiNodeClient([]string{tigris.URL(), ganges.URL()}, false)
+	c.SetRetry(0, 0)
+	c.SetNetworkCheck(network.match)
+	c.CheckNodes()
+
+	//链ID正确的节点出错时调用失败，不能切换到其它链的节点
+	tigris.FailHTTP("block", 2, http.StatusInternalServerError)
+	if _, err := c.getBlockByHeight(1); ErrorKind(err) != ErrNodeUnavailable {
+		t.Errorf("expected the call to fail without the mismatched node, got %v", err)
+	}
+	if node := c.wsNode(context.Background()); node == nil || node.URL != tigris.URL() {
+		t.Errorf("websocket should not use the mismatched node, got %+v", node)
+	}
+	for _, node := range c.Nodes() {
+		if node.URL == ganges.URL() && !node.NetworkMismatch {
+			t.Errorf("node [%s] should stay marked as mismatched", node.URL)
+		}
+	}
+
+	//没有链ID正确的节点时不调用
+	c = NewMultiNodeClient([]string{ganges.URL()}, false)
+	c.SetNetworkCheck(network.match)
+	c.CheckNodes()
+	if _, err := c.getBlockByHeight(1); ErrorKind(err) != ErrNetworkMismatch {
+		t.Errorf("expected no node on the expected network, got %v", err)
+	}
+}
+
+func Test_testnetTransaction(t *testing.T) {
+	node := binancechaintest.NewNode(TestnetChainID)
+	defer node.Close()
+
+	wm, cleanup := newMockNodeWalletManager(t, node)
+	defer cleanup()
+	wm.Config.IsTestNet = true
+	wm.Network.IsTestNet = true
+	wm.RpcClient.(*Client).AddressPrefix = TestnetAddressPrefix
+
+	hdKey, _ := hdkeystore.NewHDKey(make([]byte, 32), "mock", "m/44'/714'/0'")
+	hdPath := "m/44'/714'/0'/0/0"
+	childKey, _ := hdKey.DerivedKeyWithPath(hdPath, wm.Config.CurveType)
+	pubKey := childKey.GetPublicKeyBytes()
+
+	//openwallet批量创建地址时isTestnet为false，仍按配置使用测试网前缀
+	from, _ := wm.Decoder.PublicKeyToAddress(pubKey, false)
+	to, _ := bech32.ConvertAndEncode(TestnetAddressPrefix, append([]byte{2}, make([]byte, 19)...))
+	if !strings.HasPrefix(from, "tbnb1") {
+		t.Fatalf("address = %s, expected tbnb prefix", from)
+	}
+	mainnetTo, _ := bech32.ConvertAndEncode(MainnetAddressPrefix, append([]byte{2}, make([]byte, 19)...))
+	if _, err := wm.RpcClient.(*Client).getBalance(mainnetTo, "BNB"); err == nil {
+		t.Errorf("expected mainnet address rejected on testnet")
+	}
+
+	//主网前缀的签名数据与go-sdk一致，测试网前缀不依赖全局的types.Network
+	sendMsg, _ := createSendMsg(MainnetAddressPrefix, mainnetTo, mainnetTo, "BNB", 1)
+	expected := tx.StdSignBytes(MainnetChainID, 1, 2, []msg.Msg{sendMsg}, "memo", 0, nil)
+	if signBytes := stdSignBytes(MainnetChainID, MainnetAddressPrefix, sendMsg, 1, 2, "memo", 0, nil); string(signBytes) != string(expected) {
+		t.Errorf("sign bytes = %s, expected %s", signBytes, expected)
+	}
+	if signBytes := (prefixedSendMsg{SendMsg: sendMsg, prefix: TestnetAddressPrefix}).GetSignBytes(); !strings.Contains(string(signBytes), to[:5]) {
+		t.Errorf("sign bytes %s not encoded with testnet prefix", signBytes)
+	}
+
+	wallet := &mockWallet{
+		key:      hdKey,
+		address:  &openwallet.Address{AccountID: "mock", Address: from, PublicKey: hex.EncodeToString(pubKey), HDPath: hdPath},
+		extParam: make(map[string]interface{}),
+	}
+	node.Mint(from, types.Coins{{Denom: "BNB", Amount: 100000000}})
+	node.ProduceBlock()
+
+	bs := wm.Blockscanner
+	bs.Scanning = true
+	bs.RescanLastBlockCount = 0
+	bs.ScanAddressFunc = func(address string) (string, bool) { return "ours", address == to }
+	observer := &scanObserver{}
+	bs.AddObserver(observer)
+	wm.SaveLocalNewBlock(1, node.BlockHash(1))
+
+	rawTx := &openwallet.RawTransaction{
+		Coin:    openwallet.Coin{Symbol: Symbol, IsContract: true, Contract: openwallet.SmartContract{Symbol: Symbol, Address: "BNB", Decimals: 8}},
+		Account: &openwallet.AssetsAccount{AccountID: "mock"},
+		To:      map[string]string{mainnetTo: "0.5"},
+	}
+	decoder := wm.TxDecoder
+	if err := decoder.CreateRawTransaction(wallet, rawTx); err == nil {
+		t.Errorf("expected mainnet recipient rejected on testnet")
+	}
+
+	//签名文档使用测试网链ID，节点按Binance-Chain-Nile验证签名
+	rawTx.To = map[string]string{to: "0.5"}
+	if err := decoder.CreateRawTransaction(wallet, rawTx); err != nil {
+		t.Fatalf("create transaction failed unexpected error: %v", err)
+	}
+	if !strings.Contains(rawTx.RawHex, `"chain_id":"Binance-Chain-Nile"`) || !strings.Contains(rawTx.RawHex, from) {
+		t.Errorf("unexpected sign doc: %s", rawTx.RawHex)
+	}
+	if err := decoder.SignRawTransaction(wallet, rawTx); err != nil {
+		t.Fatalf("sign transaction failed unexpected error: %v", err)
+	}
+	if err := decoder.VerifyRawTransaction(wallet, rawTx); err != nil || !rawTx.IsCompleted {
+		t.Fatalf("verify transaction failed: %v", err)
+	}
+	if _, err := decoder.SubmitRawTransaction(wallet, rawTx); err != nil {
+		t.Fatalf("submit transaction failed unexpected error: %v", err)
+	}
+	if _, ok := wallet.extParam[from+wm.FullName()]; !ok {
+		t.Errorf("sequence not saved for %s", from)
+	}
+	node.ProduceBlock()
+
+	if acc := node.Account(to); acc == nil || acc.Coins.AmountOf("BNB") != 50000000 {
+		t.Errorf("unexpected recipient account: %+v", acc)
+	}
+	bs.ScanBlockTask()
+	if _, txs := observer.take(); len(txs) != 1 || txs[0].To[0] != to+":0.5" || txs[0].From[0] != from+":0.5" {
+		t.Errorf("unexpected notifications: %+v", txs)
+	}
+}
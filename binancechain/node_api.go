@@ -16,21 +16,29 @@
 package binancechain
 
 import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
 	"encoding/base64"
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"github.com/binance-chain/go-sdk/common/bech32"
 	"github.com/binance-chain/go-sdk/common/types"
-	"github.com/binance-chain/go-sdk/types/tx"
-	"github.com/blocktree/go-owcdrivers/binancechainTransaction"
 	"github.com/blocktree/openwallet/log"
 	"github.com/imroc/req"
-	"github.com/tendermint/go-amino"
-	core_types "github.com/tendermint/tendermint/rpc/core/types"
 	"github.com/tidwall/gjson"
 	"math/big"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRetryCount   = 2                      //默认重试次数
+	defaultRetryBackoff = 500 * time.Millisecond //默认首次重试等待时间
+	defaultRPCTimeout   = 30 * time.Second       //默认单次请求超时时间
+	maxRetryBackoff     = 10 * time.Second       //重试等待时间上限
 )
 
 type ClientInterface interface {
@@ -45,7 +53,24 @@ type Client struct {
 	AccessToken string
 	Debug       bool
 	client      *req.Req
+	nodes       *nodePool
 	//Client *req.Req
+	RetryCount     int           //可重试错误的重试次数
+	RetryBackoff   time.Duration //首次重试的等待时间，之后按指数增长
+	Timeout        time.Duration //单次请求超时时间，0为不限制
+	BatchWorkers   int           //批量查询的并发数
+	BatchRateLimit int           //批量查询每秒请求数上限，0为不限速
+	VerifyProof    bool          //账户查询是否要求Merkle证明并验证
+	ServerType     int           //节点接口类型，RpcServerTendermint或RpcServerDex
+	AddressPrefix  string        //查询账户时要求的地址前缀，主网bnb，测试网tbnb
+	accounts       *accountCache
+	fees           *feeCache
+	lightClient    *LightClient
+	memPool        *memPoolSnapshot
+	networkCheck   func(network string) error
+	transport      TransportOptions
+	tlsConfig      *tls.Config
+	proxy          func(*http.Request) (*url.URL, error)
 }
 
 type Response struct {
@@ -57,34 +82,241 @@ type Response struct {
 }
 
 func NewClient(url string, debug bool) *Client {
+	return NewMultiNodeClient([]string{url}, debug)
+}
+
+//NewMultiNodeClient 创建多节点客户端，调用失败时自动切换到其他节点
+func NewMultiNodeClient(urls []string, debug bool) *Client {
 	c := Client{
-		BaseURL: url,
 		//AccessToken: token,
-		Debug: debug,
+		Debug:         debug,
+		nodes:         newNodePool(urls),
+		RetryCount:    defaultRetryCount,
+		RetryBackoff:  defaultRetryBackoff,
+		Timeout:       defaultRPCTimeout,
+		BatchWorkers:  defaultBatchWorkers,
+		AddressPrefix: MainnetAddressPrefix,
+		accounts:      newAccountCache(defaultAccountCacheTTL),
+		fees:          newFeeCache(defaultFeeCacheTTL),
+		memPool:       &memPoolSnapshot{},
+	}
+
+	if len(urls) > 0 {
+		c.BaseURL = urls[0]
 	}
 
 	api := req.New()
 	//trans, _ := api.Client().Transport.(*http.Transport)
 	//trans.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	//req在第一次请求时才创建http.Client，提前创建避免批量查询并发请求时竞争
+	api.Client()
 	c.client = api
 
 	return &c
 }
 
+//SetHealthCheck 设置节点健康检查间隔和允许落后的区块数
+func (c *Client) SetHealthCheck(interval time.Duration, maxHeightLag uint64) {
+	c.nodes.mu.Lock()
+	defer c.nodes.mu.Unlock()
+	if interval > 0 {
+		c.nodes.HealthCheckInterval = interval
+	}
+	c.nodes.MaxHeightLag = maxHeightLag
+}
+
+//SetRetry 设置可重试错误的重试次数和首次重试等待时间
+func (c *Client) SetRetry(count int, backoff time.Duration) {
+	if count >= 0 {
+		c.RetryCount = count
+	}
+	if backoff > 0 {
+		c.RetryBackoff = backoff
+	}
+}
+
+//SetTimeout 设置单次请求超时时间，0为不限制
+func (c *Client) SetTimeout(timeout time.Duration) {
+	if timeout >= 0 {
+		c.Timeout = timeout
+	}
+}
+
+//SetAccountCacheTTL 设置账户缓存有效期，0为不缓存
+func (c *Client) SetAccountCacheTTL(ttl time.Duration) {
+	c.accounts.mu.Lock()
+	defer c.accounts.mu.Unlock()
+	if ttl >= 0 {
+		c.accounts.TTL = ttl
+	}
+}
+
+//SetNetworkCheck 设置节点链ID检查，健康检查时链ID不符合的节点不再参与调用，直到复查通过
+func (c *Client) SetNetworkCheck(check func(network string) error) {
+	c.networkCheck = check
+}
+
+//checkNetwork 检查节点返回的链ID
+func (c *Client) checkNetwork(status *NodeStatus) error {
+	if c.networkCheck == nil {
+		return nil
+	}
+	return c.networkCheck(status.Network)
+}
+
+//Nodes 节点健康状态列表
+func (c *Client) Nodes() []NodeEndpoint {
+	return c.nodes.snapshot()
+}
+
+//CheckNodes 通过/status检查全部节点的高度和同步状态
+func (c *Client) CheckNodes() {
+	c.CheckNodesContext(context.Background())
+}
+
+//CheckNodesContext 通过/status检查全部节点的高度和同步状态，ctx取消时中止检查
+func (c *Client) CheckNodesContext(ctx context.Context) {
+	c.nodes.check(func(url string) (uint64, bool, error) {
+		if c.isDex() {
+			resp, err := c.callNode(ctx, url, dexAPIPrefix+"/node-info", nil, "GET")
+			if err != nil {
+				return 0, false, err
+			}
+			status := newNodeStatus(*resp)
+			return status.LatestBlockHeight, status.CatchingUp, c.checkNetwork(status)
+		}
+		resp, err := c.callNode(ctx, url, "/status", nil, "GET")
+		if err != nil {
+			return 0, false, err
+		}
+		status := NewNodeStatus(resp)
+		return status.LatestBlockHeight, status.CatchingUp, c.checkNetwork(status)
+	})
+}
+
 // Call calls a remote procedure on another node, specified by the path.
+// The healthiest in-sync node is tried first, and the call fails over to
+// the next node when it errors. Retryable errors are retried with
+// exponential backoff.
 func (c *Client) Call(path string, request interface{}, method string) (*gjson.Result, error) {
+	return c.CallContext(context.Background(), path, request, method)
+}
 
-	if c.client == nil {
+// CallContext is like Call but stops retrying and aborts the in-flight
+// request as soon as ctx is done. Each single request is also bounded by
+// the client Timeout.
+func (c *Client) CallContext(ctx context.Context, path string, request interface{}, method string) (*gjson.Result, error) {
+
+	if c.client == nil || c.nodes.size() == 0 {
 		return nil, errors.New("API url is not setup. ")
 	}
 
+	var lastErr error
+	for attempt := 0; attempt <= c.RetryCount; attempt++ {
+
+		if attempt > 0 {
+			backoff := c.backoff(attempt)
+			log.Std.Warning("request [%s] failed, retry %d/%d after %v; unexpected error: %v", path, attempt, c.RetryCount, backoff, lastErr)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(backoff):
+			}
+		}
+
+		resp, err := c.callNodes(ctx, path, request, method)
+		if err == nil {
+			return resp, nil
+		}
+
+		lastErr = err
+		if !IsRetryable(err) {
+			break
+		}
+	}
+
+	return nil, lastErr
+}
+
+//callNodes 按健康程度依次调用节点，直到成功或出现无需切换节点的错误
+func (c *Client) callNodes(ctx context.Context, path string, request interface{}, method string) (*gjson.Result, error) {
+
+	if c.nodes.needCheck() {
+		c.CheckNodesContext(ctx)
+	}
+
+	var lastErr error
+	for _, node := range c.nodes.candidates() {
+		resp, err := c.callNode(ctx, node.URL, path, request, method)
+		if err == nil {
+			c.nodes.markSucceeded(node)
+			return resp, nil
+		}
+
+		lastErr = err
+		if !shouldFailover(err) {
+			break
+		}
+
+		if IsRetryable(err) {
+			c.nodes.markFailed(node)
+		}
+		if c.nodes.size() > 1 {
+			log.Std.Warning("node [%s] request [%s] failed, try next node; unexpected error: %v", node.URL, path, err)
+		}
+	}
+
+	if lastErr == nil {
+		return nil, &RPCError{Kind: ErrNetworkMismatch, Message: "no node on the expected network"}
+	}
+	return nil, lastErr
+}
+
+//wsNode websocket连接使用的节点，每次连接前按健康程度选择
+func (c *Client) wsNode(ctx context.Context) *NodeEndpoint {
+	if c.nodes.needCheck() {
+		c.CheckNodesContext(ctx)
+	}
+	candidates := c.nodes.candidates()
+	if len(candidates) == 0 {
+		return nil
+	}
+	return candidates[0]
+}
+
+//backoff 第attempt次重试前的等待时间
+func (c *Client) backoff(attempt int) time.Duration {
+	backoff := c.RetryBackoff
+	for i := 1; i < attempt && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRetryBackoff {
+		backoff = maxRetryBackoff
+	}
+	return backoff
+}
+
+//callNode 向指定节点发起请求，ctx被取消时直接返回ctx.Err()
+func (c *Client) callNode(ctx context.Context, baseURL, path string, request interface{}, method string) (*gjson.Result, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	if c.Debug {
 		log.Std.Debug("Start Request API...")
 	}
 
-	url := c.BaseURL + path
+	url := baseURL + path
+
+	reqCtx := ctx
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		reqCtx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
 
-	r, err := c.client.Do(method, url, request)
+	r, err := c.client.Do(method, url, request, c.header(), reqCtx)
 
 	if c.Debug {
 		log.Std.Debug("Request API Completed")
@@ -94,24 +326,36 @@ func (c *Client) Call(path string, request interface{}, method string) (*gjson.R
 		log.Std.Debug("%+v", r)
 	}
 
-	err = c.isError(r)
 	if err != nil {
-		return nil, err
+		//调用方取消不属于节点故障
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &RPCError{Kind: ErrNodeUnavailable, Message: err.Error()}
 	}
 
+	err = c.isError(r)
 	if err != nil {
 		return nil, err
 	}
 
 	resp := gjson.ParseBytes(r.Bytes())
 
+	//HTTP API的错误只通过HTTP状态码返回
+	if !c.isDex() {
+		err = isError(&resp)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &resp, nil
 }
 
 func (b *Client) isError(resp *req.Resp) error {
 
 	if resp == nil || resp.Response() == nil {
-		return errors.New("Response is empty! ")
+		return &RPCError{Kind: ErrNodeUnavailable, Message: "Response is empty! "}
 	}
 
 	if resp.Response().StatusCode == http.StatusNoContent {
@@ -119,7 +363,7 @@ func (b *Client) isError(resp *req.Resp) error {
 	}
 
 	if resp.Response().StatusCode != http.StatusOK {
-		return fmt.Errorf("%s", resp.String())
+		return newRPCError(resp.Response().StatusCode, resp.Bytes())
 	}
 
 	return nil
@@ -137,56 +381,72 @@ func BasicAuth(username, password string) string {
 
 //isError 是否报错
 func isError(result *gjson.Result) error {
-	var (
-		err error
-	)
 
 	/*
 		 //failed 返回错误
 		 {
-			 "result": null,
+			 "jsonrpc": "2.0",
+			 "id": "",
 			 "error": {
-				 "code": -8,
-				 "message": "Block height out of range"
-			 },
-			 "id": "foo"
+				 "code": -32603,
+				 "message": "Internal error",
+				 "data": "Tx (AA1F...) not found"
+			 }
 		 }
 	*/
 
 	if !result.Get("error").IsObject() {
 
 		if !result.Get("result").Exists() {
-			return errors.New("Response is empty! ")
+			return &RPCError{Kind: ErrRPCFailed, Message: "Response is empty! "}
 		}
 
 		return nil
 	}
 
-	errInfo := fmt.Sprintf("[%d]%s",
-		result.Get("error.code").Int(),
-		result.Get("error.message").String())
-	err = errors.New(errInfo)
+	return newRPCError(http.StatusOK, []byte(result.Raw))
+}
+
+// 获取节点状态
+func (c *Client) getNodeStatus() (*NodeStatus, error) {
+	return c.getNodeStatusContext(context.Background())
+}
+
+func (c *Client) getNodeStatusContext(ctx context.Context) (*NodeStatus, error) {
+	resp, err := c.CallContext(ctx, "/status", nil, "GET")
 
-	return err
+	if err != nil {
+		return nil, err
+	}
+
+	return NewNodeStatus(resp), nil
 }
 
 // 获取当前区块高度
 func (c *Client) getBlockHeight() (uint64, error) {
-	resp, err := c.Call("/status", nil, "GET")
+	return c.getBlockHeightContext(context.Background())
+}
+
+func (c *Client) getBlockHeightContext(ctx context.Context) (uint64, error) {
+	status, err := c.getNodeStatusContext(ctx)
 
 	if err != nil {
 		return 0, err
 	}
 
-	return resp.Get("result").Get("sync_info").Get("latest_block_height").Uint(), nil
+	return status.LatestBlockHeight, nil
 }
 
 // 通过高度获取区块哈希
 func (c *Client) getBlockHash(height uint64) (string, error) {
+	return c.getBlockHashContext(context.Background(), height)
+}
+
+func (c *Client) getBlockHashContext(ctx context.Context, height uint64) (string, error) {
 
 	path := fmt.Sprintf("/block?height=%d", height)
 
-	resp, err := c.Call(path, nil, "GET")
+	resp, err := c.CallContext(ctx, path, nil, "GET")
 
 	if err != nil {
 		return "", err
@@ -196,72 +456,113 @@ func (c *Client) getBlockHash(height uint64) (string, error) {
 }
 
 func (c *Client) getAccountNumberAndSequence(address string) (int64, int64, error) {
+	return c.getAccountNumberAndSequenceContext(context.Background(), address)
+}
 
-	prefix, hash, err := bech32.DecodeAndConvert(address)
-	if err != nil || prefix != binancechainTransaction.Bech32Prefix {
+//getAccountNumberAndSequenceContext 签名数据使用的账户编号和序号，总是查询节点，
+//其他进程广播交易后缓存的序号已过期
+func (c *Client) getAccountNumberAndSequenceContext(ctx context.Context, address string) (int64, int64, error) {
+
+	acc, err := c.fetchAccountContext(ctx, address, 0)
+	if err != nil {
 		return 0, 0, err
 	}
+	if acc == nil {
+		return 0, 0, errors.New("Failed to get account number and sequence!")
+	}
 
-	path := "/abci_query?path=\"/store/acc/key\"&data=0x6163636F756E743A" + hex.EncodeToString(hash)
-	r, err := c.Call(path, nil, "GET")
+	return acc.GetAccountNumber(), acc.GetSequence(), nil
+}
 
-	if err != nil {
-		return 0, 0, errors.New("Failed to get address' account number and sequence!")
+//getAccountContext 查询指定高度的账户，height为0时查询最新高度，账户不存在时返回nil。
+//结果按地址和高度短时间缓存，同一笔交易构建过程中不会重复查询
+func (c *Client) getAccountContext(ctx context.Context, address string, height uint64) (types.Account, error) {
+
+	if acc, ok := c.accounts.get(address, height); ok {
+		return acc, nil
 	}
-	var acc types.Account
-	cdc := amino.NewCodec()
-	core_types.RegisterAmino(cdc)
-	types.RegisterWire(cdc)
-	tx.RegisterCodec(cdc)
+	return c.fetchAccountContext(ctx, address, height)
+}
 
-	respBytes, err := base64.StdEncoding.DecodeString(r.Get("result").Get("response").Get("value").String())
+//fetchAccountContext 从节点查询账户并更新缓存
+func (c *Client) fetchAccountContext(ctx context.Context, address string, height uint64) (types.Account, error) {
+
+	hash, err := DecodeAddress(address, c.AddressPrefix)
 	if err != nil {
-		return 0, 0, errors.New("Failed to get account number and sequence!")
+		return nil, err
 	}
 
+	var respBytes []byte
+	if c.VerifyProof {
+		//验证模式下拒绝没有证明或证明不通过的结果
+		respBytes, _, err = c.abciQueryVerified(ctx, "acc", append([]byte("account:"), hash...), height)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		path := "/abci_query?path=\"/store/acc/key\"&data=0x6163636F756E743A" + hex.EncodeToString(hash)
+		if height > 0 {
+			path = path + fmt.Sprintf("&height=%d", height)
+		}
+
+		r, err := c.CallContext(ctx, path, nil, "GET")
+		if err != nil {
+			return nil, err
+		}
+
+		respBytes, err = base64.StdEncoding.DecodeString(r.Get("result").Get("response").Get("value").String())
+		if err != nil {
+			return nil, errors.New("Failed to decode account of address [" + address + "]!")
+		}
+	}
+
+	if len(respBytes) == 0 {
+		c.accounts.set(address, height, nil)
+		return nil, nil
+	}
+
+	var acc types.Account
 	err = cdc.UnmarshalBinaryBare(respBytes, &acc)
 	if err != nil {
-		return 0, 0, errors.New("Failed to get account number and sequence!")
+		return nil, errors.New("Failed to decode account of address [" + address + "]!")
 	}
 
-	return acc.GetAccountNumber(), acc.GetSequence(), nil
+	c.accounts.set(address, height, acc)
+
+	return acc, nil
 }
 
-// 获取地址余额
-func (c *Client) getBalance(address string, denom string) (*AddrBalance, error) {
-	prefix, hash, err := bech32.DecodeAndConvert(address)
-	if err != nil || prefix != binancechainTransaction.Bech32Prefix {
+//getAccountInfo 获取账户的全部币种余额、序号、标志和公钥
+func (c *Client) getAccountInfo(address string) (*AccountInfo, error) {
+	return c.getAccountInfoContext(context.Background(), address)
+}
+
+func (c *Client) getAccountInfoContext(ctx context.Context, address string) (*AccountInfo, error) {
+
+	acc, err := c.getAccountContext(ctx, address, 0)
+	if err != nil {
 		return nil, err
 	}
 
-	path := "/abci_query?path=\"/store/acc/key\"&data=0x6163636F756E743A" + hex.EncodeToString(hash)
-	r, err := c.Call(path, nil, "GET")
+	return NewAccountInfo(address, acc), nil
+}
 
-	if r.Get("result").Get("response").Get("value").String() == "" {
-		return &AddrBalance{Address: address, Balance: big.NewInt(0)}, nil
-	}
+// 获取地址余额
+func (c *Client) getBalance(address string, denom string) (*AddrBalance, error) {
+	return c.getBalanceContext(context.Background(), address, denom)
+}
 
-	if err != nil {
-		return nil, errors.New("Failed to get ["+denom+"] balance of address ["+address+"]!")
-	}
-	var acc types.Account
-	cdc := amino.NewCodec()
-	core_types.RegisterAmino(cdc)
-	types.RegisterWire(cdc)
-	tx.RegisterCodec(cdc)
+func (c *Client) getBalanceContext(ctx context.Context, address string, denom string) (*AddrBalance, error) {
 
-	respBytes, err := base64.StdEncoding.DecodeString(r.Get("result").Get("response").Get("value").String())
+	acc, err := c.getAccountContext(ctx, address, 0)
 	if err != nil {
-		return nil, errors.New("Failed to get ["+denom+"] balance of address ["+address+"]!")
+		return nil, err
 	}
-
-	err = cdc.UnmarshalBinaryBare(respBytes, &acc)
-	if err != nil {
-		return nil, errors.New("Failed to get ["+denom+"] balance of address ["+address+"]!")
+	if acc == nil {
+		return &AddrBalance{Address: address, Balance: big.NewInt(0)}, nil
 	}
 
 	coins := acc.GetCoins()
-
 	for _, coin := range coins {
 		if coin.Denom == denom {
 			return &AddrBalance{Address: address, Balance: big.NewInt(coin.Amount)}, nil
@@ -273,13 +574,21 @@ func (c *Client) getBalance(address string, denom string) (*AddrBalance, error)
 
 // 获取区块信息
 func (c *Client) getBlock(hash string) (*Block, error) {
+	return c.getBlockContext(context.Background(), hash)
+}
+
+func (c *Client) getBlockContext(ctx context.Context, hash string) (*Block, error) {
 	return nil, nil
 }
 
 func (c *Client) getBlockByHeight(height uint64) (*Block, error) {
+	return c.getBlockByHeightContext(context.Background(), height)
+}
+
+func (c *Client) getBlockByHeightContext(ctx context.Context, height uint64) (*Block, error) {
 	path := fmt.Sprintf("/block?height=%d", height)
 
-	resp, err := c.Call(path, nil, "GET")
+	resp, err := c.CallContext(ctx, path, nil, "GET")
 
 	if err != nil {
 		return nil, err
@@ -290,104 +599,131 @@ func (c *Client) getBlockByHeight(height uint64) (*Block, error) {
 }
 
 func (c *Client) getTransaction(txid string) (*Transaction, error) {
+	return c.getTransactionContext(context.Background(), txid)
+}
+
+func (c *Client) getTransactionContext(ctx context.Context, txid string) (*Transaction, error) {
 	path := "/tx?hash=0x" +  txid
 
-	resp, err := c.Call(path, nil, "GET")
+	resp, err := c.CallContext(ctx, path, nil, "GET")
 
 	if err != nil {
 		return nil, err
 	}
 
 	result := resp.Get("result")
-	return NewTransaction(&result), nil
+	trx := NewTransaction(&result, c.AddressPrefix)
+
+	//交易单内容必须与请求的hash一致，防止节点返回伪造的交易单
+	txBytes, _ := base64.StdEncoding.DecodeString(result.Get("tx").String())
+	if trx != nil && !strings.EqualFold(txHash(txBytes), txid) {
+		return nil, &RPCError{Kind: ErrBlockUnverified, Message: "transaction content doesn't match hash " + txid}
+	}
+
+	return trx, nil
 }
 
 func (c *Client) getMultiFeeByHeight(height uint64) (uint64, error) {
-	path := fmt.Sprintf("/abci_query?path=\"/param/fees\"&height=%d", height)
-	resp, err := c.Call(path, nil, "GET")
-
-	if err != nil {
-		return 0, err
-	}
+	return c.getMultiFeeByHeightContext(context.Background(), height)
+}
 
-	base64Decoder := base64.StdEncoding
+func (c *Client) getMultiFeeByHeightContext(ctx context.Context, height uint64) (uint64, error) {
 
-	data, err := base64Decoder.DecodeString(resp.Get("result").Get("response").Get("value").String())
+	schedule, err := c.getFeeScheduleContext(ctx, height)
 	if err != nil {
 		return 0, err
 	}
 
-	cdc := amino.NewCodec()
-	core_types.RegisterAmino(cdc)
-	types.RegisterWire(cdc)
-	tx.RegisterCodec(cdc)
+	return uint64(schedule.Transfer.MultiTransferFee), nil
+}
 
-	var fees []types.FeeParam
+func (c *Client) getFeeByHeight(height uint64) (uint64, error) {
+	return c.getFeeByHeightContext(context.Background(), height)
+}
 
-	err = cdc.UnmarshalBinaryLengthPrefixed(data, &fees)
+func (c *Client) getFeeByHeightContext(ctx context.Context, height uint64) (uint64, error) {
 
+	schedule, err := c.getFeeScheduleContext(ctx, height)
 	if err != nil {
 		return 0, err
 	}
 
-	for _, fee := range fees {
-		if fee.GetParamType() == "transfer" {
-			return uint64(fee.(*types.TransferFeeParam).MultiTransferFee), nil
-		}
-	}
-
-	return 0, errors.New("Get fee failed!")
+	return uint64(schedule.Transfer.Fee), nil
 }
 
+func (c *Client) sendTransaction(jsonStr string) (string, error) {
+	return c.sendTransactionContext(context.Background(), jsonStr)
+}
 
-func (c *Client) getFeeByHeight(height uint64) (uint64, error) {
-	path := fmt.Sprintf("/abci_query?path=\"/param/fees\"&height=%d", height)
-	resp, err := c.Call(path, nil, "GET")
+func (c *Client) sendTransactionContext(ctx context.Context, jsonStr string) (string, error) {
 
+	txBytes, err := hex.DecodeString(jsonStr)
 	if err != nil {
-		return 0, err
+		return "", err
 	}
 
-	base64Decoder := base64.StdEncoding
-
-	data, err := base64Decoder.DecodeString(resp.Get("result").Get("response").Get("value").String())
-	if err != nil {
-		return 0, err
+	//broadcast_tx_sync只等待CheckTx，上链结果由TxTracker跟踪
+	request := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      "broadcast",
+		"method":  "broadcast_tx_sync",
+		"params":  map[string]interface{}{"tx": base64.StdEncoding.EncodeToString(txBytes)},
 	}
 
-	cdc := amino.NewCodec()
-	core_types.RegisterAmino(cdc)
-	types.RegisterWire(cdc)
-	tx.RegisterCodec(cdc)
-
-	var fees []types.FeeParam
-
-	err = cdc.UnmarshalBinaryLengthPrefixed(data, &fees)
-
+	resp, err := c.CallContext(ctx, "/", req.BodyJSON(&request), "POST")
 	if err != nil {
-		return 0, err
+		//超时重试时交易单可能已进入交易池，重复广播视为成功
+		if strings.Contains(strings.ToLower(err.Error()), "tx already exists in cache") {
+			c.accounts.purge()
+			return txHash(txBytes), nil
+		}
+		return "", err
 	}
 
-	for _, fee := range fees {
-		if fee.GetParamType() == "transfer" {
-			return uint64(fee.(*types.TransferFeeParam).FixedFeeParams.Fee), nil
-		}
+	result := resp.Get("result")
+	if code := result.Get("code").Uint(); code != 0 {
+		return "", &RPCError{Kind: ErrCheckTxFailed, StatusCode: http.StatusOK, Code: int64(code), Message: result.Get("log").String()}
 	}
 
-	return 0, errors.New("Get fee failed!")
+	//账户序号和余额已改变
+	c.accounts.purge()
+
+	return strings.ToUpper(result.Get("hash").String()), nil
 }
 
-func (c *Client) sendTransaction(jsonStr string) (string, error) {
+//getTokens 分页获取代币信息
+func (c *Client) getTokens(offset, limit int) ([]types.Token, error) {
+	return c.getTokensContext(context.Background(), offset, limit)
+}
+
+func (c *Client) getTokensContext(ctx context.Context, offset, limit int) ([]types.Token, error) {
 
-	path := "/broadcast_tx_commit?tx=0x" + jsonStr
+	path := fmt.Sprintf("/abci_query?path=\"tokens/list/%d/%d\"", offset, limit)
 
-	resp, err := c.Call(path, nil, "GET")
+	resp, err := c.CallContext(ctx, path, nil, "GET")
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(resp.Get("result").Get("response").Get("value").String())
+	if err != nil {
+		return nil, err
 	}
-	if resp.Get("result").Get("height").Uint() == 0 {
-		return "", errors.New("send transaction failed with error:" + resp.Get("result").Get("check_tx").String())
+
+	tokens := make([]types.Token, 0)
+	if len(data) == 0 {
+		return tokens, nil
+	}
+	err = cdc.UnmarshalBinaryLengthPrefixed(data, &tokens)
+	if err != nil {
+		return nil, err
 	}
 
-	return resp.Get("result").Get("hash").String(), nil
+	return tokens, nil
+}
+
+//txHash 交易单hash
+func txHash(txBytes []byte) string {
+	hash := sha256.Sum256(txBytes)
+	return strings.ToUpper(hex.EncodeToString(hash[:]))
 }
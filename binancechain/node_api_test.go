@@ -1,12 +1,24 @@
 package binancechain
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/binance-chain/go-sdk/common/bech32"
+	"github.com/binance-chain/go-sdk/common/types"
 	"github.com/shopspring/decimal"
+	"github.com/tendermint/tendermint/crypto/secp256k1"
+	"github.com/tidwall/gjson"
 )
 
 const(
@@ -170,4 +182,425 @@ func Test_send(t *testing.T) {
 	txid, err := c.sendTransaction(tx)
 	fmt.Println(err)
 	fmt.Println(txid)
-}
\ No newline at end of file
+}
+func Test_multiNodeFailover(t *testing.T) {
+	status := func(height uint64, catchingUp bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":"","result":{"node_info":{"network":"Binance-Chain-Tigris"},"sync_info":{"latest_block_height":"%d","catching_up":%t}}}`, height, catchingUp)
+		}
+	}
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+	lagging := httptest.NewServer(status(100, true))
+	defer lagging.Close()
+	healthy := httptest.NewServer(status(120, false))
+	defer healthy.Close()
+
+	c := NewMultiNodeClient([]string{down.URL, lagging.URL, healthy.URL}, false)
+
+	height, err := c.getBlockHeight()
+	if err != nil {
+		t.Fatalf("getBlockHeight failed unexpected error: %v", err)
+	}
+	if height != 120 {
+		t.Errorf("getBlockHeight should be served by the in-sync node, got height %d", height)
+	}
+
+	for _, node := range c.Nodes() {
+		if node.URL == down.URL && node.Available {
+			t.Errorf("node [%s] should be marked unavailable", node.URL)
+		}
+	}
+}
+
+func Test_callErrorClassification(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+		kind   error
+	}{
+		{http.StatusOK, `{"jsonrpc":"2.0","id":"","error":{"code":-32603,"message":"Internal error","data":"Height 100 must be less than or equal to the current blockchain height 50"}}`, ErrHeightNotFound},
+		{http.StatusOK, `{"jsonrpc":"2.0","id":"","error":{"code":-32603,"message":"Internal error","data":"Tx (AA1F7401C18E90A8D3AE54EFB69BF630F6543A471D26917B23DE2E7ECB730C9A) not found"}}`, ErrTxNotFound},
+		{http.StatusTooManyRequests, `too many requests`, ErrRateLimited},
+		{http.StatusServiceUnavailable, ``, ErrNodeUnavailable},
+		{http.StatusServiceUnavailable, `{"jsonrpc":"2.0","id":"","error":{"code":-32603,"message":"Internal error","data":"Tx (AA1F7401C18E90A8D3AE54EFB69BF630F6543A471D26917B23DE2E7ECB730C9A) not found"}}`, ErrNodeUnavailable},
+		{http.StatusTooManyRequests, `{"jsonrpc":"2.0","id":"","error":{"code":-32603,"message":"Internal error","data":"Height 100 must be less than or equal to the current blockchain height 50"}}`, ErrRateLimited},
+		{http.StatusNotFound, `{"code":404,"message":"account not found"}`, ErrRPCFailed},
+		{http.StatusBadRequest, `bad request`, ErrRPCFailed},
+	}
+
+	for _, test := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(test.status)
+			fmt.Fprint(w, test.body)
+		}))
+
+		c := NewClient(server.URL, false)
+		c.SetRetry(0, 0)
+		_, err := c.Call("/tx?hash=0x00", nil, "GET")
+		if ErrorKind(err) != test.kind {
+			t.Errorf("status %d body %s: expected error kind [%v], got [%v]", test.status, test.body, test.kind, err)
+		}
+		server.Close()
+	}
+}
+
+func Test_callRetryWithBackoff(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":"","result":{"sync_info":{"latest_block_height":"88"}}}`)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, false)
+	c.SetRetry(2, time.Millisecond)
+
+	height, err := c.getBlockHeight()
+	if err != nil {
+		t.Fatalf("getBlockHeight failed unexpected error: %v", err)
+	}
+	if n := atomic.LoadInt32(&requests); height != 88 || n != 3 {
+		t.Errorf("expected height 88 after 3 requests, got height %d after %d requests", height, n)
+	}
+}
+
+func Test_callContextCancel(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	c := NewClient(server.URL, false)
+	c.SetRetry(2, time.Millisecond)
+
+	//调用方取消，立即返回且不重试
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := c.getBlockHeightContext(ctx)
+	if err != context.Canceled {
+		t.Errorf("expected context.Canceled, got: %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("canceled call took too long: %v", time.Since(start))
+	}
+
+	//单次请求超时，作为节点不可用处理
+	c.SetRetry(0, time.Millisecond)
+	c.SetTimeout(50 * time.Millisecond)
+	_, err = c.getBlockHeight()
+	if ErrorKind(err) != ErrNodeUnavailable {
+		t.Errorf("expected ErrNodeUnavailable on timeout, got: %v", err)
+	}
+}
+
+func Test_sendTransactionSync(t *testing.T) {
+	txHex := "c401f0625dee0a4c"
+	checkCode := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Method != "POST" || gjson.GetBytes(body, "method").String() != "broadcast_tx_sync" {
+			t.Errorf("unexpected broadcast request: %s %s", r.Method, body)
+		}
+		if gjson.GetBytes(body, "params.tx").String() != "xAHwYl3uCkw=" {
+			t.Errorf("unexpected broadcast tx: %s", body)
+		}
+		switch checkCode {
+		case 0:
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":"broadcast","result":{"code":0,"data":"","log":"","hash":"abcd"}}`)
+		case -1:
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":"broadcast","error":{"code":-32603,"message":"Internal error","data":"Tx already exists in cache"}}`)
+		default:
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":"broadcast","result":{"code":%d,"log":"insufficient fund","hash":"abcd"}}`, checkCode)
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, false)
+
+	txid, err := c.sendTransaction(txHex)
+	if err != nil || txid != "ABCD" {
+		t.Errorf("expected txid ABCD, got %s, %v", txid, err)
+	}
+
+	//重复广播时返回本地计算的hash
+	checkCode = -1
+	txid, err = c.sendTransaction(txHex)
+	if err != nil || len(txid) != 64 {
+		t.Errorf("expected local tx hash for duplicated broadcast, got %s, %v", txid, err)
+	}
+
+	checkCode = 65541
+	_, err = c.sendTransaction(txHex)
+	if ErrorKind(err) != ErrCheckTxFailed {
+		t.Errorf("expected ErrCheckTxFailed, got: %v", err)
+	}
+}
+
+func Test_accountCache(t *testing.T) {
+	addr := "bnb143f9qp4xe2fsh60rdsj8wx47zcmkununuwmp4l"
+	_, hash, _ := bech32.DecodeAndConvert(addr)
+
+	var acc types.Account = &types.AppAccount{BaseAccount: types.BaseAccount{
+		Address:       types.AccAddress(hash),
+		Coins:         types.Coins{{Denom: "BNB", Amount: 100000000}},
+		AccountNumber: 12,
+		Sequence:      3,
+	}}
+	accBytes, err := cdc.MarshalBinaryBare(acc)
+	if err != nil {
+		t.Fatalf("MarshalBinaryBare failed unexpected error: %v", err)
+	}
+
+	var queries int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&queries, 1)
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":"","result":{"response":{"value":"%s"}}}`, base64.StdEncoding.EncodeToString(accBytes))
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, false)
+
+	for i := 0; i < 5; i++ {
+		balance, err := c.getBalance(addr, "BNB")
+		if err != nil || balance.Balance.Int64() != 100000000 {
+			t.Fatalf("unexpected balance: %+v, %v", balance, err)
+		}
+	}
+	if n := atomic.LoadInt32(&queries); n != 1 {
+		t.Errorf("expected 1 abci query with account cache, got %d", n)
+	}
+
+	//签名使用的序号总是查询节点
+	for i := 0; i < 2; i++ {
+		number, sequence, err := c.getAccountNumberAndSequence(addr)
+		if err != nil || number != 12 || sequence != 3 {
+			t.Fatalf("unexpected account number and sequence: %d, %d, %v", number, sequence, err)
+		}
+	}
+	if n := atomic.LoadInt32(&queries); n != 3 {
+		t.Errorf("expected 3 abci queries for sequences, got %d", n)
+	}
+
+	//缓存关闭后每次都查询节点
+	c.SetAccountCacheTTL(0)
+	c.accounts.purge()
+	c.getBalance(addr, "BNB")
+	c.getBalance(addr, "BNB")
+	if n := atomic.LoadInt32(&queries); n != 5 {
+		t.Errorf("expected 5 abci queries without account cache, got %d", n)
+	}
+}
+
+func Test_getAccountInfo(t *testing.T) {
+	addr := "bnb143f9qp4xe2fsh60rdsj8wx47zcmkununuwmp4l"
+	_, hash, _ := bech32.DecodeAndConvert(addr)
+
+	var pubKey secp256k1.PubKeySecp256k1
+	pubKey[0] = 0x02
+	var acc types.Account = &types.AppAccount{
+		BaseAccount: types.BaseAccount{
+			Address:       types.AccAddress(hash),
+			Coins:         types.Coins{{Denom: "BNB", Amount: 300}, {Denom: "ABC-123", Amount: 10}},
+			PubKey:        pubKey,
+			AccountNumber: 7,
+			Sequence:      9,
+		},
+		FrozenCoins: types.Coins{{Denom: "BNB", Amount: 20}},
+		LockedCoins: types.Coins{{Denom: "XYZ-456", Amount: 5}},
+		Flags:       1,
+	}
+	accBytes, _ := cdc.MarshalBinaryBare(acc)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":"","result":{"response":{"value":"%s"}}}`, base64.StdEncoding.EncodeToString(accBytes))
+	}))
+	defer server.Close()
+
+	info, err := NewClient(server.URL, false).getAccountInfo(addr)
+	if err != nil {
+		t.Fatalf("getAccountInfo failed unexpected error: %v", err)
+	}
+	if info.AccountNumber != 7 || info.Sequence != 9 || info.Flags != 1 || len(info.PubKey) != 66 {
+		t.Errorf("unexpected account info: %+v", info)
+	}
+	if len(info.Coins) != 3 || info.Coins[0].Denom != "ABC-123" {
+		t.Errorf("unexpected coins: %+v", info.Coins)
+	}
+	if bnb := info.Coin("BNB"); bnb.Free != 300 || bnb.Frozen != 20 || bnb.Total() != 320 {
+		t.Errorf("unexpected BNB coin: %+v", bnb)
+	}
+
+	balance := info.Balance("BNB", "XYZ-456", 8)
+	if balance.Balance != "0.00000005" || balance.ConfirmBalance != "0" || balance.UnconfirmBalance != "0.00000005" {
+		t.Errorf("unexpected locked balance: %+v", balance)
+	}
+	balance = info.Balance("BNB", "BNB", 8)
+	if balance.Balance != "0.0000032" || balance.ConfirmBalance != "0.000003" || balance.UnconfirmBalance != "0.0000002" {
+		t.Errorf("unexpected frozen balance: %+v", balance)
+	}
+}
+
+func Test_getAccountInfos(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		running   = 0
+		maxRun    = 0
+		addresses = make([]string, 0)
+	)
+
+	for i := 0; i < 20; i++ {
+		hash := make([]byte, 20)
+		hash[19] = byte(i)
+		addr, _ := bech32.ConvertAndEncode("bnb", hash)
+		addresses = append(addresses, addr)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		running++
+		if running > maxRun {
+			maxRun = running
+		}
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		//用账户序号标记地址
+		data := r.URL.Query().Get("data")
+		hash, _ := hex.DecodeString(data[len(data)-40:])
+		var acc types.Account = &types.AppAccount{BaseAccount: types.BaseAccount{
+			Address:  types.AccAddress(hash),
+			Coins:    types.Coins{{Denom: "BNB", Amount: int64(hash[19])}},
+			Sequence: int64(hash[19]),
+		}}
+		accBytes, _ := cdc.MarshalBinaryBare(acc)
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":"","result":{"response":{"value":"%s"}}}`, base64.StdEncoding.EncodeToString(accBytes))
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, false)
+	c.SetBatch(4, 0)
+
+	infos, err := c.getAccountInfos(addresses)
+	if err != nil {
+		t.Fatalf("getAccountInfos failed unexpected error: %v", err)
+	}
+	for i, info := range infos {
+		if info.Address != addresses[i] || info.Sequence != int64(i) || info.Coin("BNB").Free != int64(i) {
+			t.Errorf("unexpected account info at %d: %+v", i, info)
+		}
+	}
+	if maxRun > 4 || maxRun < 2 {
+		t.Errorf("expected at most 4 concurrent queries, got %d", maxRun)
+	}
+
+	//限速每秒50次，20个地址至少需要约400ms
+	c.SetAccountCacheTTL(0)
+	c.SetBatch(4, 50)
+	start := time.Now()
+	if _, err := c.getAccountInfos(addresses); err != nil {
+		t.Fatalf("getAccountInfos failed unexpected error: %v", err)
+	}
+	if time.Since(start) < 350*time.Millisecond {
+		t.Errorf("expected rate limited queries, took %v", time.Since(start))
+	}
+
+	//地址格式错误时中止
+	if _, err := c.getAccountInfos(append(addresses, "tbnb1invalid")); err == nil {
+		t.Errorf("expected error for invalid address")
+	}
+}
+
+func Test_feeSchedule(t *testing.T) {
+	transferFee := int64(37500)
+	latestHeight := 1000
+	queries := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries++
+		params := []types.FeeParam{
+			&types.FixedFeeParams{MsgType: FeeMsgIssue, Fee: 100000000000, FeeFor: types.FeeForAll},
+			&types.FixedFeeParams{MsgType: FeeMsgFreeze, Fee: 1000000, FeeFor: types.FeeForProposer},
+			&types.TransferFeeParam{
+				FixedFeeParams:    types.FixedFeeParams{MsgType: FeeMsgSend, Fee: transferFee, FeeFor: types.FeeForProposer},
+				MultiTransferFee:  30000,
+				LowerLimitAsMulti: 2,
+			},
+			&types.DexFeeParam{DexFeeFields: []types.DexFeeField{{FeeName: "ExpireFee", FeeValue: 10000}}},
+		}
+		data, _ := cdc.MarshalBinaryLengthPrefixed(params)
+		height := r.URL.Query().Get("height")
+		if height == "0" {
+			height = strconv.Itoa(latestHeight)
+		}
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":"","result":{"response":{"value":"%s","height":"%s"}}}`, base64.StdEncoding.EncodeToString(data), height)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, false)
+
+	schedule, err := c.getFeeSchedule(0)
+	if err != nil {
+		t.Fatalf("getFeeSchedule failed unexpected error: %v", err)
+	}
+	if fee, _ := schedule.Fee(FeeMsgFreeze); fee != 1000000 || schedule.Dex["ExpireFee"] != 10000 || schedule.Height != 1000 {
+		t.Errorf("unexpected fee schedule: %+v", schedule)
+	}
+	if schedule.TransferFeeOf(1) != 37500 || schedule.TransferFeeOf(3) != 90000 {
+		t.Errorf("unexpected transfer fee: %d, %d", schedule.TransferFeeOf(1), schedule.TransferFeeOf(3))
+	}
+
+	//紧邻且参数相同的高度合并为一个区间，区间内不再查询
+	c.getFeeSchedule(0)
+	c.getFeeSchedule(900)
+	c.getFeeSchedule(901)
+	c.getFeeSchedule(900)
+	if queries != 3 {
+		t.Errorf("expected 3 fee queries with cache, got %d", queries)
+	}
+
+	//不相邻的高度即使参数相同也要查询，中间可能改过又改回
+	c.getFeeSchedule(950)
+	if queries != 4 {
+		t.Errorf("expected 4 fee queries with cache, got %d", queries)
+	}
+	transferFee = 50000
+	if middle, _ := c.getFeeSchedule(920); middle.Transfer.Fee != 50000 {
+		t.Errorf("expected changed transfer fee between cached heights, got %d", middle.Transfer.Fee)
+	}
+	transferFee = 37500
+	if old, _ := c.getFeeSchedule(950); old.Transfer.Fee != 37500 {
+		t.Errorf("expected history transfer fee, got %d", old.Transfer.Fee)
+	}
+
+	//参数变化后开始新的区间
+	transferFee = 50000
+	latestHeight = 2000
+	c.SetFeeCacheTTL(0)
+	schedule, _ = c.getFeeSchedule(0)
+	if schedule.Transfer.Fee != 50000 {
+		t.Errorf("expected changed transfer fee, got %d", schedule.Transfer.Fee)
+	}
+	if old, _ := c.getFeeSchedule(901); old.Transfer.Fee != 37500 {
+		t.Errorf("expected history transfer fee, got %d", old.Transfer.Fee)
+	}
+	if fee, _ := c.getFeeByHeight(2000); fee != 50000 {
+		t.Errorf("expected transfer fee on height 2000, got %d", fee)
+	}
+}
@@ -0,0 +1,201 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package binancechain
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHealthCheckInterval = 30 * time.Second //默认节点健康检查间隔
+	defaultMaxHeightLag        = 5                //默认允许落后最高节点的区块数
+)
+
+//NodeEndpoint 节点RPC端点及其健康状态
+type NodeEndpoint struct {
+	URL             string        //节点RPC地址
+	Height          uint64        //最近一次检查到的区块高度
+	CatchingUp      bool          //节点是否正在同步
+	Available       bool          //节点是否可用
+	NetworkMismatch bool          //节点链ID与配置不一致，只有健康检查通过后才恢复
+	Failures        int           //连续失败次数
+	Latency         time.Duration //最近一次检查的响应耗时
+	LastChecked     time.Time     //最近一次检查时间
+}
+
+//nodePool 节点池，负责健康检查和选择调用节点
+type nodePool struct {
+	mu                  sync.RWMutex
+	checkMu             sync.Mutex
+	endpoints           []*NodeEndpoint
+	lastCheck           time.Time
+	HealthCheckInterval time.Duration
+	MaxHeightLag        uint64
+}
+
+//newNodePool 创建节点池
+func newNodePool(urls []string) *nodePool {
+	pool := nodePool{
+		HealthCheckInterval: defaultHealthCheckInterval,
+		MaxHeightLag:        defaultMaxHeightLag,
+	}
+	for _, url := range urls {
+		if len(url) == 0 {
+			continue
+		}
+		pool.endpoints = append(pool.endpoints, &NodeEndpoint{URL: url, Available: true})
+	}
+	return &pool
+}
+
+//size 节点数量
+func (p *nodePool) size() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.endpoints)
+}
+
+//needCheck 是否到了健康检查时间，单节点时无需检查
+func (p *nodePool) needCheck() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if len(p.endpoints) < 2 {
+		return false
+	}
+	return time.Since(p.lastCheck) >= p.HealthCheckInterval
+}
+
+//check 对全部节点执行健康检查，status返回节点高度和同步状态
+func (p *nodePool) check(status func(url string) (uint64, bool, error)) {
+
+	//同一时间只允许一个检查流程
+	p.checkMu.Lock()
+	defer p.checkMu.Unlock()
+
+	p.mu.RLock()
+	endpoints := make([]*NodeEndpoint, len(p.endpoints))
+	copy(endpoints, p.endpoints)
+	p.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, node := range endpoints {
+		wg.Add(1)
+		go func(node *NodeEndpoint) {
+			defer wg.Done()
+			start := time.Now()
+			height, catchingUp, err := status(node.URL)
+			latency := time.Since(start)
+
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			node.LastChecked = time.Now()
+			node.Latency = latency
+			if err != nil {
+				node.Available = false
+				node.Failures++
+				if ErrorKind(err) == ErrNetworkMismatch {
+					node.NetworkMismatch = true
+				}
+				return
+			}
+			node.Available = true
+			node.NetworkMismatch = false
+			node.Failures = 0
+			node.Height = height
+			node.CatchingUp = catchingUp
+		}(node)
+	}
+	wg.Wait()
+
+	p.mu.Lock()
+	p.lastCheck = time.Now()
+	p.mu.Unlock()
+}
+
+//candidates 按健康程度排序的候选节点，最健康的同步节点排在最前面，链ID不一致的节点不参与调用
+func (p *nodePool) candidates() []*NodeEndpoint {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var maxHeight uint64
+	for _, node := range p.endpoints {
+		if node.Available && !node.CatchingUp && node.Height > maxHeight {
+			maxHeight = node.Height
+		}
+	}
+
+	inSync := func(node *NodeEndpoint) bool {
+		if !node.Available || node.CatchingUp {
+			return false
+		}
+		return node.Height+p.MaxHeightLag >= maxHeight
+	}
+
+	list := make([]*NodeEndpoint, 0, len(p.endpoints))
+	for _, node := range p.endpoints {
+		if !node.NetworkMismatch {
+			list = append(list, node)
+		}
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if inSync(a) != inSync(b) {
+			return inSync(a)
+		}
+		if a.Failures != b.Failures {
+			return a.Failures < b.Failures
+		}
+		if a.Height != b.Height {
+			return a.Height > b.Height
+		}
+		return a.Latency < b.Latency
+	})
+
+	return list
+}
+
+//markFailed 调用失败，节点降级直到下一次健康检查
+func (p *nodePool) markFailed(node *NodeEndpoint) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	node.Failures++
+	if len(p.endpoints) > 1 {
+		node.Available = false
+	}
+}
+
+//markSucceeded 调用成功，清空失败计数，链ID不一致的标记由健康检查维护
+func (p *nodePool) markSucceeded(node *NodeEndpoint) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	node.Failures = 0
+	node.Available = true
+}
+
+//snapshot 当前节点状态的副本
+func (p *nodePool) snapshot() []NodeEndpoint {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	list := make([]NodeEndpoint, 0, len(p.endpoints))
+	for _, node := range p.endpoints {
+		list = append(list, *node)
+	}
+	return list
+}
@@ -0,0 +1,505 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package binancechain
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/tendermint/go-amino"
+	"github.com/tendermint/tendermint/crypto/merkle"
+	"github.com/tendermint/tendermint/crypto/tmhash"
+)
+
+//abci_query返回的证明操作类型，与节点使用的iavl和cosmos-sdk一致
+const (
+	ProofOpIAVLValue   = "iavl:v"
+	ProofOpIAVLAbsence = "iavl:a"
+	ProofOpMultiStore  = "multistore"
+)
+
+//proofRuntime 解码和执行abci_query返回的证明操作
+var proofRuntime = newProofRuntime()
+
+func newProofRuntime() *merkle.ProofRuntime {
+	prt := merkle.DefaultProofRuntime()
+	prt.RegisterOpDecoder(ProofOpIAVLValue, iavlValueOpDecoder)
+	prt.RegisterOpDecoder(ProofOpIAVLAbsence, iavlAbsenceOpDecoder)
+	prt.RegisterOpDecoder(ProofOpMultiStore, multiStoreOpDecoder)
+	return prt
+}
+
+//iavlInnerNode IAVL树证明路径上的中间节点，Left和Right只有一个非空
+type iavlInnerNode struct {
+	Height  int8
+	Size    int64
+	Version int64
+	Left    []byte
+	Right   []byte
+}
+
+//hash 已知子节点哈希时计算中间节点哈希
+func (n iavlInnerNode) hash(childHash []byte) []byte {
+	buf := new(bytes.Buffer)
+	amino.EncodeInt8(buf, n.Height)
+	amino.EncodeVarint(buf, n.Size)
+	amino.EncodeVarint(buf, n.Version)
+	if len(n.Left) == 0 {
+		amino.EncodeByteSlice(buf, childHash)
+		amino.EncodeByteSlice(buf, n.Right)
+	} else {
+		amino.EncodeByteSlice(buf, n.Left)
+		amino.EncodeByteSlice(buf, childHash)
+	}
+	return tmhash.Sum(buf.Bytes())
+}
+
+//iavlLeafNode IAVL树的叶子节点，ValueHash为值的sha256
+type iavlLeafNode struct {
+	Key       []byte
+	ValueHash []byte
+	Version   int64
+}
+
+func (n iavlLeafNode) hash() []byte {
+	buf := new(bytes.Buffer)
+	amino.EncodeInt8(buf, 0)
+	amino.EncodeVarint(buf, 1)
+	amino.EncodeVarint(buf, n.Version)
+	amino.EncodeByteSlice(buf, n.Key)
+	amino.EncodeByteSlice(buf, n.ValueHash)
+	return tmhash.Sum(buf.Bytes())
+}
+
+//iavlPathToLeaf 从根到叶子的中间节点路径
+type iavlPathToLeaf []iavlInnerNode
+
+//rootHash 从叶子哈希逐层计算到根
+func (path iavlPathToLeaf) rootHash(leafHash []byte) []byte {
+	hash := leafHash
+	for i := len(path) - 1; i >= 0; i-- {
+		hash = path[i].hash(hash)
+	}
+	return hash
+}
+
+//isLeftmost 路径是否一直在树的最左侧
+func (path iavlPathToLeaf) isLeftmost() bool {
+	for _, node := range path {
+		if len(node.Left) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+//isRightmost 路径是否一直在树的最右侧
+func (path iavlPathToLeaf) isRightmost() bool {
+	for _, node := range path {
+		if len(node.Right) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+//iavlRangeProof IAVL树的范围证明，字段顺序与iavl的RangeProof一致以便amino解码
+type iavlRangeProof struct {
+	LeftPath   iavlPathToLeaf
+	InnerNodes []iavlPathToLeaf
+	Leaves     []iavlLeafNode
+}
+
+//computeRootHash 根据证明计算树根，treeEnd表示最后一个叶子是否为树的最右叶子
+func (proof *iavlRangeProof) computeRootHash() (rootHash []byte, treeEnd bool, err error) {
+	if len(proof.Leaves) == 0 {
+		return nil, false, errors.New("no leaves in range proof")
+	}
+	if len(proof.InnerNodes)+1 != len(proof.Leaves) {
+		return nil, false, errors.New("inner nodes and leaves length mismatch")
+	}
+
+	leaves := proof.Leaves
+	inners := proof.InnerNodes
+
+	//依次证明每个叶子，右侧子树的哈希由后续叶子递归计算后比对
+	var compute func(path iavlPathToLeaf, rightmost bool) ([]byte, bool, bool, error)
+	compute = func(path iavlPathToLeaf, rightmost bool) ([]byte, bool, bool, error) {
+		leaf := leaves[0]
+		leaves = leaves[1:]
+		hash := path.rootHash(leaf.hash())
+
+		if len(leaves) == 0 {
+			return hash, rightmost && path.isRightmost(), true, nil
+		}
+
+		for len(path) > 0 {
+			last := path[len(path)-1]
+			path = path[:len(path)-1]
+			if len(last.Right) == 0 {
+				continue
+			}
+			if len(inners) == 0 {
+				return nil, false, false, errors.New("missing inner nodes in range proof")
+			}
+			next := inners[0]
+			inners = inners[1:]
+
+			derived, treeEnd, done, err := compute(next, rightmost && path.isRightmost())
+			if err != nil {
+				return nil, treeEnd, false, err
+			}
+			if !bytes.Equal(derived, last.Right) {
+				return nil, treeEnd, false, fmt.Errorf("intermediate root hash %X doesn't match, got %X", last.Right, derived)
+			}
+			if done {
+				return hash, treeEnd, true, nil
+			}
+		}
+		return hash, false, false, nil
+	}
+
+	rootHash, treeEnd, done, err := compute(proof.LeftPath, true)
+	if err != nil {
+		return nil, treeEnd, err
+	}
+	if !done {
+		return nil, treeEnd, errors.New("left over leaves in range proof")
+	}
+	return rootHash, treeEnd, nil
+}
+
+//verifyItem 验证key对应的值在证明的叶子中
+func (proof *iavlRangeProof) verifyItem(key, value []byte) error {
+	leaves := proof.Leaves
+	i := sort.Search(len(leaves), func(i int) bool {
+		return bytes.Compare(key, leaves[i].Key) <= 0
+	})
+	if i >= len(leaves) || !bytes.Equal(leaves[i].Key, key) {
+		return errors.New("leaf key not found in proof")
+	}
+	if !bytes.Equal(leaves[i].ValueHash, tmhash.Sum(value)) {
+		return errors.New("leaf value hash not same")
+	}
+	return nil
+}
+
+//verifyAbsence 验证key不在树中，需要key两侧相邻的叶子或树的边界
+func (proof *iavlRangeProof) verifyAbsence(key []byte, treeEnd bool) error {
+	cmp := bytes.Compare(key, proof.Leaves[0].Key)
+	if cmp < 0 {
+		if proof.LeftPath.isLeftmost() {
+			return nil
+		}
+		return errors.New("absence not proved by left path")
+	} else if cmp == 0 {
+		return errors.New("absence disproved via first item #0")
+	}
+	if len(proof.LeftPath) == 0 || proof.LeftPath.isRightmost() {
+		return nil
+	}
+
+	for i := 1; i < len(proof.Leaves); i++ {
+		cmp := bytes.Compare(key, proof.Leaves[i].Key)
+		if cmp < 0 {
+			return nil
+		} else if cmp == 0 {
+			return fmt.Errorf("absence disproved via item #%d", i)
+		}
+	}
+
+	if treeEnd {
+		return nil
+	}
+	return errors.New("absence not proved by right leaf")
+}
+
+//iavlValueOp 证明值存在于IAVL树，输入为值，输出为IAVL树根
+type iavlValueOp struct {
+	key   []byte
+	Proof *iavlRangeProof
+}
+
+func iavlValueOpDecoder(pop merkle.ProofOp) (merkle.ProofOperator, error) {
+	if pop.Type != ProofOpIAVLValue {
+		return nil, fmt.Errorf("unexpected ProofOp.Type; got %v, want %v", pop.Type, ProofOpIAVLValue)
+	}
+	var op iavlValueOp
+	if err := cdc.UnmarshalBinaryLengthPrefixed(pop.Data, &op); err != nil {
+		return nil, fmt.Errorf("decoding ProofOp.Data into IAVLValueOp: %v", err)
+	}
+	if op.Proof == nil {
+		return nil, errors.New("IAVLValueOp has no proof")
+	}
+	op.key = pop.Key
+	return op, nil
+}
+
+func (op iavlValueOp) Run(args [][]byte) ([][]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("value size is not 1")
+	}
+	root, _, err := op.Proof.computeRootHash()
+	if err != nil {
+		return nil, err
+	}
+	if err := op.Proof.verifyItem(op.key, args[0]); err != nil {
+		return nil, err
+	}
+	return [][]byte{root}, nil
+}
+
+func (op iavlValueOp) GetKey() []byte {
+	return op.key
+}
+
+func (op iavlValueOp) ProofOp() merkle.ProofOp {
+	return merkle.ProofOp{
+		Type: ProofOpIAVLValue,
+		Key:  op.key,
+		Data: cdc.MustMarshalBinaryLengthPrefixed(op),
+	}
+}
+
+//iavlAbsenceOp 证明key不存在于IAVL树，输出为IAVL树根
+type iavlAbsenceOp struct {
+	key   []byte
+	Proof *iavlRangeProof
+}
+
+func iavlAbsenceOpDecoder(pop merkle.ProofOp) (merkle.ProofOperator, error) {
+	if pop.Type != ProofOpIAVLAbsence {
+		return nil, fmt.Errorf("unexpected ProofOp.Type; got %v, want %v", pop.Type, ProofOpIAVLAbsence)
+	}
+	var op iavlAbsenceOp
+	if err := cdc.UnmarshalBinaryLengthPrefixed(pop.Data, &op); err != nil {
+		return nil, fmt.Errorf("decoding ProofOp.Data into IAVLAbsenceOp: %v", err)
+	}
+	op.key = pop.Key
+	return op, nil
+}
+
+func (op iavlAbsenceOp) Run(args [][]byte) ([][]byte, error) {
+	if len(args) != 0 {
+		return nil, errors.New("expected 0 args")
+	}
+	//空树没有证明，任何key都不存在
+	if op.Proof == nil {
+		return [][]byte{nil}, nil
+	}
+	root, treeEnd, err := op.Proof.computeRootHash()
+	if err != nil {
+		return nil, err
+	}
+	if err := op.Proof.verifyAbsence(op.key, treeEnd); err != nil {
+		return nil, err
+	}
+	return [][]byte{root}, nil
+}
+
+func (op iavlAbsenceOp) GetKey() []byte {
+	return op.key
+}
+
+func (op iavlAbsenceOp) ProofOp() merkle.ProofOp {
+	return merkle.ProofOp{
+		Type: ProofOpIAVLAbsence,
+		Key:  op.key,
+		Data: cdc.MustMarshalBinaryLengthPrefixed(op),
+	}
+}
+
+//commitID 子存储的版本和树根
+type commitID struct {
+	Version int64
+	Hash    []byte
+}
+
+type storeCore struct {
+	CommitID commitID
+}
+
+//storeInfo 子存储信息，字段顺序与cosmos-sdk的storeInfo一致
+type storeInfo struct {
+	Name string
+	Core storeCore
+}
+
+func (si storeInfo) hash() []byte {
+	bz := cdc.MustMarshalBinaryLengthPrefixed(si.Core)
+	return tmhash.Sum(bz)
+}
+
+//multiStoreProof 全部子存储的信息，用于计算app hash
+type multiStoreProof struct {
+	StoreInfos []storeInfo
+}
+
+func (proof *multiStoreProof) computeRootHash() []byte {
+	m := make(map[string][]byte, len(proof.StoreInfos))
+	for _, si := range proof.StoreInfos {
+		m[si.Name] = si.hash()
+	}
+	return merkle.SimpleHashFromMap(m)
+}
+
+//multiStoreOp 证明子存储树根属于app hash，输入为子存储树根，输出为app hash
+type multiStoreOp struct {
+	key   []byte
+	Proof *multiStoreProof
+}
+
+func multiStoreOpDecoder(pop merkle.ProofOp) (merkle.ProofOperator, error) {
+	if pop.Type != ProofOpMultiStore {
+		return nil, fmt.Errorf("unexpected ProofOp.Type; got %v, want %v", pop.Type, ProofOpMultiStore)
+	}
+	var op multiStoreOp
+	if err := cdc.UnmarshalBinaryLengthPrefixed(pop.Data, &op); err != nil {
+		return nil, fmt.Errorf("decoding ProofOp.Data into MultiStoreProofOp: %v", err)
+	}
+	if op.Proof == nil {
+		return nil, errors.New("MultiStoreProofOp has no proof")
+	}
+	op.key = pop.Key
+	return op, nil
+}
+
+func (op multiStoreOp) Run(args [][]byte) ([][]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("value size is not 1")
+	}
+	root := args[0]
+	for _, si := range op.Proof.StoreInfos {
+		if si.Name == string(op.key) {
+			if bytes.Equal(si.Core.CommitID.Hash, root) {
+				return [][]byte{op.Proof.computeRootHash()}, nil
+			}
+			return nil, fmt.Errorf("hash mismatch for substore %v: %X vs %X", si.Name, si.Core.CommitID.Hash, root)
+		}
+	}
+	return nil, fmt.Errorf("key %v not found in multistore proof", string(op.key))
+}
+
+func (op multiStoreOp) GetKey() []byte {
+	return op.key
+}
+
+func (op multiStoreOp) ProofOp() merkle.ProofOp {
+	return merkle.ProofOp{
+		Type: ProofOpMultiStore,
+		Key:  op.key,
+		Data: cdc.MustMarshalBinaryLengthPrefixed(op),
+	}
+}
+
+//SetVerifyProof 设置是否要求节点返回Merkle证明并验证账户查询结果
+func (c *Client) SetVerifyProof(verify bool) {
+	c.VerifyProof = verify
+}
+
+//abciQueryVerified 带证明查询子存储的key，验证通过后返回值和查询高度，值为空表示key不存在。
+//证明需要与height+1区块头中的app hash一致，height为0时查询最新高度的前一个区块
+func (c *Client) abciQueryVerified(ctx context.Context, store string, key []byte, height uint64) ([]byte, uint64, error) {
+
+	if height == 0 {
+		latest, err := c.getBlockHeightContext(ctx)
+		if err != nil {
+			return nil, 0, err
+		}
+		if latest < 2 {
+			return nil, 0, &RPCError{Kind: ErrHeightNotFound, Message: "no committed app hash to verify against"}
+		}
+		height = latest - 1
+	}
+
+	path := fmt.Sprintf("/abci_query?path=\"/store/%s/key\"&data=0x%s&height=%d&prove=true", store, hex.EncodeToString(key), height)
+
+	r, err := c.CallContext(ctx, path, nil, "GET")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	response := r.Get("result").Get("response")
+	if code := response.Get("code").Int(); code != 0 {
+		return nil, 0, &RPCError{Kind: ErrRPCFailed, Code: code, Message: response.Get("log").String()}
+	}
+	if h := response.Get("height").Uint(); h != height {
+		return nil, 0, &RPCError{Kind: ErrProofInvalid, Message: fmt.Sprintf("query height %d, got %d", height, h)}
+	}
+
+	value, err := base64.StdEncoding.DecodeString(response.Get("value").String())
+	if err != nil {
+		return nil, 0, &RPCError{Kind: ErrProofInvalid, Message: "invalid value: " + err.Error()}
+	}
+
+	ops := response.Get("proof").Get("ops").Array()
+	if len(ops) == 0 {
+		return nil, 0, &RPCError{Kind: ErrProofInvalid, Message: "node returned no proof"}
+	}
+	proof := &merkle.Proof{}
+	for _, op := range ops {
+		opKey, err := base64.StdEncoding.DecodeString(op.Get("key").String())
+		if err != nil {
+			return nil, 0, &RPCError{Kind: ErrProofInvalid, Message: "invalid proof key: " + err.Error()}
+		}
+		opData, err := base64.StdEncoding.DecodeString(op.Get("data").String())
+		if err != nil {
+			return nil, 0, &RPCError{Kind: ErrProofInvalid, Message: "invalid proof data: " + err.Error()}
+		}
+		proof.Ops = append(proof.Ops, merkle.ProofOp{Type: op.Get("type").String(), Key: opKey, Data: opData})
+	}
+
+	appHash, err := c.getAppHashContext(ctx, height+1)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	keyPath := merkle.KeyPath{}.AppendKey([]byte(store), merkle.KeyEncodingURL).AppendKey(key, merkle.KeyEncodingHex).String()
+	if len(value) == 0 {
+		err = proofRuntime.VerifyAbsence(proof, appHash, keyPath)
+	} else {
+		err = proofRuntime.VerifyValue(proof, appHash, keyPath, value)
+	}
+	if err != nil {
+		return nil, 0, &RPCError{Kind: ErrProofInvalid, Message: err.Error()}
+	}
+
+	return value, height, nil
+}
+
+//getAppHashContext 获取区块头中的app hash，即上一个区块执行后的状态根。
+//只使用轻客户端通过签名验证的区块头，返回证明的节点提供的/commit不可信
+func (c *Client) getAppHashContext(ctx context.Context, height uint64) ([]byte, error) {
+
+	if c.lightClient == nil {
+		return nil, &RPCError{Kind: ErrProofInvalid, Message: "query proof needs a light client with a trusted validator set"}
+	}
+
+	header, err := c.lightClient.VerifyHeaderContext(ctx, height)
+	if err != nil {
+		return nil, err
+	}
+	if len(header.AppHash) == 0 {
+		return nil, &RPCError{Kind: ErrProofInvalid, Message: fmt.Sprintf("empty app hash of height %d", height)}
+	}
+
+	return header.AppHash, nil
+}
@@ -0,0 +1,200 @@
+package binancechain
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/binance-chain/go-sdk/common/bech32"
+	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/tendermint/tendermint/crypto/merkle"
+	"github.com/tendermint/tendermint/crypto/tmhash"
+)
+
+//proofNode 模拟节点的账户存储，两个账户组成的IAVL树和两个子存储组成的app hash
+type proofNode struct {
+	keys     [][]byte
+	values   [][]byte
+	leaves   []iavlLeafNode
+	iavlRoot []byte
+	stores   *multiStoreProof
+	appHash  []byte
+	vals     *mockValidators
+	chain    *mockLightChain
+}
+
+func newProofNode(values map[string][]byte) *proofNode {
+	node := &proofNode{}
+	for key, value := range values {
+		node.keys = append(node.keys, []byte(key))
+		node.values = append(node.values, value)
+	}
+	if strings.Compare(string(node.keys[0]), string(node.keys[1])) > 0 {
+		node.keys[0], node.keys[1] = node.keys[1], node.keys[0]
+		node.values[0], node.values[1] = node.values[1], node.values[0]
+	}
+	for i := range node.keys {
+		node.leaves = append(node.leaves, iavlLeafNode{Key: node.keys[i], ValueHash: tmhash.Sum(node.values[i]), Version: 1})
+	}
+	node.iavlRoot = iavlInnerNode{Height: 1, Size: 2, Version: 1, Left: node.leaves[0].hash()}.hash(node.leaves[1].hash())
+	node.stores = &multiStoreProof{StoreInfos: []storeInfo{
+		{Name: "acc", Core: storeCore{CommitID: commitID{Version: 1, Hash: node.iavlRoot}}},
+		{Name: "main", Core: storeCore{CommitID: commitID{Version: 1, Hash: tmhash.Sum([]byte("main"))}}},
+	}}
+	node.appHash = node.stores.computeRootHash()
+	//查询高度100的状态，签名的101区块头承诺了app hash
+	node.vals = newMockValidators(4)
+	node.chain = newMockLightChain("Binance-Chain-Tigris")
+	node.chain.appHash = node.appHash
+	node.chain.addBlock(101, node.vals, node.vals, nil)
+	return node
+}
+
+//client 创建使用轻客户端验证区块头的客户端
+func (node *proofNode) client(url string) *Client {
+	c := NewClient(url, false)
+	c.SetAccountCacheTTL(0)
+	c.SetVerifyProof(true)
+	lc := NewLightClient(func() *Client { return c })
+	lc.TrustedValidatorsHash = node.vals.vals.Hash()
+	c.SetLightClient(lc)
+	return c
+}
+
+//proof 生成key的存在或不存在证明
+func (node *proofNode) proof(key []byte) ([]byte, []merkle.ProofOp) {
+	var (
+		value []byte
+		iavl  merkle.ProofOp
+	)
+	switch {
+	case string(key) == string(node.keys[0]):
+		value = node.values[0]
+		iavl = iavlValueOp{key: key, Proof: &iavlRangeProof{
+			LeftPath: iavlPathToLeaf{{Height: 1, Size: 2, Version: 1, Right: node.leaves[1].hash()}},
+			Leaves:   node.leaves[:1],
+		}}.ProofOp()
+	case string(key) == string(node.keys[1]):
+		value = node.values[1]
+		iavl = iavlValueOp{key: key, Proof: &iavlRangeProof{
+			LeftPath: iavlPathToLeaf{{Height: 1, Size: 2, Version: 1, Left: node.leaves[0].hash()}},
+			Leaves:   node.leaves[1:],
+		}}.ProofOp()
+	default:
+		iavl = iavlAbsenceOp{key: key, Proof: &iavlRangeProof{
+			LeftPath:   iavlPathToLeaf{{Height: 1, Size: 2, Version: 1, Right: node.leaves[1].hash()}},
+			InnerNodes: []iavlPathToLeaf{{}},
+			Leaves:     node.leaves,
+		}}.ProofOp()
+	}
+	return value, []merkle.ProofOp{iavl, multiStoreOp{key: []byte("acc"), Proof: node.stores}.ProofOp()}
+}
+
+func (node *proofNode) serve(tamper func(value []byte) []byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/status":
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":"","result":{"sync_info":{"latest_block_height":"101"}}}`)
+		case "/commit", "/validators":
+			node.chain.handle(w, r)
+		case "/abci_query":
+			if r.URL.Query().Get("prove") != "true" {
+				fmt.Fprint(w, `{"jsonrpc":"2.0","id":"","error":{"code":-1,"message":"prove expected"}}`)
+				return
+			}
+			key, _ := hex.DecodeString(strings.TrimPrefix(r.URL.Query().Get("data"), "0x"))
+			value, ops := node.proof(key)
+			if tamper != nil {
+				value = tamper(value)
+			}
+			opsJSON := make([]string, 0)
+			for _, op := range ops {
+				opsJSON = append(opsJSON, fmt.Sprintf(`{"type":"%s","key":"%s","data":"%s"}`, op.Type,
+					base64.StdEncoding.EncodeToString(op.Key), base64.StdEncoding.EncodeToString(op.Data)))
+			}
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":"","result":{"response":{"value":"%s","height":"%s","proof":{"ops":[%s]}}}}`,
+				base64.StdEncoding.EncodeToString(value), r.URL.Query().Get("height"), strings.Join(opsJSON, ","))
+		}
+	}))
+}
+
+func Test_verifiedAccountQuery(t *testing.T) {
+	accounts := make([]string, 0)
+	values := make(map[string][]byte)
+	for i := 1; i <= 3; i++ {
+		hash := make([]byte, 20)
+		hash[0] = byte(i)
+		addr, _ := bech32.ConvertAndEncode("bnb", hash)
+		accounts = append(accounts, addr)
+		if i == 2 {
+			//第二个地址不在链上，需要不存在证明
+			continue
+		}
+		var acc types.Account = &types.AppAccount{BaseAccount: types.BaseAccount{
+			Address:       types.AccAddress(hash),
+			Coins:         types.Coins{{Denom: "BNB", Amount: int64(i * 100)}},
+			AccountNumber: int64(i),
+		}}
+		values["account:"+string(hash)], _ = cdc.MarshalBinaryBare(acc)
+	}
+
+	node := newProofNode(values)
+	server := node.serve(nil)
+	defer server.Close()
+
+	//没有轻客户端时节点自己返回的app hash不可信
+	c := NewClient(server.URL, false)
+	c.SetAccountCacheTTL(0)
+	c.SetVerifyProof(true)
+	if _, err := c.getAccountInfo(accounts[0]); ErrorKind(err) != ErrProofInvalid {
+		t.Errorf("query proof without light client should be refused, got: %v", err)
+	}
+
+	c = node.client(server.URL)
+	for i, addr := range accounts {
+		info, err := c.getAccountInfo(addr)
+		if err != nil {
+			t.Fatalf("verified query of [%s] failed unexpected error: %v", addr, err)
+		}
+		expected := int64((i + 1) * 100)
+		if i == 1 {
+			expected = 0
+		}
+		if bnb := info.Coin("BNB"); bnb.Free != expected {
+			t.Errorf("unexpected BNB of [%s]: %+v", addr, bnb)
+		}
+	}
+
+	//节点篡改余额时拒绝结果
+	tampered := node.serve(func(value []byte) []byte {
+		if len(value) == 0 {
+			return value
+		}
+		var acc types.Account
+		cdc.UnmarshalBinaryBare(value, &acc)
+		acc.SetCoins(types.Coins{{Denom: "BNB", Amount: 999999}})
+		bz, _ := cdc.MarshalBinaryBare(acc)
+		return bz
+	})
+	defer tampered.Close()
+
+	c = node.client(tampered.URL)
+	if _, err := c.getAccountInfo(accounts[0]); ErrorKind(err) != ErrProofInvalid {
+		t.Errorf("tampered value should be refused, got: %v", err)
+	}
+
+	//节点隐瞒存在的账户时拒绝结果
+	hidden := node.serve(func(value []byte) []byte {
+		return nil
+	})
+	defer hidden.Close()
+
+	c = node.client(hidden.URL)
+	if _, err := c.getAccountInfo(accounts[2]); ErrorKind(err) != ErrProofInvalid {
+		t.Errorf("hidden account should be refused, got: %v", err)
+	}
+}
@@ -0,0 +1,201 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package binancechain
+
+import (
+	"encoding/hex"
+	"encoding/json"
+
+	ctypes "github.com/binance-chain/go-sdk/common/types"
+	"github.com/binance-chain/go-sdk/types/msg"
+	"github.com/binance-chain/go-sdk/types/tx"
+	"github.com/blocktree/go-owcdrivers/binancechainTransaction"
+	owcrypt "github.com/blocktree/go-owcrypt"
+)
+
+//binancechainTransaction中的链ID和地址前缀固定为主网，go-sdk按全局的types.Network编码地址，
+//这里按配置的链ID和地址前缀构建和验证签名文档，不修改go-sdk的全局设置
+
+//signCoin 签名数据中的币种数量
+type signCoin struct {
+	Denom  string `json:"denom"`
+	Amount int64  `json:"amount"`
+}
+
+//signInOut 签名数据中的转账输入或输出，地址为bech32字符串
+type signInOut struct {
+	Address string     `json:"address"`
+	Coins   []signCoin `json:"coins"`
+}
+
+//signSendMsg 签名数据中的转账消息，与go-sdk的SendMsg签名数据结构一致
+type signSendMsg struct {
+	Inputs  []signInOut `json:"inputs"`
+	Outputs []signInOut `json:"outputs"`
+}
+
+//newSignInOut 按地址前缀转换转账输入或输出
+func newSignInOut(prefix string, address ctypes.AccAddress, coins ctypes.Coins) signInOut {
+	obj := signInOut{Address: encodeAddress(address, prefix), Coins: make([]signCoin, 0, len(coins))}
+	for _, coin := range coins {
+		obj.Coins = append(obj.Coins, signCoin{Denom: coin.Denom, Amount: coin.Amount})
+	}
+	return obj
+}
+
+//sendMsg 按地址前缀解码为go-sdk的转账消息
+func (m signSendMsg) sendMsg(prefix string) (msg.SendMsg, error) {
+	sendMsg := msg.SendMsg{}
+	for _, input := range m.Inputs {
+		address, coins, err := decodeSignInOut(prefix, input)
+		if err != nil {
+			return msg.SendMsg{}, err
+		}
+		sendMsg.Inputs = append(sendMsg.Inputs, msg.Input{Address: address, Coins: coins})
+	}
+	for _, output := range m.Outputs {
+		address, coins, err := decodeSignInOut(prefix, output)
+		if err != nil {
+			return msg.SendMsg{}, err
+		}
+		sendMsg.Outputs = append(sendMsg.Outputs, msg.Output{Address: address, Coins: coins})
+	}
+	return sendMsg, nil
+}
+
+//decodeSignInOut 校验转账输入或输出的地址前缀，返回地址数据和币种数量
+func decodeSignInOut(prefix string, obj signInOut) (ctypes.AccAddress, ctypes.Coins, error) {
+	address, err := DecodeAddress(obj.Address, prefix)
+	if err != nil {
+		return nil, nil, err
+	}
+	coins := make(ctypes.Coins, 0, len(obj.Coins))
+	for _, coin := range obj.Coins {
+		coins = append(coins, ctypes.Coin{Denom: coin.Denom, Amount: coin.Amount})
+	}
+	return address, coins, nil
+}
+
+//prefixedSendMsg 按指定地址前缀生成签名数据的转账消息，只用于计算签名数据，广播时仍使用SendMsg
+type prefixedSendMsg struct {
+	msg.SendMsg
+	prefix string
+}
+
+//GetSignBytes 签名数据，地址使用prefix编码
+func (m prefixedSendMsg) GetSignBytes() []byte {
+	obj := signSendMsg{
+		Inputs:  make([]signInOut, 0, len(m.Inputs)),
+		Outputs: make([]signInOut, 0, len(m.Outputs)),
+	}
+	for _, input := range m.Inputs {
+		obj.Inputs = append(obj.Inputs, newSignInOut(m.prefix, input.Address, input.Coins))
+	}
+	for _, output := range m.Outputs {
+		obj.Outputs = append(obj.Outputs, newSignInOut(m.prefix, output.Address, output.Coins))
+	}
+	b, err := json.Marshal(obj)
+	if err != nil {
+		panic(err)
+	}
+	return msg.MustSortJSON(b)
+}
+
+//stdSignBytes 按地址前缀计算转账交易单的签名数据
+func stdSignBytes(chainID, prefix string, sendMsg msg.SendMsg, accountNumber, sequence int64, memo string, source int64, data []byte) []byte {
+	msgs := []msg.Msg{prefixedSendMsg{SendMsg: sendMsg, prefix: prefix}}
+	return tx.StdSignBytes(chainID, accountNumber, sequence, msgs, memo, source, data)
+}
+
+//createSendMsg 创建单笔转账消息
+func createSendMsg(prefix, fromAddress, toAddress, denom string, amount int64) (msg.SendMsg, error) {
+	from, err := DecodeAddress(fromAddress, prefix)
+	if err != nil {
+		return msg.SendMsg{}, err
+	}
+	to, err := DecodeAddress(toAddress, prefix)
+	if err != nil {
+		return msg.SendMsg{}, err
+	}
+	coins := ctypes.Coins{{Denom: denom, Amount: amount}}
+	return msg.CreateSendMsg(from, coins, []msg.Transfer{{ToAddr: to, Coins: coins}}), nil
+}
+
+//createEmptyTransactionAndHash 创建待签名的签名文档和签名哈希
+func createEmptyTransactionAndHash(chainID, prefix, from, to, denom string, amount, accountNumber, sequence, source int64, memo string) (string, string, error) {
+	sendMsg, err := createSendMsg(prefix, from, to, denom, amount)
+	if err != nil {
+		return "", "", err
+	}
+
+	signBytes := stdSignBytes(chainID, prefix, sendMsg, accountNumber, sequence, memo, source, nil)
+	hash := owcrypt.Hash(signBytes, 0, owcrypt.HASH_ALG_SHA256)
+	return string(signBytes), hex.EncodeToString(hash), nil
+}
+
+//verifyAndCombineRawTransaction 验证签名文档的链ID、地址前缀和签名，通过后合成待广播的交易单
+func verifyAndCombineRawTransaction(chainID, prefix, emptyTrans, signature, pubkey string) (bool, string) {
+
+	var (
+		stdSignDoc tx.StdSignDoc
+		signMsg    signSendMsg
+	)
+
+	if err := tx.Cdc.UnmarshalJSON([]byte(emptyTrans), &stdSignDoc); err != nil || len(stdSignDoc.Msgs) == 0 {
+		return false, ""
+	}
+	if stdSignDoc.ChainID != chainID {
+		return false, ""
+	}
+	if err := json.Unmarshal(stdSignDoc.Msgs[0], &signMsg); err != nil {
+		return false, ""
+	}
+	sendMsg, err := signMsg.sendMsg(prefix)
+	if err != nil {
+		return false, ""
+	}
+
+	sigBytes, err := hex.DecodeString(signature)
+	if err != nil || len(sigBytes) != 64 {
+		return false, ""
+	}
+	pubBytes, err := hex.DecodeString(pubkey)
+	if err != nil || len(pubBytes) != 33 {
+		return false, ""
+	}
+
+	hash := stdSignBytes(chainID, prefix, sendMsg, stdSignDoc.AccountNumber, stdSignDoc.Sequence, stdSignDoc.Memo, stdSignDoc.Source, stdSignDoc.Data)
+	hash = owcrypt.Hash(hash, 0, owcrypt.HASH_ALG_SHA256)
+
+	pubUncompressedBytes := owcrypt.PointDecompress(pubBytes, owcrypt.ECC_CURVE_SECP256K1)[1:]
+	if owcrypt.SUCCESS != owcrypt.Verify(pubUncompressedBytes, nil, 0, hash, 32, sigBytes, owcrypt.ECC_CURVE_SECP256K1) {
+		return false, ""
+	}
+
+	stdSignature := tx.StdSignature{
+		AccountNumber: stdSignDoc.AccountNumber,
+		Sequence:      stdSignDoc.Sequence,
+		PubKey:        binancechainTransaction.NewPubkey(pubBytes),
+		Signature:     sigBytes,
+	}
+
+	newTx := tx.NewStdTx([]msg.Msg{sendMsg}, []tx.StdSignature{stdSignature}, stdSignDoc.Memo, stdSignDoc.Source, stdSignDoc.Data)
+	bz, err := tx.Cdc.MarshalBinaryLengthPrefixed(&newTx)
+	if err != nil {
+		return false, ""
+	}
+	return true, hex.EncodeToString(bz)
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package binancechain
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	defaultMaxBlockAge = 2 * time.Minute //默认最新区块的最大时间差，超过时认为节点或链已停止出块
+)
+
+//NodeSyncState 扫描器最近一次检查到的节点同步状态
+type NodeSyncState struct {
+	Height       uint64    //节点最新区块高度
+	BlockTime    time.Time //节点最新区块时间
+	CatchingUp   bool      //节点是否正在追赶区块
+	Stalled      bool      //是否因节点同步中或最新区块过旧暂停扫描
+	StalledSince time.Time //开始暂停扫描的时间
+	Reason       string    //暂停扫描的原因
+	CheckedAt    time.Time //检查时间
+}
+
+//String 状态描述，用于日志和状态输出
+func (state NodeSyncState) String() string {
+	if !state.Stalled {
+		return fmt.Sprintf("node in sync, height: %d, block time: %s", state.Height, state.BlockTime.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("scanning paused for %v: %s", state.CheckedAt.Sub(state.StalledSince).Round(time.Second), state.Reason)
+}
+
+//SyncState 最近一次检查到的节点同步状态
+func (bs *BNBBlockScanner) SyncState() NodeSyncState {
+	bs.syncMu.Lock()
+	defer bs.syncMu.Unlock()
+	return bs.syncState
+}
+
+//updateSyncState 根据节点状态更新同步状态，节点正在追赶区块或最新区块过旧时返回false，
+//进入和离开暂停状态时调用OnStalled和OnResumed
+func (bs *BNBBlockScanner) updateSyncState(status *NodeStatus) bool {
+
+	now := time.Now()
+	reason := ""
+	if status.CatchingUp {
+		reason = fmt.Sprintf("node is catching up at height %d", status.LatestBlockHeight)
+	} else if bs.MaxBlockAge > 0 && !status.LatestBlockTime.IsZero() {
+		if age := now.Sub(status.LatestBlockTime); age > bs.MaxBlockAge {
+			reason = fmt.Sprintf("latest block %d is %v old, node or chain may be halted", status.LatestBlockHeight, age.Round(time.Second))
+		}
+	}
+
+	bs.syncMu.Lock()
+	prev := bs.syncState
+	state := NodeSyncState{
+		Height:     status.LatestBlockHeight,
+		BlockTime:  status.LatestBlockTime,
+		CatchingUp: status.CatchingUp,
+		Stalled:    len(reason) > 0,
+		Reason:     reason,
+		CheckedAt:  now,
+	}
+	if state.Stalled {
+		state.StalledSince = now
+		if prev.Stalled {
+			state.StalledSince = prev.StalledSince
+		}
+	}
+	bs.syncState = state
+	onStalled, onResumed := bs.OnStalled, bs.OnResumed
+	bs.syncMu.Unlock()
+
+	switch {
+	case state.Stalled && !prev.Stalled:
+		bs.wm.Log.Std.Error("block scanner paused; %s", state.Reason)
+		if onStalled != nil {
+			onStalled(state)
+		}
+	case state.Stalled:
+		bs.wm.Log.Std.Warning("block scanner still paused; %s", state.String())
+	case prev.Stalled:
+		bs.wm.Log.Std.Info("block scanner resumed after %v; %s", now.Sub(prev.StalledSince).Round(time.Second), state.String())
+		if onResumed != nil {
+			onResumed(state)
+		}
+	}
+
+	return !state.Stalled
+}
@@ -0,0 +1,54 @@
+package binancechain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blocktree/binance-chain-adapter/binancechaintest"
+)
+
+func Test_syncStateGating(t *testing.T) {
+	node := binancechaintest.NewNode("")
+	defer node.Close()
+	node.ProduceBlock()
+	node.ProduceBlock()
+
+	wm, cleanup := newMockNodeWalletManager(t, node)
+	defer cleanup()
+
+	bs := wm.Blockscanner
+	bs.Scanning = true
+	bs.RescanLastBlockCount = 0
+	bs.ScanAddressFunc = func(address string) (string, bool) { return "", false }
+	wm.SaveLocalNewBlock(1, node.BlockHash(1))
+
+	var stalled, resumed []NodeSyncState
+	bs.OnStalled = func(state NodeSyncState) { stalled = append(stalled, state) }
+	bs.OnResumed = func(state NodeSyncState) { resumed = append(resumed, state) }
+
+	//节点正在追赶区块时暂停扫描
+	node.SetCatchingUp(true)
+	bs.ScanBlockTask()
+	state := bs.SyncState()
+	if height := bs.GetScannedBlockHeight(); height != 1 || !state.Stalled || !state.CatchingUp || len(stalled) != 1 {
+		t.Fatalf("scanned height = %d with state %+v and %d alerts, expected paused at 1 with 1 alert", height, state, len(stalled))
+	}
+	since := state.StalledSince
+
+	//追赶完成但最新区块过旧，仍然暂停且不重复告警
+	node.SetCatchingUp(false)
+	node.ShiftTime(10 * time.Minute)
+	bs.ScanBlockTask()
+	state = bs.SyncState()
+	if height := bs.GetScannedBlockHeight(); height != 1 || !state.Stalled || state.CatchingUp || len(stalled) != 1 || !state.StalledSince.Equal(since) {
+		t.Fatalf("scanned height = %d with state %+v and %d alerts, expected still paused at 1", height, state, len(stalled))
+	}
+
+	//出新块后继续扫描
+	node.ProduceBlock()
+	bs.ScanBlockTask()
+	state = bs.SyncState()
+	if height := bs.GetScannedBlockHeight(); height != 3 || state.Stalled || len(resumed) != 1 {
+		t.Errorf("scanned height = %d with state %+v and %d resumes, expected 3 resumed once", height, state, len(resumed))
+	}
+}
@@ -0,0 +1,253 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package binancechain
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+const (
+	TokenDecimals        = 8                //BEP2代币的小数位，链上所有代币都固定为8位
+	TokenProtocol        = "BEP2"           //代币协议
+	defaultTokenCacheTTL = 30 * time.Minute //默认代币缓存有效期
+	tokensPageSize       = 1000             //tokens/list单页最大数量
+)
+
+//TokenInfo BEP2代币信息，TotalSupply为最小单位
+type TokenInfo struct {
+	Symbol      string //链上唯一的代币符号，如XYZ-000
+	Name        string //代币名称
+	OrigSymbol  string //发行时的原始符号，如XYZ
+	TotalSupply uint64 //总发行量
+	Owner       string //发行人地址
+	Mintable    bool   //是否可增发
+	Decimals    uint64 //小数位
+}
+
+//NewTokenInfo 转换链上的代币信息，发行人地址按prefix编码
+func NewTokenInfo(token *types.Token, prefix string) *TokenInfo {
+	info := &TokenInfo{
+		Symbol:      token.Symbol,
+		Name:        token.Name,
+		OrigSymbol:  token.OrigSymbol,
+		TotalSupply: uint64(token.TotalSupply.ToInt64()),
+		Mintable:    token.Mintable,
+		Decimals:    TokenDecimals,
+	}
+	if len(token.Owner) > 0 {
+		info.Owner = encodeAddress(token.Owner, prefix)
+	}
+	return info
+}
+
+//Contract 转为openwallet合约信息，symbol为主链symbol
+func (info *TokenInfo) Contract(symbol string) openwallet.SmartContract {
+	return openwallet.SmartContract{
+		ContractID: openwallet.GenContractID(symbol, info.Symbol),
+		Symbol:     symbol,
+		Address:    info.Symbol,
+		Token:      info.OrigSymbol,
+		Protocol:   TokenProtocol,
+		Name:       info.Name,
+		Decimals:   info.Decimals,
+	}
+}
+
+//tokenCacheItem 代币缓存项
+type tokenCacheItem struct {
+	info   *TokenInfo
+	expire time.Time
+}
+
+//TokenRegistry 代币信息登记表，从链上tokens存储加载代币信息并缓存，
+//为区块扫描、手续费和余额查询提供正确的小数位和名称
+type TokenRegistry struct {
+	mu      sync.Mutex
+	TTL     time.Duration //缓存有效期，过期后重新查询，查询失败时继续使用过期的信息
+	Prefix  string        //发行人地址的bech32前缀
+	backend func() ChainBackend
+	items   map[string]*tokenCacheItem
+}
+
+//NewTokenRegistry 创建代币登记表，backend返回当前的数据源
+func NewTokenRegistry(backend func() ChainBackend) *TokenRegistry {
+	return &TokenRegistry{
+		TTL:     defaultTokenCacheTTL,
+		Prefix:  MainnetAddressPrefix,
+		backend: backend,
+		items:   make(map[string]*tokenCacheItem),
+	}
+}
+
+//tokenBackend 支持查询代币的数据源
+func (r *TokenRegistry) tokenBackend() (TokenBackend, error) {
+	backend, ok := r.backend().(TokenBackend)
+	if !ok {
+		return nil, fmt.Errorf("chain backend doesn't support token query")
+	}
+	return backend, nil
+}
+
+//Load 分页加载链上全部代币，返回加载的数量
+func (r *TokenRegistry) Load(ctx context.Context) (int, error) {
+
+	backend, err := r.tokenBackend()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for offset := 0; ; offset += tokensPageSize {
+		tokens, err := backend.GetTokens(ctx, offset, tokensPageSize)
+		if err != nil {
+			return count, err
+		}
+		for i := range tokens {
+			r.set(NewTokenInfo(&tokens[i], r.Prefix))
+		}
+		count += len(tokens)
+		if len(tokens) < tokensPageSize {
+			return count, nil
+		}
+	}
+}
+
+//Token 查询代币信息，优先使用缓存
+func (r *TokenRegistry) Token(ctx context.Context, symbol string) (*TokenInfo, error) {
+
+	symbol = strings.ToUpper(symbol)
+
+	cached, fresh := r.get(symbol)
+	if fresh {
+		return cached, nil
+	}
+
+	backend, err := r.tokenBackend()
+	if err == nil {
+		var token *types.Token
+		token, err = backend.GetToken(ctx, symbol)
+		if err == nil {
+			info := NewTokenInfo(token, r.Prefix)
+			r.set(info)
+			return info, nil
+		}
+	}
+
+	//节点暂时不可用时继续使用过期的信息
+	if cached != nil && ErrorKind(err) != ErrTokenNotFound {
+		return cached, nil
+	}
+	return nil, err
+}
+
+//Contract 代币的openwallet合约信息，查询失败时名称使用代币符号，小数位仍为BEP2固定的8位
+func (r *TokenRegistry) Contract(ctx context.Context, symbol, denom string) (openwallet.SmartContract, error) {
+	info, err := r.Token(ctx, denom)
+	if err != nil {
+		info = &TokenInfo{Symbol: denom, Name: denom, OrigSymbol: strings.Split(denom, "-")[0], Decimals: TokenDecimals}
+	}
+	return info.Contract(symbol), err
+}
+
+//get 缓存的代币信息及是否在有效期内
+func (r *TokenRegistry) get(symbol string) (*TokenInfo, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	item, exist := r.items[symbol]
+	if !exist {
+		return nil, false
+	}
+	return item.info, time.Now().Before(item.expire)
+}
+
+//set 缓存代币信息
+func (r *TokenRegistry) set(info *TokenInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.items[strings.ToUpper(info.Symbol)] = &tokenCacheItem{
+		info:   info,
+		expire: time.Now().Add(r.TTL),
+	}
+}
+
+//getToken 查询单个代币信息
+func (c *Client) getToken(symbol string) (*types.Token, error) {
+	return c.getTokenContext(context.Background(), symbol)
+}
+
+func (c *Client) getTokenContext(ctx context.Context, symbol string) (*types.Token, error) {
+
+	path := fmt.Sprintf("/abci_query?path=\"tokens/info/%s\"", symbol)
+
+	resp, err := c.CallContext(ctx, path, nil, "GET")
+	if err != nil {
+		return nil, err
+	}
+
+	//代币不存在时节点返回错误码和"token(XXX) not found"，其他错误码可能是节点暂时的错误
+	response := resp.Get("result").Get("response")
+	if code := response.Get("code").Int(); code != 0 {
+		log := response.Get("log").String()
+		if strings.Contains(log, "not found") {
+			return nil, &RPCError{Kind: ErrTokenNotFound, Code: code, Message: log}
+		}
+		return nil, &RPCError{Kind: ErrRPCFailed, Code: code, Message: log}
+	}
+
+	data, err := base64.StdEncoding.DecodeString(response.Get("value").String())
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, &RPCError{Kind: ErrTokenNotFound, Message: "token " + symbol + " not found"}
+	}
+
+	token := &types.Token{}
+	err = cdc.UnmarshalBinaryLengthPrefixed(data, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+//dexGetTokenContext HTTP API没有单个代币的查询接口，分页查找代币
+func (c *Client) dexGetTokenContext(ctx context.Context, symbol string) (*types.Token, error) {
+	for offset := 0; ; offset += tokensPageSize {
+		tokens, err := c.dexGetTokensContext(ctx, offset, tokensPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for i := range tokens {
+			if strings.EqualFold(tokens[i].Symbol, symbol) {
+				return &tokens[i], nil
+			}
+		}
+		if len(tokens) < tokensPageSize {
+			return nil, &RPCError{Kind: ErrTokenNotFound, Message: "token " + symbol + " not found"}
+		}
+	}
+}
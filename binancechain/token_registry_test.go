@@ -0,0 +1,98 @@
+package binancechain
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/binance-chain/go-sdk/common/types"
+	"github.com/blocktree/binance-chain-adapter/binancechaintest"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/tendermint/tendermint/crypto/secp256k1"
+)
+
+func Test_tokenRegistry(t *testing.T) {
+	node := binancechaintest.NewNode("")
+	defer node.Close()
+
+	key := secp256k1.GenPrivKey()
+	sender := types.AccAddress(key.PubKey().Address())
+	ours := types.AccAddress(append([]byte{3}, make([]byte, 19)...))
+	node.AddToken(types.Token{Name: "XYZ Token", Symbol: "XYZ-000", OrigSymbol: "XYZ", TotalSupply: 100000000000, Owner: sender, Mintable: true})
+	node.Mint(sender.String(), types.Coins{{Denom: "BNB", Amount: 100000000}, {Denom: "XYZ-000", Amount: 5000000000}})
+	node.ProduceBlock()
+
+	wm, cleanup := newMockNodeWalletManager(t, node)
+	defer cleanup()
+	registry := wm.Tokens
+
+	if count, err := registry.Load(context.Background()); err != nil || count != 2 {
+		t.Fatalf("loaded %d tokens, expected 2, %v", count, err)
+	}
+
+	token, err := registry.Token(context.Background(), "xyz-000")
+	if err != nil {
+		t.Fatalf("get token failed unexpected error: %v", err)
+	}
+	if token.Name != "XYZ Token" || token.OrigSymbol != "XYZ" || token.Decimals != 8 || token.TotalSupply != 100000000000 || token.Owner != sender.String() || !token.Mintable {
+		t.Errorf("unexpected token: %+v", token)
+	}
+
+	if _, err := registry.Token(context.Background(), "ABC-111"); ErrorKind(err) != ErrTokenNotFound {
+		t.Errorf("expected token not found, got %v", err)
+	}
+
+	//过期后节点不可用时继续使用缓存
+	registry.TTL = 0
+	registry.set(token)
+	node.FailHTTP("abci_query", 1, http.StatusServiceUnavailable)
+	if cached, err := registry.Token(context.Background(), "XYZ-000"); err != nil || cached.Name != "XYZ Token" {
+		t.Errorf("expected stale token while node unavailable, got %+v, %v", cached, err)
+	}
+	registry.TTL = time.Minute
+
+	//节点返回其他错误码时不视为代币不存在
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":"","result":{"response":{"code":1,"log":"store is not ready"}}}`)
+	}))
+	defer failing.Close()
+	if _, err := NewClient(failing.URL, false).getToken("XYZ-000"); err == nil || ErrorKind(err) == ErrTokenNotFound {
+		t.Errorf("temporary abci error should not mean token not found, got %v", err)
+	}
+
+	//扫描结果使用代币的小数位和名称
+	deposit, _ := binancechaintest.NewSendTx(key, node.ChainID(), 0, 0, ours, types.Coins{{Denom: "XYZ-000", Amount: 150000000}}, "")
+	if code, log, _ := node.Submit(deposit); code != binancechaintest.CodeOK {
+		t.Fatalf("submit deposit failed: [%d]%s", code, log)
+	}
+	node.ProduceBlock()
+
+	extracted, err := wm.Blockscanner.ExtractTransactionData(binancechaintest.TxHash(deposit), func(target openwallet.ScanTarget) (string, bool) {
+		return "ours", target.Address == ours.String() || target.Address == sender.String()
+	})
+	if err != nil {
+		t.Fatalf("extract transaction failed unexpected error: %v", err)
+	}
+	trx := extracted["XYZ-000:ours"][0].Transaction
+	if trx.Coin.Contract.Name != "XYZ Token" || trx.Coin.Contract.Token != "XYZ" || trx.Coin.Contract.Decimals != 8 || trx.Decimal != 8 || trx.To[0] != ours.String()+":1.5" {
+		t.Errorf("unexpected token transaction: %+v", trx)
+	}
+	fee := extracted["fee:ours"][0].Transaction
+	if fee.Amount != "0.000375" || fee.Coin.IsContract || fee.Coin.Symbol != Symbol || fee.Decimal != 8 {
+		t.Errorf("unexpected fee transaction: %+v", fee)
+	}
+
+	//调用方未提供小数位时使用登记表的小数位
+	balances, err := wm.ContractDecoder.GetTokenBalanceByAddress(openwallet.SmartContract{Symbol: Symbol, Address: "XYZ-000"}, ours.String())
+	if err != nil || len(balances) != 1 || balances[0].Balance.Balance != "1.5" || balances[0].Contract.Decimals != 8 {
+		t.Errorf("unexpected token balance: %+v, %v", balances, err)
+	}
+
+	bnb, err := wm.Blockscanner.GetBalanceByAddress(sender.String())
+	if err != nil || len(bnb) != 1 || bnb[0].Balance != "0.999625" {
+		t.Errorf("unexpected BNB balance: %+v, %v", bnb, err)
+	}
+}
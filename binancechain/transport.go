@@ -0,0 +1,150 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package binancechain
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+//TransportOptions 节点请求的认证和传输设置，节点部署在需要认证的反向代理之后时使用
+type TransportOptions struct {
+	User        string //Basic认证用户名
+	Password    string //Basic认证密码
+	BearerToken string //Bearer认证令牌，与Basic认证同时配置时使用Bearer
+	CAFile      string //PEM格式的CA证书文件，可包含多个证书，为空时使用系统CA
+	CertFile    string //mTLS客户端证书文件
+	KeyFile     string //mTLS客户端私钥文件
+	Proxy       string //HTTP代理地址，为空时使用环境变量HTTP_PROXY和HTTPS_PROXY
+}
+
+//authorization Authorization请求头，未配置认证时返回空
+func (opts TransportOptions) authorization() string {
+	if len(opts.BearerToken) > 0 {
+		return "Bearer " + opts.BearerToken
+	}
+	if len(opts.User) > 0 || len(opts.Password) > 0 {
+		return "Basic " + BasicAuth(opts.User, opts.Password)
+	}
+	return ""
+}
+
+//tlsConfig 根据CA证书和客户端证书生成TLS设置，都未配置时返回nil
+func (opts TransportOptions) tlsConfig() (*tls.Config, error) {
+
+	if len(opts.CAFile) == 0 && len(opts.CertFile) == 0 && len(opts.KeyFile) == 0 {
+		return nil, nil
+	}
+
+	config := &tls.Config{}
+
+	if len(opts.CAFile) > 0 {
+		pem, err := ioutil.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file failed: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in CA file %s", opts.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if len(opts.CertFile) > 0 || len(opts.KeyFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate failed: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+//proxy 代理设置
+func (opts TransportOptions) proxy() (func(*http.Request) (*url.URL, error), error) {
+	if len(opts.Proxy) == 0 {
+		return http.ProxyFromEnvironment, nil
+	}
+	proxyURL, err := url.Parse(opts.Proxy)
+	if err != nil || len(proxyURL.Host) == 0 {
+		return nil, fmt.Errorf("invalid proxy url: %s", opts.Proxy)
+	}
+	return http.ProxyURL(proxyURL), nil
+}
+
+//SetTransport 设置节点请求的认证、TLS证书和代理，websocket订阅使用相同的设置
+func (c *Client) SetTransport(opts TransportOptions) error {
+
+	tlsConfig, err := opts.tlsConfig()
+	if err != nil {
+		return err
+	}
+	proxy, err := opts.proxy()
+	if err != nil {
+		return err
+	}
+
+	jar, _ := cookiejar.New(nil)
+	c.client.SetClient(&http.Client{
+		Jar: jar,
+		Transport: &http.Transport{
+			Proxy: proxy,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			TLSClientConfig:       tlsConfig,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+	})
+
+	c.transport = opts
+	c.tlsConfig = tlsConfig
+	c.proxy = proxy
+	return nil
+}
+
+//header 每个请求附加的请求头
+func (c *Client) header() http.Header {
+	header := http.Header{}
+	if auth := c.transport.authorization(); len(auth) > 0 {
+		header.Set("Authorization", auth)
+	}
+	return header
+}
+
+//wsDialer websocket连接使用的拨号器和请求头
+func (c *Client) wsDialer() (*websocket.Dialer, http.Header) {
+	dialer := *websocket.DefaultDialer
+	if c.proxy != nil {
+		dialer.Proxy = c.proxy
+	}
+	dialer.TLSClientConfig = c.tlsConfig
+	return &dialer, c.header()
+}
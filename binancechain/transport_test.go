@@ -0,0 +1,125 @@
+package binancechain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//testCert 生成由parent签名的证书，parent为nil时生成自签名CA
+func testCert(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte, []byte) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("create certificate failed unexpected error: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return cert, key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func Test_clientTransport(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "binancechain")
+	defer os.RemoveAll(dir)
+
+	ca, caKey, caPEM, _ := testCert(t, "test ca", nil, nil)
+	_, _, serverPEM, serverKeyPEM := testCert(t, "node", ca, caKey)
+	_, _, clientPEM, clientKeyPEM := testCert(t, "wallet", ca, caKey)
+	ioutil.WriteFile(filepath.Join(dir, "ca.pem"), caPEM, 0600)
+	ioutil.WriteFile(filepath.Join(dir, "client.pem"), clientPEM, 0600)
+	ioutil.WriteFile(filepath.Join(dir, "client.key"), clientKeyPEM, 0600)
+
+	//节点在处理请求的goroutine中记录，测试goroutine中读取
+	var auth atomic.Value
+	status := func(w http.ResponseWriter, r *http.Request) {
+		auth.Store(r.Header.Get("Authorization"))
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":"","result":{"node_info":{"network":"Binance-Chain-Tigris"},"sync_info":{"latest_block_height":"88"}}}`)
+	}
+
+	//要求客户端证书的TLS节点
+	serverCert, _ := tls.X509KeyPair(serverPEM, serverKeyPEM)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(status))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert}, ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	wc := NewConfig(Symbol, MasterKey)
+	wc.CertsDir = dir
+	wc.RpcUser, wc.RpcPassword = "wallet", "secret"
+	wc.RpcCAFile = "ca.pem"
+
+	newClient := func(url string, opts TransportOptions) *Client {
+		c := NewClient(url, false)
+		c.SetRetry(0, 0)
+		if err := c.SetTransport(opts); err != nil {
+			t.Fatalf("set transport failed unexpected error: %v", err)
+		}
+		return c
+	}
+
+	//只信任CA但没有客户端证书
+	if _, err := newClient(server.URL, wc.TransportOptions()).getBlockHeight(); err == nil {
+		t.Errorf("expected TLS handshake failure without client certificate")
+	}
+
+	wc.RpcCertFile, wc.RpcKeyFile = "client.pem", "client.key"
+	height, err := newClient(server.URL, wc.TransportOptions()).getBlockHeight()
+	if err != nil || height != 88 {
+		t.Fatalf("height = %d, %v, expected 88", height, err)
+	}
+	if auth.Load() != "Basic "+BasicAuth("wallet", "secret") {
+		t.Errorf("unexpected authorization header: %v", auth.Load())
+	}
+
+	wc.RpcBearerToken = "token"
+	if _, err := newClient(server.URL, wc.TransportOptions()).getBlockHeight(); err != nil || auth.Load() != "Bearer token" {
+		t.Errorf("unexpected authorization header: %v, %v", auth.Load(), err)
+	}
+
+	wc.RpcCAFile = "client.key"
+	if err := NewClient(server.URL, false).SetTransport(wc.TransportOptions()); err == nil {
+		t.Errorf("expected invalid CA file error")
+	}
+
+	//通过代理访问节点
+	var proxied atomic.Value
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Store(r.URL.Host)
+		status(w, r)
+	}))
+	defer proxy.Close()
+	if _, err := newClient("http://node.invalid:27147", TransportOptions{Proxy: proxy.URL}).getBlockHeight(); err != nil || proxied.Load() != "node.invalid:27147" {
+		t.Errorf("request not sent through proxy: %v, %v", proxied.Load(), err)
+	}
+}
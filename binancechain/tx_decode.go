@@ -16,10 +16,11 @@
 package binancechain
 
 import (
+	"context"
 	"encoding/hex"
 	"fmt"
+	"github.com/binance-chain/go-sdk/common/bech32"
 	"github.com/binance-chain/go-sdk/types/tx"
-	"github.com/blocktree/go-owcdrivers/addressEncoder"
 	"github.com/blocktree/go-owcdrivers/binancechainTransaction"
 	"math/big"
 	"sort"
@@ -44,28 +45,39 @@ func NewTransactionDecoder(wm *WalletManager) *TransactionDecoder {
 	return &decoder
 }
 
+//nodeError 节点调用失败时生成openwallet错误，节点暂时不可用等可重试的错误返回ErrCallFullNodeAPIFailed，
+//上层可据此稍后重试；其他错误使用code
+func nodeError(err error, code uint64, format string, a ...interface{}) *openwallet.Error {
+	msg := fmt.Sprintf(format, a...)
+	if IsRetryable(err) {
+		return openwallet.Errorf(openwallet.ErrCallFullNodeAPIFailed, "%s, node is temporarily unavailable: %v", msg, err)
+	}
+	return openwallet.Errorf(code, "%s: %v", msg, err)
+}
+
 //CreateRawTransaction 创建交易单
 func (decoder *TransactionDecoder) CreateRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
-	if rawTx.Coin.IsContract {
-		return decoder.CreateBNBRawTransaction(wrapper, rawTx)
+	//非合约币种为主链币BNB
+	if rawTx.Coin.IsContract && len(rawTx.Coin.Contract.Address) == 0 {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "[%s] Miss contract details to create transaction!", rawTx.Account.AccountID)
 	}
-	return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "[%s] Miss contract details to create transaction!", rawTx.Account.AccountID)
+	return decoder.CreateBNBRawTransaction(wrapper, rawTx)
 }
 
 //SignRawTransaction 签名交易单
 func (decoder *TransactionDecoder) SignRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
-	if rawTx.Coin.IsContract {
-		return decoder.SignBNBRawTransaction(wrapper, rawTx)
+	if rawTx.Coin.IsContract && len(rawTx.Coin.Contract.Address) == 0 {
+		return openwallet.Errorf(openwallet.ErrSignRawTransactionFailed, "[%s] Miss contract details to sign transaction!", rawTx.Account.AccountID)
 	}
-	return openwallet.Errorf(openwallet.ErrSignRawTransactionFailed, "[%s] Miss contract details to sign transaction!", rawTx.Account.AccountID)
+	return decoder.SignBNBRawTransaction(wrapper, rawTx)
 }
 
 //VerifyRawTransaction 验证交易单，验证交易单并返回加入签名后的交易单
 func (decoder *TransactionDecoder) VerifyRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
-	if rawTx.Coin.IsContract {
-		return decoder.VerifyBNBRawTransaction(wrapper, rawTx)
+	if rawTx.Coin.IsContract && len(rawTx.Coin.Contract.Address) == 0 {
+		return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "[%s] Miss contract details to verify transaction!", rawTx.Account.AccountID)
 	}
-	return openwallet.Errorf(openwallet.ErrVerifyRawTransactionFailed, "[%s] Miss contract details to verify transaction!", rawTx.Account.AccountID)
+	return decoder.VerifyBNBRawTransaction(wrapper, rawTx)
 }
 
 func (decoder *TransactionDecoder) SubmitRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) (*openwallet.Transaction, error) {
@@ -80,7 +92,8 @@ func (decoder *TransactionDecoder) SubmitRawTransaction(wrapper openwallet.Walle
 	txid, err := decoder.wm.SendRawTransaction(rawTx.RawHex)
 	if err != nil {
 		fmt.Println("Tx to send: ", rawTx.RawHex)
-		return nil, err
+		//节点不可用时交易单可能已进入交易池，返回网络错误提示上层先确认交易状态，避免重复提交
+		return nil, nodeError(err, openwallet.ErrSubmitRawTransactionFailed, "[%s] Failed to submit transaction", rawTx.Account.AccountID)
 	} else {
 		txBytes, _ := hex.DecodeString(rawTx.RawHex)
 		trx, _ := binancechainTransaction.DecodeRawTransaction(txBytes)
@@ -88,7 +101,7 @@ func (decoder *TransactionDecoder) SubmitRawTransaction(wrapper openwallet.Walle
 
 		hash := trx.Signatures[0].Address().Bytes()
 
-		address := addressEncoder.AddressEncode(hash, addressEncoder.BNB_mainnetAddress)
+		address, _ := bech32.ConvertAndEncode(decoder.wm.addressPrefix(), hash)
 
 		wrapper.SetAddressExtParam(address, decoder.wm.FullName(), sequence)
 	}
@@ -96,13 +109,14 @@ func (decoder *TransactionDecoder) SubmitRawTransaction(wrapper openwallet.Walle
 	rawTx.TxID = txid
 	rawTx.IsSubmit = true
 
+	_, decimals := decoder.wm.coinAsset(rawTx.Coin)
 	tx := openwallet.Transaction{
 		From:       rawTx.TxFrom,
 		To:         rawTx.TxTo,
 		Amount:     rawTx.TxAmount,
 		Coin:       rawTx.Coin,
 		TxID:       rawTx.TxID,
-		Decimal:    int32(rawTx.Coin.Contract.Decimals),
+		Decimal:    int32(decimals),
 		AccountID:  rawTx.Account.AccountID,
 		Fees:       rawTx.Fees,
 		SubmitTime: time.Now().Unix(),
@@ -115,6 +129,19 @@ func (decoder *TransactionDecoder) SubmitRawTransaction(wrapper openwallet.Walle
 
 func (decoder *TransactionDecoder) CreateBNBRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
 
+	//节点所在网络与配置不一致时拒绝构建
+	if err := decoder.wm.verifyNetwork(context.Background()); err != nil {
+		return nodeError(err, openwallet.ErrCreateRawTransactionFailed, "[%s] Failed to check the node's network", rawTx.Account.AccountID)
+	}
+
+	//构建前拒绝无效的收款地址
+	for to := range rawTx.To {
+		if _, err := DecodeAddress(to, decoder.wm.addressPrefix()); err != nil {
+			return openwallet.Errorf(openwallet.ErrAdressDecodeFailed, "[%s] %v", rawTx.Account.AccountID, err)
+		}
+	}
+
+	denom, decimals := decoder.wm.coinAsset(rawTx.Coin)
 	addresses, err := wrapper.GetAddressList(0, -1, "AccountID", rawTx.Account.AccountID)
 
 	if err != nil {
@@ -127,24 +154,33 @@ func (decoder *TransactionDecoder) CreateBNBRawTransaction(wrapper openwallet.Wa
 
 	addressesBalanceList := make([]AddrBalance, 0, len(addresses))
 
-	for i, addr := range addresses {
-		balance, err := decoder.wm.RpcClient.getBalance(addr.Address, rawTx.Coin.Contract.Address)
-
-		if err != nil {
-			return err
-		}
+	//一次并发查询全部地址的所有币种余额
+	searchAddrs := make([]string, 0, len(addresses))
+	for _, addr := range addresses {
+		searchAddrs = append(searchAddrs, addr.Address)
+	}
+	infos, err := decoder.wm.GetAccounts(searchAddrs...)
+	if err != nil {
+		return nodeError(err, openwallet.ErrCreateRawTransactionFailed, "[%s] Failed to get balance of addresses", rawTx.Account.AccountID)
+	}
 
-		balance.index = i
-		addressesBalanceList = append(addressesBalanceList, *balance)
+	feeBalances := make(map[string]int64, len(infos))
+	for i, info := range infos {
+		feeBalances[info.Address] = info.Coin(Symbol).Free
+		addressesBalanceList = append(addressesBalanceList, AddrBalance{
+			Address: info.Address,
+			Balance: big.NewInt(info.Coin(denom).Free),
+			index:   i,
+		})
 	}
 
 	sort.Slice(addressesBalanceList, func(i int, j int) bool {
 		return addressesBalanceList[i].Balance.Cmp(addressesBalanceList[j].Balance) >= 0
 	})
 
-	fee, err := decoder.wm.RpcClient.getFeeByHeight(0)
+	fee, err := decoder.wm.getTransferFee()
 	if err != nil {
-		return openwallet.Errorf(openwallet.ErrUnknownException, "[%s] Failed to get current fee!", rawTx.Account.AccountID)
+		return nodeError(err, openwallet.ErrUnknownException, "[%s] Failed to get current fee!", rawTx.Account.AccountID)
 	}
 
 	var amountStr, to string
@@ -154,8 +190,8 @@ func (decoder *TransactionDecoder) CreateBNBRawTransaction(wrapper openwallet.Wa
 		break
 	}
 
-	amount := big.NewInt(int64(convertFromAmount(amountStr, rawTx.Coin.Contract.Decimals)))
-	if rawTx.Coin.Contract.Address == "BNB" {
+	amount := big.NewInt(int64(convertFromAmount(amountStr, decimals)))
+	if denom == Symbol {
 		amount = amount.Add(amount, big.NewInt(int64(fee)))
 	}
 
@@ -168,23 +204,17 @@ func (decoder *TransactionDecoder) CreateBNBRawTransaction(wrapper openwallet.Wa
 			count.Add(count, a.Balance)
 			if count.Cmp(amount) >= 0 {
 				countList = append(countList, a.Balance.Sub(a.Balance, count.Sub(count, amount)).Uint64())
-				log.Error("The " + rawTx.Coin.Contract.Address + " of the account is enough,"+
+				return openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAddress, "The "+denom+" of the account is enough,"+
 					" but cannot be sent in just one transaction!\n"+
-					"the amount can be sent in "+string(len(countList))+
-					"times with amounts :\n"+strings.Replace(strings.Trim(fmt.Sprint(countList), "[]"), " ", ",", -1), err)
-				return err
+					"the amount can be sent in "+strconv.Itoa(len(countList))+
+					" times with amounts :\n"+strings.Replace(strings.Trim(fmt.Sprint(countList), "[]"), " ", ",", -1))
 			} else {
 				countList = append(countList, a.Balance.Uint64())
 			}
 			continue
 		}
-		if rawTx.Coin.Contract.Address != "BNB" {
-			feeBalance, err := decoder.wm.RpcClient.getBalance(a.Address, "BNB")
-			if err != nil {
-				return openwallet.Errorf(openwallet.ErrUnknownException, "[%s] Failed to get BNB balance!", a.Address)
-			}
-
-			if feeBalance.Balance.Uint64() < fee {
+		if denom != Symbol {
+			if uint64(feeBalances[a.Address]) < fee {
 				avaliable = a.Address
 				continue
 			}
@@ -196,7 +226,7 @@ func (decoder *TransactionDecoder) CreateBNBRawTransaction(wrapper openwallet.Wa
 
 	if from == "" {
 		if avaliable != "" {
-			return openwallet.Errorf(openwallet.ErrInsufficientFees, "the " + rawTx.Coin.Contract.Address + " balance of address: %s is enough, but which has not enough BNB as fee!", avaliable)
+			return openwallet.Errorf(openwallet.ErrInsufficientFees, "the " + denom + " balance of address: %s is enough, but which has not enough BNB as fee!", avaliable)
 		}
 		return openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAccount, "the balance: %s is not enough", amountStr)
 	}
@@ -207,9 +237,9 @@ func (decoder *TransactionDecoder) CreateBNBRawTransaction(wrapper openwallet.Wa
 	rawTx.Fees = convertToAmount(fee, 8)
 	rawTx.FeeRate = convertToAmount(fee, 8)
 
-	accountNumber, sequenceChain, err := decoder.wm.RpcClient.getAccountNumberAndSequence(from)
+	accountNumber, sequenceChain, err := decoder.wm.getAccountNumberAndSequence(from)
 	if err != nil {
-		return openwallet.Errorf(openwallet.ErrUnknownException, "Failed to get account number and sequence of address: %s !!", from)
+		return nodeError(err, openwallet.ErrUnknownException, "Failed to get account number and sequence of address: %s !!", from)
 	}
 
 	var sequence uint64
@@ -228,7 +258,7 @@ func (decoder *TransactionDecoder) CreateBNBRawTransaction(wrapper openwallet.Wa
 		sequence = uint64(sequenceChain)
 	}
 	memo := rawTx.GetExtParam().Get("memo").String()
-	emptyTrans, hash, err := binancechainTransaction.CreateEmptyTransactionAndHash(from, to,rawTx.Coin.Contract.Address, int64(convertFromAmount(amountStr, rawTx.Coin.Contract.Decimals)), accountNumber, int64(sequence), tx.Source, memo)
+	emptyTrans, hash, err := createEmptyTransactionAndHash(decoder.wm.signChainID(), decoder.wm.addressPrefix(), from, to, denom, int64(convertFromAmount(amountStr, decimals)), accountNumber, int64(sequence), tx.Source, memo)
 	if err != nil {
 		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "Failed to create transaction : %s !!", rawTx.Account.AccountID)
 	}
@@ -264,6 +294,12 @@ func (decoder *TransactionDecoder) CreateBNBRawTransaction(wrapper openwallet.Wa
 }
 
 func (decoder *TransactionDecoder) SignBNBRawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
+
+	//节点所在网络与配置不一致时拒绝签名
+	if err := decoder.wm.verifyNetwork(context.Background()); err != nil {
+		return nodeError(err, openwallet.ErrSignRawTransactionFailed, "[%s] Failed to check the node's network", rawTx.Account.AccountID)
+	}
+
 	key, err := wrapper.HDKey()
 	if err != nil {
 		return nil
@@ -274,8 +310,7 @@ func (decoder *TransactionDecoder) SignBNBRawTransaction(wrapper openwallet.Wall
 	if keySignatures != nil {
 		for _, keySignature := range keySignatures {
 
-			childKey, err := key.DerivedKeyWithPath(keySignature.Address.HDPath, keySignature.EccType)
-			keyBytes, err := childKey.GetPrivateKeyBytes()
+			keyBytes, err := derivePrivateKey(key, keySignature.Address, keySignature.EccType)
 			if err != nil {
 				return err
 			}
@@ -328,7 +363,7 @@ func (decoder *TransactionDecoder) VerifyBNBRawTransaction(wrapper openwallet.Wa
 		}
 	}
 
-	pass, signedTrans := binancechainTransaction.VerifyAndCombineRawTransaction(emptyTrans, signature, pubkey)
+	pass, signedTrans := verifyAndCombineRawTransaction(decoder.wm.signChainID(), decoder.wm.addressPrefix(), emptyTrans, signature, pubkey)
 
 	if pass {
 		log.Debug("transaction verify passed")
@@ -343,7 +378,7 @@ func (decoder *TransactionDecoder) VerifyBNBRawTransaction(wrapper openwallet.Wa
 }
 
 func (decoder *TransactionDecoder) GetRawTransactionFeeRate() (feeRate string, unit string, err error) {
-	fee, err := decoder.wm.RpcClient.getFeeByHeight(0)
+	fee, err := decoder.wm.getTransferFee()
 	if err != nil {
 		return "", "", err
 	}
@@ -352,25 +387,36 @@ func (decoder *TransactionDecoder) GetRawTransactionFeeRate() (feeRate string, u
 
 //CreateSummaryRawTransaction 创建汇总交易，返回原始交易单数组
 func (decoder *TransactionDecoder) CreateSummaryRawTransaction(wrapper openwallet.WalletDAI, sumRawTx *openwallet.SummaryRawTransaction) ([]*openwallet.RawTransaction, error) {
-	if sumRawTx.Coin.IsContract {
-		return decoder.CreateTokenSummaryRawTransaction(wrapper, sumRawTx)
+	//非合约币种汇总主链币BNB
+	if sumRawTx.Coin.IsContract && len(sumRawTx.Coin.Contract.Address) == 0 {
+		return nil, openwallet.Errorf(openwallet.ErrSubmitRawTransactionFailed, "[%s] Miss contract details to summary!", sumRawTx.Account.AccountID)
 	}
-	return nil, openwallet.Errorf(openwallet.ErrSubmitRawTransactionFailed, "[%s] Miss contract details to summary!", sumRawTx.Account.AccountID)
+	return decoder.CreateTokenSummaryRawTransaction(wrapper, sumRawTx)
 }
 
 func (decoder *TransactionDecoder) CreateTokenSummaryRawTransaction(wrapper openwallet.WalletDAI, sumRawTx *openwallet.SummaryRawTransaction) ([]*openwallet.RawTransaction, error) {
 
+	denom, decimals := decoder.wm.coinAsset(sumRawTx.Coin)
 	var (
 		rawTxArray      = make([]*openwallet.RawTransaction, 0)
 		accountID       = sumRawTx.Account.AccountID
-		minTransfer     = big.NewInt(int64(convertFromAmount(sumRawTx.MinTransfer, sumRawTx.Coin.Contract.Decimals)))
-		retainedBalance = big.NewInt(int64(convertFromAmount(sumRawTx.RetainedBalance, sumRawTx.Coin.Contract.Decimals)))
+		minTransfer     = big.NewInt(int64(convertFromAmount(sumRawTx.MinTransfer, decimals)))
+		retainedBalance = big.NewInt(int64(convertFromAmount(sumRawTx.RetainedBalance, decimals)))
 	)
 
 	if minTransfer.Cmp(retainedBalance) < 0 {
 		return nil, fmt.Errorf("mini transfer amount must be greater than address retained balance")
 	}
 
+	//节点所在网络与配置不一致时拒绝汇总
+	if err := decoder.wm.verifyNetwork(context.Background()); err != nil {
+		return nil, nodeError(err, openwallet.ErrCreateRawTransactionFailed, "[%s] Failed to check the node's network", accountID)
+	}
+
+	if _, err := DecodeAddress(sumRawTx.SummaryAddress, decoder.wm.addressPrefix()); err != nil {
+		return nil, openwallet.Errorf(openwallet.ErrAdressDecodeFailed, "[%s] invalid summary address: %v", accountID, err)
+	}
+
 	//获取wallet
 	addresses, err := wrapper.GetAddressList(sumRawTx.AddressStartIndex, sumRawTx.AddressLimit,
 		"AccountID", sumRawTx.Account.AccountID)
@@ -386,13 +432,27 @@ func (decoder *TransactionDecoder) CreateTokenSummaryRawTransaction(wrapper open
 	addrBalanceArray := make([]*AddrBalance, 0)
 	for _, address := range addresses {
 		searchAddrs = append(searchAddrs, address.Address)
-		balance, err := decoder.wm.RpcClient.getBalance(address.Address, sumRawTx.Coin.Contract.Address)
-		if err != nil {
-			return nil, err
-		}
-		addrBalanceArray = append(addrBalanceArray, balance)
 	}
 
+	//一次并发查询全部地址的余额
+	infos, err := decoder.wm.GetAccounts(searchAddrs...)
+	if err != nil {
+		return nil, nodeError(err, openwallet.ErrCreateRawTransactionFailed, "[%s] Failed to get balance of addresses", accountID)
+	}
+	for _, info := range infos {
+		addrBalanceArray = append(addrBalanceArray, &AddrBalance{
+			Address: info.Address,
+			Balance: big.NewInt(info.Coin(denom).Free),
+		})
+	}
+
+	//计算手续费，汇总的每笔交易使用同一个手续费表
+	feeValue, err := decoder.wm.getTransferFee()
+	if err != nil {
+		return nil, nodeError(err, openwallet.ErrUnknownException, "[%s] Failed to get current fee!", sumRawTx.Account.AccountID)
+	}
+	fee := big.NewInt(int64(feeValue)) //(int64(decoder.wm.Config.FeeCharge))
+
 	for _, addrBalance := range addrBalanceArray {
 
 		//检查余额是否超过最低转账
@@ -406,16 +466,10 @@ func (decoder *TransactionDecoder) CreateTokenSummaryRawTransaction(wrapper open
 		sumAmount_BI.Sub(addrBalance_BI, retainedBalance)
 
 		//this.wm.Log.Debug("sumAmount:", sumAmount)
-		//计算手续费
-		feeValue, err := decoder.wm.RpcClient.getFeeByHeight(0)
-		if err != nil {
-			return nil, openwallet.Errorf(openwallet.ErrUnknownException, "[%s] Failed to get current fee!", sumRawTx.Account.AccountID)
-		}
-		fee := big.NewInt(int64(feeValue)) //(int64(decoder.wm.Config.FeeCharge))
 
 
 		//减去手续费
-		if sumRawTx.Coin.Contract.Address == "BNB" {
+		if denom == Symbol {
 			sumAmount_BI.Sub(sumAmount_BI, fee)
 			if sumAmount_BI.Cmp(big.NewInt(0)) <= 0 {
 				continue
@@ -423,10 +477,10 @@ func (decoder *TransactionDecoder) CreateTokenSummaryRawTransaction(wrapper open
 		}
 
 
-		sumAmount := convertToAmount(sumAmount_BI.Uint64(), sumRawTx.Coin.Contract.Decimals)
+		sumAmount := convertToAmount(sumAmount_BI.Uint64(), decimals)
 		fees := convertToAmount(fee.Uint64(), 8)
 
-		log.Debugf("balance: %v", convertToAmount(addrBalance.Balance.Uint64(), sumRawTx.Coin.Contract.Decimals))
+		log.Debugf("balance: %v", convertToAmount(addrBalance.Balance.Uint64(), decimals))
 		log.Debugf("fees: %v", fees)
 		log.Debugf("sumAmount: %v", sumAmount)
 
@@ -464,7 +518,8 @@ func (decoder *TransactionDecoder) createRawTransaction(wrapper openwallet.Walle
 		break
 	}
 
-	amount := convertFromAmount(amountStr, rawTx.Coin.Contract.Decimals)
+	denom, decimals := decoder.wm.coinAsset(rawTx.Coin)
+	amount := convertFromAmount(amountStr, decimals)
 	fromAddr, err := wrapper.GetAddress(from)
 	if err != nil {
 		return err
@@ -487,9 +542,9 @@ func (decoder *TransactionDecoder) createRawTransaction(wrapper openwallet.Walle
 	} else {
 		sequence = ow.NewString(sequence_db).UInt64()
 	}
-	accountNumber, sequenceChain, err := decoder.wm.RpcClient.getAccountNumberAndSequence(from)
+	accountNumber, sequenceChain, err := decoder.wm.getAccountNumberAndSequence(from)
 	if err != nil {
-		return err
+		return nodeError(err, openwallet.ErrCreateRawTransactionFailed, "Failed to get account number and sequence of address: %s", from)
 	}
 	if sequenceChain > int64(sequence) {
 		sequence = uint64(sequenceChain)
@@ -497,7 +552,7 @@ func (decoder *TransactionDecoder) createRawTransaction(wrapper openwallet.Walle
 	memo := rawTx.GetExtParam().Get("memo").String()
 
 
-	emptyTrans, hash, err := binancechainTransaction.CreateEmptyTransactionAndHash(from, to, rawTx.Coin.Contract.Address, int64(amount), accountNumber, int64(sequence), tx.Source, memo)
+	emptyTrans, hash, err := createEmptyTransactionAndHash(decoder.wm.signChainID(), decoder.wm.addressPrefix(), from, to, denom, int64(amount), accountNumber, int64(sequence), tx.Source, memo)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,279 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package binancechain
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blocktree/openwallet/log"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	defaultTxTrackInterval = 1 * time.Second //默认查询交易单上链状态的间隔
+	defaultTxTrackTimeout  = 2 * time.Minute //默认等待交易单上链的最长时间
+	txStatusKeepTime       = 1 * time.Hour   //已完成的跟踪结果保留时间
+)
+
+//交易单上链状态
+const (
+	TxStatusPending   = "pending"   //已通过CheckTx，等待上链
+	TxStatusCommitted = "committed" //已上链且DeliverTx成功
+	TxStatusFailed    = "failed"    //已上链但DeliverTx失败
+	TxStatusExpired   = "expired"   //超时仍未上链
+)
+
+//TxStatus 广播交易单的跟踪结果
+type TxStatus struct {
+	TxID       string    //交易单ID
+	Status     string    //上链状态
+	Height     uint64    //上链高度
+	Code       uint32    //DeliverTx返回码，0为成功
+	Log        string    //DeliverTx日志
+	SubmitTime time.Time //广播时间
+	UpdateTime time.Time //最近一次更新时间
+}
+
+//IsFinal 是否已得到最终结果
+func (s *TxStatus) IsFinal() bool {
+	return s.Status != TxStatusPending
+}
+
+//TxTracker 跟踪已广播的交易单，直到DeliverTx完成
+type TxTracker struct {
+	PollInterval time.Duration         //查询/tx的间隔
+	Timeout      time.Duration         //等待上链的最长时间
+	OnFinal      func(status TxStatus) //得到最终结果时回调
+
+	client   func() ChainBackend
+	mu       sync.Mutex
+	statuses map[string]*TxStatus
+	notify   map[string]chan TxStatus
+}
+
+//NewTxTracker 创建交易单跟踪器，client返回当前使用的数据源
+func NewTxTracker(client func() ChainBackend) *TxTracker {
+	return &TxTracker{
+		PollInterval: defaultTxTrackInterval,
+		Timeout:      defaultTxTrackTimeout,
+		client:       client,
+		statuses:     make(map[string]*TxStatus),
+		notify:       make(map[string]chan TxStatus),
+	}
+}
+
+//Track 开始跟踪交易单，已在跟踪中的交易单不会重复跟踪
+func (t *TxTracker) Track(txid string) {
+	txid = strings.ToUpper(txid)
+
+	t.mu.Lock()
+	t.cleanup()
+	if status, exist := t.statuses[txid]; exist && status.Status != TxStatusExpired {
+		t.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	t.statuses[txid] = &TxStatus{
+		TxID:       txid,
+		Status:     TxStatusPending,
+		SubmitTime: now,
+		UpdateTime: now,
+	}
+	ch := make(chan TxStatus, 1)
+	t.notify[txid] = ch
+	t.mu.Unlock()
+
+	go t.run(txid, ch)
+}
+
+//Status 查询交易单的跟踪结果
+func (t *TxTracker) Status(txid string) (TxStatus, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	status, exist := t.statuses[strings.ToUpper(txid)]
+	if !exist {
+		return TxStatus{}, false
+	}
+	return *status, true
+}
+
+//Pending 等待上链的交易单数量
+func (t *TxTracker) Pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.notify)
+}
+
+//onTxEvent 收到websocket推送的Tx事件，跟踪中的交易单直接得到结果
+func (t *TxTracker) onTxEvent(event *WSEvent) {
+	if event == nil || len(event.TxID) == 0 || event.Data == nil {
+		return
+	}
+
+	t.mu.Lock()
+	ch, exist := t.notify[event.TxID]
+	t.mu.Unlock()
+	if !exist {
+		return
+	}
+
+	result := event.Data.Get("value.TxResult.result")
+	status := TxStatus{
+		TxID:   event.TxID,
+		Height: event.Height,
+		Code:   uint32(result.Get("code").Uint()),
+		Log:    result.Get("log").String(),
+	}
+	select {
+	case ch <- status:
+	default:
+	}
+}
+
+//run 定时查询/tx直到交易单上链或超时
+func (t *TxTracker) run(txid string, ch chan TxStatus) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), t.Timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(t.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			t.finish(TxStatus{TxID: txid, Status: TxStatusExpired, Log: "transaction was not committed before timeout"})
+			return
+		case status := <-ch:
+			t.finish(status)
+			return
+		case <-ticker.C:
+			status, found := t.query(ctx, txid)
+			if found {
+				t.finish(status)
+				return
+			}
+		}
+	}
+}
+
+//query 查询交易单的DeliverTx结果
+func (t *TxTracker) query(ctx context.Context, txid string) (TxStatus, bool) {
+
+	c := t.client()
+	if c == nil {
+		return TxStatus{}, false
+	}
+
+	status, err := c.GetTxStatus(ctx, txid)
+	if err != nil {
+		if ErrorKind(err) != ErrTxNotFound && ctx.Err() == nil {
+			log.Std.Debug("track transaction [%s] failed; unexpected error: %v", txid, err)
+		}
+		return TxStatus{}, false
+	}
+
+	return status, true
+}
+
+//getTxStatusContext 通过/tx查询交易单的DeliverTx结果
+func (c *Client) getTxStatusContext(ctx context.Context, txid string) (TxStatus, error) {
+
+	/*
+		{
+			"jsonrpc": "2.0",
+			"id": "",
+			"result": {
+				"hash": "AB12...",
+				"height": "12345",
+				"index": 0,
+				"tx_result": {
+					"code": 0,
+					"log": "Msg 0: ",
+					"data": "..."
+				},
+				"tx": "..."
+			}
+		}
+	*/
+
+	resp, err := c.CallContext(ctx, "/tx?hash=0x"+txid, nil, "GET")
+	if err != nil {
+		return TxStatus{}, err
+	}
+
+	return newTxStatus(txid, resp.Get("result")), nil
+}
+
+//newTxStatus 根据/tx的返回结果生成跟踪结果
+func newTxStatus(txid string, result gjson.Result) TxStatus {
+	return TxStatus{
+		TxID:   txid,
+		Height: result.Get("height").Uint(),
+		Code:   uint32(result.Get("tx_result.code").Uint()),
+		Log:    result.Get("tx_result.log").String(),
+	}
+}
+
+//finish 保存最终结果并回调
+func (t *TxTracker) finish(result TxStatus) {
+
+	if len(result.Status) == 0 {
+		if result.Code == 0 {
+			result.Status = TxStatusCommitted
+		} else {
+			result.Status = TxStatusFailed
+		}
+	}
+
+	t.mu.Lock()
+	status, exist := t.statuses[result.TxID]
+	if !exist {
+		status = &TxStatus{TxID: result.TxID}
+		t.statuses[result.TxID] = status
+	}
+	status.Status = result.Status
+	status.Height = result.Height
+	status.Code = result.Code
+	status.Log = result.Log
+	status.UpdateTime = time.Now()
+	final := *status
+	delete(t.notify, result.TxID)
+	t.mu.Unlock()
+
+	switch final.Status {
+	case TxStatusCommitted:
+		log.Std.Info("transaction [%s] committed on height: %d", final.TxID, final.Height)
+	default:
+		log.Std.Warning("transaction [%s] %s on height: %d, code: %d, log: %s", final.TxID, final.Status, final.Height, final.Code, final.Log)
+	}
+
+	if t.OnFinal != nil {
+		t.OnFinal(final)
+	}
+}
+
+//cleanup 清理过期的跟踪结果，调用方需持有锁
+func (t *TxTracker) cleanup() {
+	for txid, status := range t.statuses {
+		if status.IsFinal() && time.Since(status.UpdateTime) > txStatusKeepTime {
+			delete(t.statuses, txid)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package binancechain
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_txTrackerDeliverTx(t *testing.T) {
+	var queries int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&queries, 1) < 3 {
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":"","error":{"code":-32603,"message":"Internal error","data":"Tx (ABCD) not found"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":"","result":{"hash":"ABCD","height":"120","tx_result":{"code":65541,"log":"insufficient fund"}}}`)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, false)
+	c.SetRetry(0, time.Millisecond)
+
+	final := make(chan TxStatus, 1)
+	tracker := NewTxTracker(func() ChainBackend { return c })
+	tracker.PollInterval = 10 * time.Millisecond
+	tracker.OnFinal = func(status TxStatus) {
+		final <- status
+	}
+
+	tracker.Track("abcd")
+	if status, _ := tracker.Status("ABCD"); status.Status != TxStatusPending {
+		t.Errorf("expected pending status, got: %+v", status)
+	}
+
+	select {
+	case status := <-final:
+		if status.Status != TxStatusFailed || status.Height != 120 || status.Code != 65541 || status.Log != "insufficient fund" {
+			t.Errorf("unexpected final status: %+v", status)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("timeout waiting DeliverTx result")
+	}
+
+	if tracker.Pending() != 0 {
+		t.Errorf("expected no pending transaction")
+	}
+}
+
+func Test_txTrackerExpired(t *testing.T) {
+	tracker := NewTxTracker(func() ChainBackend { return nil })
+	tracker.PollInterval = 10 * time.Millisecond
+	tracker.Timeout = 50 * time.Millisecond
+
+	final := make(chan TxStatus, 1)
+	tracker.OnFinal = func(status TxStatus) {
+		final <- status
+	}
+	tracker.Track("EF01")
+
+	select {
+	case status := <-final:
+		if status.Status != TxStatusExpired {
+			t.Errorf("expected expired status, got: %+v", status)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("timeout waiting expired result")
+	}
+}
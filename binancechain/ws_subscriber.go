@@ -0,0 +1,273 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package binancechain
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	defaultWSReconnectInterval = 5 * time.Second  //默认断线重连间隔
+	wsReadTimeout              = 90 * time.Second //长时间没有收到任何消息视为断线
+	wsWriteTimeout             = 10 * time.Second //发送消息超时时间
+)
+
+//Tendermint事件订阅条件
+const (
+	QueryNewBlock = "tm.event='NewBlock'"
+	QueryTx       = "tm.event='Tx'"
+)
+
+//WSEvent Tendermint websocket推送的事件
+type WSEvent struct {
+	Query  string        //订阅条件
+	Height uint64        //事件所在区块高度
+	TxID   string        //Tx事件的交易单ID
+	Data   *gjson.Result //事件原始数据
+}
+
+//wsSubscriber Tendermint /websocket 事件订阅客户端，断线后自动重连并重新订阅
+type wsSubscriber struct {
+	URL               string
+	Queries           []string
+	ReconnectInterval time.Duration
+	OnEvent           func(event *WSEvent)
+	OnConnected       func()
+	OnDisconnected    func(err error)
+	Dialer            *websocket.Dialer                         //拨号器，为空时使用websocket.DefaultDialer
+	Header            http.Header                               //连接时附加的请求头，如认证信息
+	Resolve           func(ctx context.Context) (string, error) //每次连接前重新选择节点RPC地址，为空时一直使用URL
+
+	mu        sync.Mutex
+	connected bool
+}
+
+//newWSSubscriber 根据节点RPC地址创建订阅客户端
+func newWSSubscriber(rpcURL string, queries ...string) (*wsSubscriber, error) {
+	wsURL, err := websocketURL(rpcURL)
+	if err != nil {
+		return nil, err
+	}
+	return &wsSubscriber{
+		URL:               wsURL,
+		Queries:           queries,
+		ReconnectInterval: defaultWSReconnectInterval,
+	}, nil
+}
+
+//websocketURL 把节点RPC地址转为Tendermint websocket地址
+func websocketURL(rpcURL string) (string, error) {
+	u, err := url.Parse(rpcURL)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "http", "ws", "":
+		u.Scheme = "ws"
+	case "https", "wss":
+		u.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("unsupported websocket scheme: %s", u.Scheme)
+	}
+	if len(u.Host) == 0 {
+		return "", fmt.Errorf("invalid rpc url: %s", rpcURL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/websocket"
+	u.RawQuery = ""
+	return u.String(), nil
+}
+
+//IsConnected 是否已连接并完成订阅
+func (s *wsSubscriber) IsConnected() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connected
+}
+
+//Run 连接节点并订阅事件，断线后按ReconnectInterval重连，直到ctx取消
+func (s *wsSubscriber) Run(ctx context.Context) {
+	for {
+		err := s.serve(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if s.OnDisconnected != nil {
+			s.OnDisconnected(err)
+		}
+
+		interval := s.ReconnectInterval
+		if interval <= 0 {
+			interval = defaultWSReconnectInterval
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+//serve 建立一次连接，订阅全部事件并持续读取，连接断开时返回
+func (s *wsSubscriber) serve(ctx context.Context) error {
+
+	if s.Resolve != nil {
+		rpcURL, err := s.Resolve(ctx)
+		if err != nil {
+			return err
+		}
+		wsURL, err := websocketURL(rpcURL)
+		if err != nil {
+			return err
+		}
+		s.URL = wsURL
+	}
+
+	dialer := s.Dialer
+	if dialer == nil {
+		dialer = websocket.DefaultDialer
+	}
+	conn, _, err := dialer.DialContext(ctx, s.URL, s.Header)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		s.mu.Lock()
+		s.connected = false
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	//ctx取消时关闭连接，结束读取
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	for i, query := range s.Queries {
+		if err := s.subscribe(conn, i, query); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	s.connected = true
+	s.mu.Unlock()
+
+	if s.OnConnected != nil {
+		s.OnConnected()
+	}
+
+	conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+	conn.SetPingHandler(func(data string) error {
+		conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(wsWriteTimeout))
+	})
+
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+
+		resp := gjson.ParseBytes(msg)
+		if resp.Get("error").IsObject() {
+			return newRPCError(http.StatusOK, msg)
+		}
+
+		event := parseWSEvent(&resp)
+		if event != nil && s.OnEvent != nil {
+			s.OnEvent(event)
+		}
+	}
+}
+
+//subscribe 发送订阅请求
+func (s *wsSubscriber) subscribe(conn *websocket.Conn, id int, query string) error {
+	request := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      fmt.Sprintf("subscribe#%d", id),
+		"method":  "subscribe",
+		"params":  map[string]interface{}{"query": query},
+	}
+	conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return conn.WriteJSON(request)
+}
+
+//parseWSEvent 解析推送的事件，订阅确认等其他消息返回nil
+func parseWSEvent(resp *gjson.Result) *WSEvent {
+
+	/*
+		{
+			"jsonrpc": "2.0",
+			"id": "subscribe#0#event",
+			"result": {
+				"query": "tm.event='NewBlock'",
+				"data": {
+					"type": "tendermint/event/NewBlock",
+					"value": {
+						"block": {
+							"header": {
+								"height": "12345"
+							}
+						}
+					}
+				}
+			}
+		}
+	*/
+
+	data := resp.Get("result.data")
+	if !data.Exists() {
+		return nil
+	}
+
+	event := WSEvent{
+		Query: resp.Get("result.query").String(),
+		Data:  &data,
+	}
+
+	switch data.Get("type").String() {
+	case "tendermint/event/NewBlock":
+		event.Height = data.Get("value.block.header.height").Uint()
+	case "tendermint/event/Tx":
+		event.Height = data.Get("value.TxResult.height").Uint()
+		txBytes, err := base64.StdEncoding.DecodeString(data.Get("value.TxResult.tx").String())
+		if err == nil && len(txBytes) > 0 {
+			event.TxID = txHash(txBytes)
+		}
+	default:
+		return nil
+	}
+
+	return &event
+}
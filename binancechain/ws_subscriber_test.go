@@ -0,0 +1,161 @@
+package binancechain
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/tidwall/gjson"
+)
+
+func Test_websocketURL(t *testing.T) {
+	tests := map[string]string{
+		"http://127.0.0.1:27147":   "ws://127.0.0.1:27147/websocket",
+		"https://dataseed1.org/":   "wss://dataseed1.org/websocket",
+		"http://127.0.0.1/rpc?x=1": "ws://127.0.0.1/rpc/websocket",
+	}
+	for rpcURL, expected := range tests {
+		wsURL, err := websocketURL(rpcURL)
+		if err != nil || wsURL != expected {
+			t.Errorf("websocketURL(%s) = %s, %v; expected %s", rpcURL, wsURL, err, expected)
+		}
+	}
+}
+
+func Test_wsSubscriberReconnect(t *testing.T) {
+	var (
+		mu         sync.Mutex
+		subscribes []string
+		conns      = 0
+	)
+
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		mu.Lock()
+		conns++
+		first := conns == 1
+		mu.Unlock()
+
+		for i := 0; i < 2; i++ {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			subscribes = append(subscribes, gjson.GetBytes(msg, "params.query").String())
+			mu.Unlock()
+		}
+
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":"subscribe#0","result":{}}`))
+		if first {
+			//第一次连接推送区块后断开，客户端应重连并重新订阅
+			conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":"subscribe#0#event","result":{"query":"tm.event='NewBlock'","data":{"type":"tendermint/event/NewBlock","value":{"block":{"header":{"height":"100"}}}}}}`))
+			return
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":"subscribe#1#event","result":{"query":"tm.event='Tx'","data":{"type":"tendermint/event/Tx","value":{"TxResult":{"height":"101","tx":"AQID"}}}}}`))
+		conn.ReadMessage()
+	}))
+	defer server.Close()
+
+	ws, err := newWSSubscriber(server.URL, QueryNewBlock, QueryTx)
+	if err != nil {
+		t.Fatalf("newWSSubscriber failed unexpected error: %v", err)
+	}
+	ws.ReconnectInterval = 10 * time.Millisecond
+
+	events := make(chan *WSEvent, 2)
+	ws.OnEvent = func(event *WSEvent) {
+		events <- event
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ws.Run(ctx)
+
+	var received []*WSEvent
+	for len(received) < 2 {
+		select {
+		case event := <-events:
+			received = append(received, event)
+		case <-time.After(3 * time.Second):
+			t.Fatalf("timeout waiting websocket events, received %d", len(received))
+		}
+	}
+
+	if received[0].Height != 100 || received[0].Query != QueryNewBlock {
+		t.Errorf("unexpected NewBlock event: %+v", received[0])
+	}
+	if received[1].Height != 101 || !strings.HasPrefix(received[1].TxID, "039058C6F2C0CB49") {
+		t.Errorf("unexpected Tx event: %+v", received[1])
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if conns != 2 || len(subscribes) != 4 || subscribes[2] != QueryNewBlock || subscribes[3] != QueryTx {
+		t.Errorf("expected resubscription after reconnect, got %d connections, subscribes: %v", conns, subscribes)
+	}
+}
+
+func Test_wsSubscriberResolve(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	upgrader := websocket.Upgrader{}
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.ReadMessage()
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":"subscribe#0#event","result":{"query":"tm.event='NewBlock'","data":{"type":"tendermint/event/NewBlock","value":{"block":{"header":{"height":"100"}}}}}}`))
+		conn.ReadMessage()
+	}))
+	defer up.Close()
+
+	ws, _ := newWSSubscriber(down.URL, QueryNewBlock)
+	ws.ReconnectInterval = 10 * time.Millisecond
+
+	//每次重连重新选择节点，第一个节点不可用时切换到第二个
+	var resolved int32
+	ws.Resolve = func(ctx context.Context) (string, error) {
+		if atomic.AddInt32(&resolved, 1) == 1 {
+			return down.URL, nil
+		}
+		return up.URL, nil
+	}
+	events := make(chan *WSEvent, 1)
+	ws.OnEvent = func(event *WSEvent) {
+		events <- event
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ws.Run(ctx)
+
+	select {
+	case event := <-events:
+		if event.Height != 100 {
+			t.Errorf("unexpected event: %+v", event)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("timeout waiting event from the second node")
+	}
+	if n := atomic.LoadInt32(&resolved); n != 2 {
+		t.Errorf("resolved %d times, expected 2", n)
+	}
+}
@@ -0,0 +1,1073 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+//Package binancechaintest 进程内的模拟Binance Chain节点，用内存中的链状态提供Tendermint RPC，
+//测试可以铸造账户余额、提交amino编码的交易单、出块，并模拟分叉和节点错误
+package binancechaintest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/binance-chain/go-sdk/common/bech32"
+	"github.com/binance-chain/go-sdk/common/types"
+	sdk "github.com/binance-chain/go-sdk/types"
+	"github.com/binance-chain/go-sdk/types/msg"
+	"github.com/binance-chain/go-sdk/types/tx"
+	"github.com/tendermint/tendermint/crypto"
+)
+
+const (
+	DefaultChainID = "Binance-Chain-Tigris" //默认链ID，与主网一致
+
+	mainnetAddressPrefix = "bnb"  //主网地址的bech32前缀
+	testnetAddressPrefix = "tbnb" //其它链ID使用测试网地址前缀
+
+	accountKeyPrefix  = "account:" ///store/acc/key的键前缀
+	defaultTxsLimit   = 30         ///unconfirmed_txs和/tx_search默认返回数量
+	maxPerPage        = 100        ///tx_search单页最大数量
+	rpcInternalError  = -32603     //JSON-RPC内部错误码
+	rpcMethodNotFound = -32601     //JSON-RPC方法不存在错误码
+)
+
+//DeliverTx和CheckTx的结果码，与链上root codespace的结果码一致
+const (
+	CodeOK                uint32 = 0
+	CodeTxDecode          uint32 = 65538
+	CodeInvalidSequence   uint32 = 65539
+	CodeUnauthorized      uint32 = 65540
+	CodeInsufficientFunds uint32 = 65541
+	CodeUnknownRequest    uint32 = 65542
+	CodeUnknownAddress    uint32 = 65545
+	CodeInsufficientCoins uint32 = 65546
+	CodeInvalidCoins      uint32 = 65547
+)
+
+//DefaultFees 默认手续费参数，与主网的转账手续费一致
+func DefaultFees() []types.FeeParam {
+	return []types.FeeParam{
+		&types.FixedFeeParams{MsgType: "submit_proposal", Fee: 1000000000, FeeFor: types.FeeForProposer},
+		&types.TransferFeeParam{
+			FixedFeeParams:    types.FixedFeeParams{MsgType: "send", Fee: 37500, FeeFor: types.FeeForProposer},
+			MultiTransferFee:  30000,
+			LowerLimitAsMulti: 2,
+		},
+		&types.DexFeeParam{DexFeeFields: []types.DexFeeField{{FeeName: "ExpireFee", FeeValue: 25000}}},
+	}
+}
+
+//NativeToken 链上原生代币BNB
+func NativeToken() types.Token {
+	return types.Token{
+		Name:        "Binance Chain Native Token",
+		Symbol:      "BNB",
+		OrigSymbol:  "BNB",
+		TotalSupply: 20000000000000000,
+		Mintable:    false,
+	}
+}
+
+//cdc 账户和手续费参数的编解码器
+var cdc = sdk.NewCodec()
+
+//chainState 账户状态，出块时修改deliver状态，CheckTx修改check状态
+type chainState struct {
+	accounts   map[string]*types.AppAccount //按地址字节保存
+	nextNumber int64                        //下一个新账户的账户号
+}
+
+func newChainState() *chainState {
+	return &chainState{accounts: make(map[string]*types.AppAccount)}
+}
+
+func (st *chainState) clone() *chainState {
+	obj := &chainState{
+		accounts:   make(map[string]*types.AppAccount, len(st.accounts)),
+		nextNumber: st.nextNumber,
+	}
+	for key, acc := range st.accounts {
+		obj.accounts[key] = acc.Clone().(*types.AppAccount)
+	}
+	return obj
+}
+
+//account 查找账户，create为true时不存在则创建
+func (st *chainState) account(addr types.AccAddress, create bool) *types.AppAccount {
+	acc := st.accounts[string(addr)]
+	if acc == nil && create {
+		acc = &types.AppAccount{BaseAccount: types.BaseAccount{Address: addr, AccountNumber: st.nextNumber}}
+		st.nextNumber++
+		st.accounts[string(addr)] = acc
+	}
+	return acc
+}
+
+//mockBlock 已产生的区块
+type mockBlock struct {
+	height   int64
+	hash     []byte
+	prevHash []byte
+	time     time.Time
+	txs      [][]byte
+}
+
+//txResult 已上链交易单的DeliverTx结果
+type txResult struct {
+	height int64
+	index  int
+	code   uint32
+	log    string
+	tx     []byte
+	tags   map[string][]types.AccAddress //成功的转账按sender和recipient索引
+}
+
+//failure 注入的节点错误
+type failure struct {
+	times   int
+	status  int
+	message string
+}
+
+//rpcError JSON-RPC错误
+type rpcError struct {
+	code    int
+	message string
+	data    string
+}
+
+//Node 模拟节点，创建后即开始监听，测试结束时调用Close
+type Node struct {
+	mu         sync.Mutex
+	chainID    string
+	server     *httptest.Server
+	deliver    *chainState
+	check      *chainState
+	snapshots  map[int64]*chainState //每个高度出块后的状态，用于按高度查询和回滚
+	fees       []types.FeeParam
+	tokens     []types.Token //已发行的代币，按发行顺序
+	mempool    [][]byte
+	cache      map[string]bool //已进入内存池的交易单，重复提交时报错
+	blocks     []*mockBlock
+	results    map[string]*txResult
+	forks      int  //分叉次数，分叉后的区块hash与原区块不同
+	catchingUp bool //是否报告正在追赶区块
+	failures   map[string]*failure
+}
+
+//NewNode 创建并启动模拟节点，chainID为空时使用DefaultChainID
+func NewNode(chainID string) *Node {
+	if len(chainID) == 0 {
+		chainID = DefaultChainID
+	}
+	n := &Node{
+		chainID:   chainID,
+		deliver:   newChainState(),
+		snapshots: make(map[int64]*chainState),
+		fees:      DefaultFees(),
+		tokens:    []types.Token{NativeToken()},
+		cache:     make(map[string]bool),
+		results:   make(map[string]*txResult),
+		failures:  make(map[string]*failure),
+	}
+	n.check = n.deliver.clone()
+	n.snapshots[0] = n.deliver.clone()
+	n.server = httptest.NewServer(n)
+	return n
+}
+
+//URL 节点地址
+func (n *Node) URL() string {
+	return n.server.URL
+}
+
+//Close 停止监听
+func (n *Node) Close() {
+	n.server.Close()
+}
+
+//ChainID 链ID
+func (n *Node) ChainID() string {
+	return n.chainID
+}
+
+//Height 最新区块高度
+func (n *Node) Height() int64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return int64(len(n.blocks))
+}
+
+//BlockHash 指定高度的区块hash，区块不存在时返回空
+func (n *Node) BlockHash(height int64) string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if height <= 0 || height > int64(len(n.blocks)) {
+		return ""
+	}
+	return fmt.Sprintf("%X", n.blocks[height-1].hash)
+}
+
+//Account 最新的账户状态，账户不存在时返回nil
+func (n *Node) Account(address string) *types.AppAccount {
+	_, addr, err := bech32.DecodeAndConvert(address)
+	if err != nil {
+		return nil
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	acc := n.deliver.account(addr, false)
+	if acc == nil {
+		return nil
+	}
+	return acc.Clone().(*types.AppAccount)
+}
+
+//Mint 给地址增加余额，账户不存在时创建，立即在最新高度生效
+func (n *Node) Mint(address string, coins types.Coins) error {
+	_, addr, err := bech32.DecodeAndConvert(address)
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	number := n.deliver.account(addr, true).AccountNumber
+	for _, st := range []*chainState{n.deliver, n.check, n.snapshots[int64(len(n.blocks))]} {
+		acc := st.account(addr, false)
+		if acc == nil {
+			//新账户的账户号以deliver状态为准
+			acc = &types.AppAccount{BaseAccount: types.BaseAccount{Address: addr, AccountNumber: number}}
+			st.accounts[string(addr)] = acc
+			if st.nextNumber <= number {
+				st.nextNumber = number + 1
+			}
+		}
+		for _, coin := range coins {
+			acc.Coins = addCoin(acc.Coins, coin.Denom, coin.Amount)
+		}
+	}
+	return nil
+}
+
+//SetFees 修改手续费参数，对之后的交易单和查询生效
+func (n *Node) SetFees(params []types.FeeParam) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.fees = params
+}
+
+//AddToken 发行代币，已存在的代币被覆盖
+func (n *Node) AddToken(token types.Token) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for i := range n.tokens {
+		if n.tokens[i].Symbol == token.Symbol {
+			n.tokens[i] = token
+			return
+		}
+	}
+	n.tokens = append(n.tokens, token)
+}
+
+//Submit 以CheckTx检查amino编码的交易单，通过后进入内存池，返回结果码、日志和交易单hash
+func (n *Node) Submit(txBytes []byte) (uint32, string, string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	code, log, err := n.checkTx(txBytes)
+	if err != nil {
+		return CodeUnknownRequest, err.Error(), TxHash(txBytes)
+	}
+	return code, log, TxHash(txBytes)
+}
+
+//checkTx 检查交易单并加入内存池，重复提交时返回错误
+func (n *Node) checkTx(txBytes []byte) (uint32, string, error) {
+	txid := TxHash(txBytes)
+	if n.cache[txid] {
+		return 0, "", errors.New("Tx already exists in cache")
+	}
+	code, log := n.applyTx(n.check, txBytes)
+	if code != CodeOK {
+		return code, log, nil
+	}
+	n.cache[txid] = true
+	n.mempool = append(n.mempool, txBytes)
+	return code, log, nil
+}
+
+//ProduceBlock 把内存池中的全部交易单打包出块，返回新区块高度。
+//DeliverTx失败的交易单仍然上链，结果码记录在/tx中
+func (n *Node) ProduceBlock() int64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.produceBlock()
+}
+
+func (n *Node) produceBlock() int64 {
+
+	block := &mockBlock{
+		height: int64(len(n.blocks)) + 1,
+		time:   time.Now().UTC(),
+		txs:    n.mempool,
+	}
+	if len(n.blocks) > 0 {
+		block.prevHash = n.blocks[len(n.blocks)-1].hash
+	}
+
+	hasher := sha256.New()
+	fmt.Fprintf(hasher, "%s/%d/%X/%d", n.chainID, block.height, block.prevHash, n.forks)
+	for i, txBytes := range block.txs {
+		code, log := n.applyTx(n.deliver, txBytes)
+		result := &txResult{height: block.height, index: i, code: code, log: log, tx: txBytes}
+		if code == CodeOK {
+			result.tags = transferTags(txBytes)
+		}
+		n.results[TxHash(txBytes)] = result
+		hasher.Write(txBytes)
+	}
+	block.hash = hasher.Sum(nil)
+
+	n.blocks = append(n.blocks, block)
+	n.snapshots[block.height] = n.deliver.clone()
+	n.check = n.deliver.clone()
+	n.mempool = nil
+
+	return block.height
+}
+
+//Fork 回滚到指定高度，之后产生的区块hash与回滚前不同。
+//被回滚区块中的交易单和内存池中的交易单被丢弃
+func (n *Node) Fork(height int64) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if height < 0 || height >= int64(len(n.blocks)) {
+		return fmt.Errorf("fork height %d must be less than current height %d", height, len(n.blocks))
+	}
+
+	for _, block := range n.blocks[height:] {
+		for _, txBytes := range block.txs {
+			delete(n.results, TxHash(txBytes))
+			delete(n.cache, TxHash(txBytes))
+		}
+		delete(n.snapshots, block.height)
+	}
+	for _, txBytes := range n.mempool {
+		delete(n.cache, TxHash(txBytes))
+	}
+
+	n.blocks = n.blocks[:height]
+	n.deliver = n.snapshots[height].clone()
+	n.check = n.deliver.clone()
+	n.mempool = nil
+	n.forks++
+
+	return nil
+}
+
+//SetCatchingUp 设置/status报告的catching_up
+func (n *Node) SetCatchingUp(catchingUp bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.catchingUp = catchingUp
+}
+
+//ShiftTime 已产生的区块时间全部提前d，模拟链或节点停止出块
+func (n *Node) ShiftTime(d time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, block := range n.blocks {
+		block.time = block.time.Add(-d)
+	}
+}
+
+//FailHTTP 之后times次调用method时返回HTTP状态码status，method为RPC方法名，如block、broadcast_tx_sync
+func (n *Node) FailHTTP(method string, times int, status int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.failures[method] = &failure{times: times, status: status}
+}
+
+//FailRPC 之后times次调用method时返回JSON-RPC内部错误，data为错误详情
+func (n *Node) FailRPC(method string, times int, data string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.failures[method] = &failure{times: times, message: data}
+}
+
+//takeFailure 取出一次注入的错误
+func (n *Node) takeFailure(method string) *failure {
+	f := n.failures[method]
+	if f == nil || f.times <= 0 {
+		return nil
+	}
+	f.times--
+	return f
+}
+
+//transferFee 转账手续费，outputs为全部输出的币种数量之和
+func (n *Node) transferFee(outputs int) int64 {
+	for _, param := range n.fees {
+		p, ok := param.(*types.TransferFeeParam)
+		if !ok {
+			continue
+		}
+		if outputs > 1 && p.LowerLimitAsMulti > 0 && int64(outputs) >= p.LowerLimitAsMulti {
+			return p.MultiTransferFee * int64(outputs)
+		}
+		return p.Fee
+	}
+	return 0
+}
+
+//applyTx 在st上执行转账交易单，签名、账户号和序号必须与st一致
+func (n *Node) applyTx(st *chainState, txBytes []byte) (uint32, string) {
+
+	var stdTx tx.StdTx
+	if err := tx.Cdc.UnmarshalBinaryLengthPrefixed(txBytes, &stdTx); err != nil {
+		return CodeTxDecode, err.Error()
+	}
+	if len(stdTx.Msgs) != 1 {
+		return CodeUnknownRequest, "only one message is supported"
+	}
+
+	var sendMsg msg.SendMsg
+	switch m := stdTx.Msgs[0].(type) {
+	case msg.SendMsg:
+		sendMsg = m
+	case *msg.SendMsg:
+		sendMsg = *m
+	default:
+		return CodeUnknownRequest, "unsupported message type: " + stdTx.Msgs[0].Type()
+	}
+	if err := sendMsg.ValidateBasic(); err != nil {
+		return CodeInvalidCoins, err.Error()
+	}
+	if len(stdTx.Signatures) != len(sendMsg.Inputs) {
+		return CodeUnauthorized, fmt.Sprintf("wrong number of signers; expected %d, got %d", len(sendMsg.Inputs), len(stdTx.Signatures))
+	}
+
+	outputs := 0
+	for _, output := range sendMsg.Outputs {
+		outputs += len(output.Coins)
+	}
+	fee := n.transferFee(outputs)
+
+	for i, input := range sendMsg.Inputs {
+		acc := st.account(input.Address, false)
+		if acc == nil {
+			return CodeUnknownAddress, fmt.Sprintf("account %s does not exist", input.Address)
+		}
+		sig := stdTx.Signatures[i]
+		if sig.PubKey == nil || !bytes.Equal(sig.PubKey.Address(), input.Address) {
+			return CodeUnauthorized, "signer does not match input address"
+		}
+		if sig.AccountNumber != acc.AccountNumber {
+			return CodeUnauthorized, fmt.Sprintf("Invalid account number. Got %d, expected %d", sig.AccountNumber, acc.AccountNumber)
+		}
+		if sig.Sequence != acc.Sequence {
+			return CodeInvalidSequence, fmt.Sprintf("Invalid sequence. Got %d, expected %d", sig.Sequence, acc.Sequence)
+		}
+		signBytes := stdSignBytes(n.chainID, sig.AccountNumber, sig.Sequence, stdTx.Msgs, stdTx.Memo, stdTx.Source, stdTx.Data)
+		if !sig.PubKey.VerifyBytes(signBytes, sig.Signature) {
+			return CodeUnauthorized, "signature verification failed"
+		}
+		if i == 0 && acc.Coins.AmountOf("BNB") < fee {
+			return CodeInsufficientFunds, fmt.Sprintf("insufficient fee; got %d BNB, required %d", acc.Coins.AmountOf("BNB"), fee)
+		}
+		for _, coin := range input.Coins {
+			need := coin.Amount
+			if i == 0 && coin.Denom == "BNB" {
+				need += fee
+			}
+			if acc.Coins.AmountOf(coin.Denom) < need {
+				return CodeInsufficientCoins, fmt.Sprintf("%d%s is less than %d%s", acc.Coins.AmountOf(coin.Denom), coin.Denom, need, coin.Denom)
+			}
+		}
+	}
+
+	for i, input := range sendMsg.Inputs {
+		acc := st.account(input.Address, false)
+		for _, coin := range input.Coins {
+			acc.Coins = addCoin(acc.Coins, coin.Denom, -coin.Amount)
+		}
+		if i == 0 {
+			acc.Coins = addCoin(acc.Coins, "BNB", -fee)
+		}
+		if acc.PubKey == nil {
+			acc.PubKey = stdTx.Signatures[i].PubKey
+		}
+		acc.Sequence++
+	}
+	for _, output := range sendMsg.Outputs {
+		acc := st.account(output.Address, true)
+		for _, coin := range output.Coins {
+			acc.Coins = addCoin(acc.Coins, coin.Denom, coin.Amount)
+		}
+	}
+
+	return CodeOK, "Msg 0: "
+}
+
+//addCoin 修改一种币的余额，余额为0时移除，结果按Denom排序
+func addCoin(coins types.Coins, denom string, delta int64) types.Coins {
+	result := make(types.Coins, 0, len(coins)+1)
+	found := false
+	for _, coin := range coins {
+		if coin.Denom == denom {
+			coin.Amount += delta
+			found = true
+		}
+		if coin.Amount != 0 {
+			result = append(result, coin)
+		}
+	}
+	if !found && delta != 0 {
+		result = append(result, types.Coin{Denom: denom, Amount: delta})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Denom < result[j].Denom })
+	return result
+}
+
+//transferTags 转账交易单的sender和recipient索引
+func transferTags(txBytes []byte) map[string][]types.AccAddress {
+	tags := make(map[string][]types.AccAddress)
+	var stdTx tx.StdTx
+	if err := tx.Cdc.UnmarshalBinaryLengthPrefixed(txBytes, &stdTx); err != nil {
+		return tags
+	}
+	for _, m := range stdTx.Msgs {
+		sendMsg, ok := m.(msg.SendMsg)
+		if !ok {
+			continue
+		}
+		for _, input := range sendMsg.Inputs {
+			tags["sender"] = append(tags["sender"], input.Address)
+		}
+		for _, output := range sendMsg.Outputs {
+			tags["recipient"] = append(tags["recipient"], output.Address)
+		}
+	}
+	return tags
+}
+
+//addressPrefix 链ID对应的地址前缀，DefaultChainID使用主网前缀
+func addressPrefix(chainID string) string {
+	if chainID == DefaultChainID {
+		return mainnetAddressPrefix
+	}
+	return testnetAddressPrefix
+}
+
+//prefixedSendMsg 按链的地址前缀生成签名数据的转账消息，go-sdk的GetSignBytes按全局的types.Network编码地址
+type prefixedSendMsg struct {
+	msg.SendMsg
+	prefix string
+}
+
+//GetSignBytes 签名数据，地址使用prefix编码
+func (m prefixedSendMsg) GetSignBytes() []byte {
+	inOut := func(address types.AccAddress, coins types.Coins) map[string]interface{} {
+		encoded, _ := bech32.ConvertAndEncode(m.prefix, address)
+		return map[string]interface{}{"address": encoded, "coins": coins}
+	}
+	inputs := make([]interface{}, 0, len(m.Inputs))
+	for _, input := range m.Inputs {
+		inputs = append(inputs, inOut(input.Address, input.Coins))
+	}
+	outputs := make([]interface{}, 0, len(m.Outputs))
+	for _, output := range m.Outputs {
+		outputs = append(outputs, inOut(output.Address, output.Coins))
+	}
+	b, err := json.Marshal(map[string]interface{}{"inputs": inputs, "outputs": outputs})
+	if err != nil {
+		panic(err)
+	}
+	return msg.MustSortJSON(b)
+}
+
+//stdSignBytes 按链ID对应的地址前缀计算交易单的签名数据
+func stdSignBytes(chainID string, accountNumber, sequence int64, msgs []msg.Msg, memo string, source int64, data []byte) []byte {
+	prefixed := make([]msg.Msg, 0, len(msgs))
+	for _, m := range msgs {
+		if sendMsg, ok := m.(msg.SendMsg); ok {
+			m = prefixedSendMsg{SendMsg: sendMsg, prefix: addressPrefix(chainID)}
+		}
+		prefixed = append(prefixed, m)
+	}
+	return tx.StdSignBytes(chainID, accountNumber, sequence, prefixed, memo, source, data)
+}
+
+//TxHash 交易单hash，与Tendermint一致
+func TxHash(txBytes []byte) string {
+	hash := sha256.Sum256(txBytes)
+	return strings.ToUpper(hex.EncodeToString(hash[:]))
+}
+
+//NewSendTx 生成并签名单个输入的转账交易单，返回amino编码的交易单
+func NewSendTx(key crypto.PrivKey, chainID string, accountNumber, sequence int64, to types.AccAddress, coins types.Coins, memo string) ([]byte, error) {
+	from := types.AccAddress(key.PubKey().Address())
+	sendMsg := msg.CreateSendMsg(from, coins, []msg.Transfer{{ToAddr: to, Coins: coins}})
+	msgs := []msg.Msg{sendMsg}
+
+	sig, err := key.Sign(stdSignBytes(chainID, accountNumber, sequence, msgs, memo, 0, nil))
+	if err != nil {
+		return nil, err
+	}
+
+	stdTx := tx.NewStdTx(msgs, []tx.StdSignature{{
+		PubKey:        key.PubKey(),
+		Signature:     sig,
+		AccountNumber: accountNumber,
+		Sequence:      sequence,
+	}}, memo, 0, nil)
+
+	return tx.Cdc.MarshalBinaryLengthPrefixed(&stdTx)
+}
+
+//ServeHTTP 处理GET形式的RPC调用和POST形式的JSON-RPC调用
+func (n *Node) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	id := interface{}("")
+	method := strings.Trim(r.URL.Path, "/")
+	params := make(map[string]string)
+	for key := range r.URL.Query() {
+		params[key] = r.URL.Query().Get(key)
+	}
+
+	if r.Method == http.MethodPost {
+		var request struct {
+			ID     interface{}                `json:"id"`
+			Method string                     `json:"method"`
+			Params map[string]json.RawMessage `json:"params"`
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &request); err != nil {
+			writeResponse(w, id, nil, &rpcError{code: -32700, message: "Parse error", data: err.Error()})
+			return
+		}
+		id = request.ID
+		method = request.Method
+		for key, raw := range request.Params {
+			var value string
+			if err := json.Unmarshal(raw, &value); err != nil {
+				value = string(raw)
+			}
+			params[key] = value
+		}
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if f := n.takeFailure(method); f != nil {
+		if f.status != 0 {
+			w.WriteHeader(f.status)
+			fmt.Fprint(w, http.StatusText(f.status))
+			return
+		}
+		writeResponse(w, id, nil, &rpcError{code: rpcInternalError, message: "Internal error", data: f.message})
+		return
+	}
+
+	var (
+		result interface{}
+		err    *rpcError
+	)
+	switch method {
+	case "status":
+		result = n.status()
+	case "block":
+		result, err = n.block(params["height"])
+	case "tx":
+		result, err = n.tx(params["hash"])
+	case "abci_query":
+		result, err = n.abciQuery(params["path"], params["data"], params["height"])
+	case "broadcast_tx_sync", "broadcast_tx_async", "broadcast_tx_commit":
+		result, err = n.broadcast(method, params["tx"])
+	case "tx_search":
+		result, err = n.txSearch(params["query"], params["page"], params["per_page"])
+	case "unconfirmed_txs":
+		result = n.unconfirmedTxs(params["limit"])
+	default:
+		err = &rpcError{code: rpcMethodNotFound, message: "Method not found"}
+	}
+
+	writeResponse(w, id, result, err)
+}
+
+//writeResponse 输出JSON-RPC结果，出错时与Tendermint v0.31一样返回HTTP 200和error对象
+func writeResponse(w http.ResponseWriter, id interface{}, result interface{}, err *rpcError) {
+	w.Header().Set("Content-Type", "application/json")
+	response := map[string]interface{}{"jsonrpc": "2.0", "id": id}
+	if err != nil {
+		response["error"] = map[string]interface{}{"code": err.code, "message": err.message, "data": err.data}
+	} else {
+		response["result"] = result
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (n *Node) status() interface{} {
+	syncInfo := map[string]interface{}{
+		"latest_block_hash":   "",
+		"latest_block_height": "0",
+		"latest_block_time":   time.Time{}.Format(time.RFC3339Nano),
+		"catching_up":         n.catchingUp,
+	}
+	if len(n.blocks) > 0 {
+		latest := n.blocks[len(n.blocks)-1]
+		syncInfo["latest_block_hash"] = fmt.Sprintf("%X", latest.hash)
+		syncInfo["latest_block_height"] = strconv.FormatInt(latest.height, 10)
+		syncInfo["latest_block_time"] = latest.time.Format(time.RFC3339Nano)
+	}
+	return map[string]interface{}{
+		"node_info": map[string]interface{}{"network": n.chainID, "moniker": "binancechaintest"},
+		"sync_info": syncInfo,
+	}
+}
+
+func (n *Node) block(heightStr string) (interface{}, *rpcError) {
+	latest := int64(len(n.blocks))
+	height := latest
+	if len(heightStr) > 0 {
+		height, _ = strconv.ParseInt(heightStr, 10, 64)
+	}
+	if height <= 0 {
+		return nil, &rpcError{code: rpcInternalError, message: "Internal error", data: "Height must be greater than 0"}
+	}
+	if height > latest {
+		return nil, &rpcError{code: rpcInternalError, message: "Internal error",
+			data: fmt.Sprintf("Height %d must be less than or equal to the current blockchain height %d", height, latest)}
+	}
+
+	block := n.blocks[height-1]
+	txs := make([]string, 0, len(block.txs))
+	for _, txBytes := range block.txs {
+		txs = append(txs, base64.StdEncoding.EncodeToString(txBytes))
+	}
+	header := map[string]interface{}{
+		"chain_id":      n.chainID,
+		"height":        strconv.FormatInt(block.height, 10),
+		"time":          block.time.Format(time.RFC3339Nano),
+		"num_txs":       strconv.Itoa(len(block.txs)),
+		"last_block_id": map[string]interface{}{"hash": fmt.Sprintf("%X", block.prevHash)},
+	}
+	return map[string]interface{}{
+		"block_meta": map[string]interface{}{
+			"block_id": map[string]interface{}{"hash": fmt.Sprintf("%X", block.hash)},
+			"header":   header,
+		},
+		"block": map[string]interface{}{
+			"header": header,
+			"data":   map[string]interface{}{"txs": txs},
+		},
+	}, nil
+}
+
+func (n *Node) tx(hash string) (interface{}, *rpcError) {
+	txid := strings.ToUpper(strings.TrimPrefix(strings.TrimPrefix(hash, "0x"), "0X"))
+	result, exist := n.results[txid]
+	if !exist {
+		return nil, &rpcError{code: rpcInternalError, message: "Internal error", data: fmt.Sprintf("Tx (%s) not found", txid)}
+	}
+	return map[string]interface{}{
+		"hash":      txid,
+		"height":    strconv.FormatInt(result.height, 10),
+		"index":     result.index,
+		"tx_result": map[string]interface{}{"code": result.code, "log": result.log},
+		"tx":        base64.StdEncoding.EncodeToString(result.tx),
+	}, nil
+}
+
+func (n *Node) abciQuery(path, data, heightStr string) (interface{}, *rpcError) {
+	path = strings.Trim(path, "\"")
+	height, _ := strconv.ParseInt(heightStr, 10, 64)
+	if height <= 0 {
+		height = int64(len(n.blocks))
+	}
+	st, exist := n.snapshots[height]
+	if !exist {
+		return nil, &rpcError{code: rpcInternalError, message: "Internal error",
+			data: fmt.Sprintf("Height %d must be less than or equal to the current blockchain height %d", height, len(n.blocks))}
+	}
+
+	response := map[string]interface{}{"code": 0, "height": strconv.FormatInt(height, 10)}
+
+	switch {
+	case path == "/store/acc/key":
+		key, err := hex.DecodeString(strings.TrimPrefix(strings.Trim(data, "\""), "0x"))
+		if err != nil || !bytes.HasPrefix(key, []byte(accountKeyPrefix)) {
+			response["code"] = CodeUnknownRequest
+			response["log"] = "invalid account key"
+			break
+		}
+		acc := st.account(types.AccAddress(key[len(accountKeyPrefix):]), false)
+		if acc == nil {
+			break
+		}
+		value, err := cdc.MarshalBinaryBare(acc)
+		if err != nil {
+			return nil, &rpcError{code: rpcInternalError, message: "Internal error", data: err.Error()}
+		}
+		response["key"] = base64.StdEncoding.EncodeToString(key)
+		response["value"] = base64.StdEncoding.EncodeToString(value)
+	case path == "/param/fees":
+		value, err := cdc.MarshalBinaryLengthPrefixed(n.fees)
+		if err != nil {
+			return nil, &rpcError{code: rpcInternalError, message: "Internal error", data: err.Error()}
+		}
+		response["value"] = base64.StdEncoding.EncodeToString(value)
+	case strings.HasPrefix(path, "tokens/info/"):
+		symbol := strings.TrimPrefix(path, "tokens/info/")
+		var token *types.Token
+		for i := range n.tokens {
+			if n.tokens[i].Symbol == symbol {
+				token = &n.tokens[i]
+			}
+		}
+		if token == nil {
+			response["code"] = CodeUnknownRequest
+			response["log"] = fmt.Sprintf("token(%s) not found", symbol)
+			break
+		}
+		value, err := cdc.MarshalBinaryLengthPrefixed(*token)
+		if err != nil {
+			return nil, &rpcError{code: rpcInternalError, message: "Internal error", data: err.Error()}
+		}
+		response["value"] = base64.StdEncoding.EncodeToString(value)
+	case strings.HasPrefix(path, "tokens/list/"):
+		var offset, limit int
+		if _, err := fmt.Sscanf(strings.TrimPrefix(path, "tokens/list/"), "%d/%d", &offset, &limit); err != nil || offset < 0 || limit <= 0 {
+			response["code"] = CodeUnknownRequest
+			response["log"] = "invalid tokens list query"
+			break
+		}
+		tokens := make([]types.Token, 0)
+		for i := offset; i < len(n.tokens) && i < offset+limit; i++ {
+			tokens = append(tokens, n.tokens[i])
+		}
+		value, err := cdc.MarshalBinaryLengthPrefixed(tokens)
+		if err != nil {
+			return nil, &rpcError{code: rpcInternalError, message: "Internal error", data: err.Error()}
+		}
+		response["value"] = base64.StdEncoding.EncodeToString(value)
+	default:
+		response["code"] = CodeUnknownRequest
+		response["log"] = "unknown query path: " + path
+	}
+
+	return map[string]interface{}{"response": response}, nil
+}
+
+func (n *Node) broadcast(method, txStr string) (interface{}, *rpcError) {
+	var (
+		txBytes []byte
+		err     error
+	)
+	if strings.HasPrefix(txStr, "0x") {
+		txBytes, err = hex.DecodeString(txStr[2:])
+	} else {
+		txBytes, err = base64.StdEncoding.DecodeString(txStr)
+	}
+	if err != nil || len(txBytes) == 0 {
+		return nil, &rpcError{code: -32602, message: "Invalid params", data: "invalid tx"}
+	}
+
+	txid := TxHash(txBytes)
+	code, log, checkErr := n.checkTx(txBytes)
+	if checkErr != nil {
+		return nil, &rpcError{code: rpcInternalError, message: "Internal error", data: checkErr.Error()}
+	}
+	checkResult := map[string]interface{}{"code": code, "data": "", "log": log, "hash": txid}
+
+	switch method {
+	case "broadcast_tx_async":
+		checkResult["code"] = CodeOK
+		checkResult["log"] = ""
+		return checkResult, nil
+	case "broadcast_tx_commit":
+		result := map[string]interface{}{
+			"check_tx":   map[string]interface{}{"code": code, "log": log},
+			"deliver_tx": map[string]interface{}{},
+			"hash":       txid,
+			"height":     "0",
+		}
+		if code == CodeOK {
+			height := n.produceBlock()
+			deliver := n.results[txid]
+			result["deliver_tx"] = map[string]interface{}{"code": deliver.code, "log": deliver.log}
+			result["height"] = strconv.FormatInt(height, 10)
+		}
+		return result, nil
+	}
+
+	return checkResult, nil
+}
+
+func (n *Node) unconfirmedTxs(limitStr string) interface{} {
+	limit, _ := strconv.Atoi(limitStr)
+	if limit <= 0 {
+		limit = defaultTxsLimit
+	}
+	txs := make([]string, 0)
+	total := 0
+	for i, txBytes := range n.mempool {
+		total += len(txBytes)
+		if i < limit {
+			txs = append(txs, base64.StdEncoding.EncodeToString(txBytes))
+		}
+	}
+	return map[string]interface{}{
+		"n_txs":       strconv.Itoa(len(txs)),
+		"total":       strconv.Itoa(len(n.mempool)),
+		"total_bytes": strconv.Itoa(total),
+		"txs":         txs,
+	}
+}
+
+//queryCondition tx_search查询语句中的一个条件
+var queryCondition = regexp.MustCompile(`^\s*([\w.]+)\s*(>=|<=|=|>|<)\s*(.+?)\s*$`)
+
+//matchQuery 交易单是否满足全部条件，支持sender、recipient、tx.hash和tx.height
+func matchQuery(conditions [][]string, txid string, result *txResult) bool {
+	for _, cond := range conditions {
+		key, op, value := cond[1], cond[2], strings.Trim(cond[3], "'")
+		switch key {
+		case "sender", "recipient":
+			_, addr, err := bech32.DecodeAndConvert(value)
+			if err != nil || op != "=" {
+				return false
+			}
+			found := false
+			for _, tagged := range result.tags[key] {
+				if bytes.Equal(tagged, addr) {
+					found = true
+				}
+			}
+			if !found {
+				return false
+			}
+		case "tx.hash":
+			if op != "=" || !strings.EqualFold(value, txid) {
+				return false
+			}
+		case "tx.height":
+			height, _ := strconv.ParseInt(value, 10, 64)
+			switch op {
+			case "=":
+				if result.height != height {
+					return false
+				}
+			case ">=":
+				if result.height < height {
+					return false
+				}
+			case "<=":
+				if result.height > height {
+					return false
+				}
+			case ">":
+				if result.height <= height {
+					return false
+				}
+			case "<":
+				if result.height >= height {
+					return false
+				}
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+//txSearch 按条件查询已上链的交易单，结果按高度和区块内序号从旧到新排序
+func (n *Node) txSearch(query, pageStr, perPageStr string) (interface{}, *rpcError) {
+	query = strings.Trim(query, "\"")
+	conditions := make([][]string, 0)
+	for _, part := range strings.Split(query, " AND ") {
+		cond := queryCondition.FindStringSubmatch(part)
+		if cond == nil {
+			return nil, &rpcError{code: rpcInternalError, message: "Internal error", data: "invalid query: " + query}
+		}
+		conditions = append(conditions, cond)
+	}
+
+	matched := make([]string, 0)
+	for txid, result := range n.results {
+		if matchQuery(conditions, txid, result) {
+			matched = append(matched, txid)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		a, b := n.results[matched[i]], n.results[matched[j]]
+		if a.height != b.height {
+			return a.height < b.height
+		}
+		return a.index < b.index
+	})
+
+	page, _ := strconv.Atoi(pageStr)
+	if page <= 0 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(perPageStr)
+	if perPage <= 0 {
+		perPage = defaultTxsLimit
+	}
+	if perPage > maxPerPage {
+		perPage = maxPerPage
+	}
+	pages := (len(matched) + perPage - 1) / perPage
+	if pages == 0 {
+		pages = 1
+	}
+	if page > pages {
+		return nil, &rpcError{code: rpcInternalError, message: "Internal error",
+			data: fmt.Sprintf("page should be within [1, %d] range, given %d", pages, page)}
+	}
+
+	start := (page - 1) * perPage
+	end := start + perPage
+	if end > len(matched) {
+		end = len(matched)
+	}
+	txs := make([]interface{}, 0, end-start)
+	for _, txid := range matched[start:end] {
+		tx, _ := n.tx(txid)
+		txs = append(txs, tx)
+	}
+
+	return map[string]interface{}{
+		"txs":         txs,
+		"total_count": strconv.Itoa(len(matched)),
+	}, nil
+}
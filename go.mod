@@ -10,10 +10,11 @@ require (
 	github.com/blocktree/go-owcdrivers v1.1.7
 	github.com/blocktree/go-owcrypt v1.0.3
 	github.com/blocktree/openwallet v1.4.8
+	github.com/cosmos/go-bip39 v0.0.0-20180819234021-555e2067c45d
 	github.com/ethereum/go-ethereum v1.8.25
 	github.com/fortytw2/leaktest v1.3.0 // indirect
 	github.com/google/gofuzz v1.0.0 // indirect
-	github.com/graarh/golang-socketio v0.0.0-20170510162725-2c44953b9b5f
+	github.com/gorilla/websocket v1.4.0
 	github.com/imroc/req v0.2.3
 	github.com/jmhodges/levigo v1.0.0 // indirect
 	github.com/pborman/uuid v1.2.0
@@ -21,4 +22,5 @@ require (
 	github.com/tendermint/go-amino v0.14.1
 	github.com/tendermint/tendermint v0.31.2-rc0
 	github.com/tidwall/gjson v1.2.1
+	golang.org/x/crypto v0.0.0-20190701094942-4def268fd1a4
 )